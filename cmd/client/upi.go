@@ -0,0 +1,120 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+
+	"github.com/bhojpur/bank/pkg/qrcode"
+	"github.com/spf13/cobra"
+)
+
+var upiQrCmdOpts struct {
+	Format     string
+	Output     string
+	Level      string
+	ModuleSize int
+	QuietZone  int
+	Logo       string
+	LogoRatio  float64
+	Invert     bool
+}
+
+// upiCmd represents the upi command
+var upiCmd = &cobra.Command{
+	Use:   "upi",
+	Short: "Works with UPI payments and QR codes",
+}
+
+// upiQrCmd represents the upi qr command
+var upiQrCmd = &cobra.Command{
+	Use:   "qr <payload>",
+	Short: "Renders a UPI QR code payload as PNG, SVG or terminal output, without contacting the server",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		level, err := qrcode.ParseLevel(upiQrCmdOpts.Level)
+		if err != nil {
+			return err
+		}
+
+		code, err := qrcode.Encode(args[0], level)
+		if err != nil {
+			return err
+		}
+
+		opts := &qrcode.RenderOptions{
+			ModuleSize: upiQrCmdOpts.ModuleSize,
+			QuietZone:  upiQrCmdOpts.QuietZone,
+			LogoRatio:  upiQrCmdOpts.LogoRatio,
+			Invert:     upiQrCmdOpts.Invert,
+		}
+		if upiQrCmdOpts.Logo != "" {
+			f, err := os.Open(upiQrCmdOpts.Logo)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			if opts.Logo, _, err = image.Decode(f); err != nil {
+				return fmt.Errorf("cannot decode logo %s: %w", upiQrCmdOpts.Logo, err)
+			}
+		}
+
+		var out io.Writer = os.Stdout
+		if upiQrCmdOpts.Output != "" && upiQrCmdOpts.Output != "-" {
+			f, err := os.Create(upiQrCmdOpts.Output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		switch upiQrCmdOpts.Format {
+		case "png":
+			return code.PNG(out, opts)
+		case "svg":
+			return code.SVG(out, opts)
+		case "terminal":
+			return code.Terminal(out, opts)
+		}
+		return fmt.Errorf("unknown format %q, expected png, svg or terminal", upiQrCmdOpts.Format)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upiCmd)
+	upiCmd.AddCommand(upiQrCmd)
+
+	upiQrCmd.Flags().StringVar(&upiQrCmdOpts.Format, "format", "terminal", "output format: png, svg or terminal")
+	upiQrCmd.Flags().StringVarP(&upiQrCmdOpts.Output, "output", "o", "", "file to write to (defaults to stdout)")
+	upiQrCmd.Flags().StringVar(&upiQrCmdOpts.Level, "level", "M", "error correction level: L, M, Q or H")
+	upiQrCmd.Flags().IntVar(&upiQrCmdOpts.ModuleSize, "module-size", 8, "module size in pixels for png and svg")
+	upiQrCmd.Flags().IntVar(&upiQrCmdOpts.QuietZone, "quiet-zone", 4, "quiet zone in modules, negative to disable")
+	upiQrCmd.Flags().StringVar(&upiQrCmdOpts.Logo, "logo", "", "PNG or JPEG logo drawn at the center, requires level Q or H")
+	upiQrCmd.Flags().Float64Var(&upiQrCmdOpts.LogoRatio, "logo-ratio", 0.2, "logo width relative to the symbol, at most 0.3")
+	upiQrCmd.Flags().BoolVar(&upiQrCmdOpts.Invert, "invert", false, "invert terminal output for light backgrounds")
+}
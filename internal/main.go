@@ -177,7 +177,7 @@ func main() {
 				},
 				Entity: types.Entity{
 					Name:         "James Bond",
-					Document:     "00700700700",
+					Document:     "52998224725",
 					DocumentType: "cpf",
 				},
 			},
@@ -294,7 +294,7 @@ func ScheduleAndCancelTransfer(accID string, client *engine.Client) {
 	transfInput := types.TransferInput{
 		AccountID:   accID,
 		Amount:      100,
-		ScheduledTo: "2020-03-25",
+		ScheduledTo: types.NewDate(time.Now().AddDate(0, 0, 7)),
 		Target: types.Target{
 			Account: types.TransferAccount{
 				AccountCode: "334201",
@@ -0,0 +1,422 @@
+package boleto
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
+const (
+	// BarcodeLength is the number of digits of every barcode
+	BarcodeLength = 44
+	// BankLineLength is the number of digits of a bank slip writable line
+	BankLineLength = 47
+	// UtilityLineLength is the number of digits of a utility slip writable line
+	UtilityLineLength = 48
+
+	utilityPrefix = '8'
+)
+
+var (
+	ErrInvalidLength     = errors.New("invalid barcode or writable line length")
+	ErrInvalidCheckDigit = errors.New("invalid check digit")
+	ErrInvalidFormat     = errors.New("invalid barcode or writable line")
+)
+
+// Kind tells bank slips (boletos de cobrança) from utility slips
+// (convênios), which have different layouts
+type Kind int
+
+const (
+	KindBank Kind = iota
+	KindUtility
+)
+
+func (k Kind) String() string {
+	if k == KindUtility {
+		return "utility"
+	}
+	return "bank"
+}
+
+// Slip is a decoded barcode. Amounts are in cents.
+type Slip struct {
+	Kind         Kind
+	Barcode      string
+	WritableLine string
+	Amount       float64
+
+	// Bank slips only
+	BankCode  string
+	Currency  string
+	DueFactor int
+	FreeField string
+
+	// Utility slips only
+	Segment         string
+	ValueIdentifier string
+	CompanyID       string
+}
+
+// Parse decodes a barcode or a writable line, telling them apart by length.
+// Spaces, dots and dashes are ignored.
+func Parse(code string) (*Slip, error) {
+	digits := validation.OnlyDigits(code)
+	if len(digits) != len(strings.NewReplacer(" ", "", ".", "", "-", "").Replace(strings.TrimSpace(code))) {
+		return nil, ErrInvalidFormat
+	}
+
+	switch len(digits) {
+	case BarcodeLength:
+		return ParseBarcode(digits)
+	case BankLineLength, UtilityLineLength:
+		return ParseWritableLine(digits)
+	}
+	return nil, ErrInvalidLength
+}
+
+// ParseBarcode decodes and verifies a 44 digit barcode
+func ParseBarcode(barcode string) (*Slip, error) {
+	barcode = validation.OnlyDigits(barcode)
+	if len(barcode) != BarcodeLength {
+		return nil, ErrInvalidLength
+	}
+
+	if barcode[0] == utilityPrefix {
+		return parseUtility(barcode)
+	}
+	return parseBank(barcode)
+}
+
+// ParseWritableLine decodes and verifies a 47 digit bank or 48 digit
+// utility writable line, including the check digit of each field
+func ParseWritableLine(line string) (*Slip, error) {
+	line = validation.OnlyDigits(line)
+
+	var barcode string
+	var err error
+	switch len(line) {
+	case BankLineLength:
+		barcode, err = bankLineToBarcode(line)
+	case UtilityLineLength:
+		barcode, err = utilityLineToBarcode(line)
+	default:
+		return nil, ErrInvalidLength
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseBarcode(barcode)
+}
+
+// WritableLine converts a barcode to its writable line
+func WritableLine(barcode string) (string, error) {
+	slip, err := ParseBarcode(barcode)
+	if err != nil {
+		return "", err
+	}
+	return slip.WritableLine, nil
+}
+
+// Barcode converts a writable line to its barcode
+func Barcode(line string) (string, error) {
+	slip, err := ParseWritableLine(line)
+	if err != nil {
+		return "", err
+	}
+	return slip.Barcode, nil
+}
+
+// BankBarcode builds a bank slip barcode, computing its check digit. The
+// amount is in cents and the free field holds 25 digits defined by the bank.
+func BankBarcode(bankCode string, dueDate types.Date, amount float64, freeField string) (string, error) {
+	if len(bankCode) != 3 || validation.OnlyDigits(bankCode) != bankCode {
+		return "", errors.New("bank code must have 3 digits")
+	}
+	if len(freeField) != 25 || validation.OnlyDigits(freeField) != freeField {
+		return "", errors.New("free field must have 25 digits")
+	}
+
+	factor := 0
+	if !dueDate.IsZero() {
+		var err error
+		if factor, err = DueFactor(dueDate); err != nil {
+			return "", err
+		}
+	}
+
+	value, err := formatAmount(amount, 10)
+	if err != nil {
+		return "", err
+	}
+
+	body := bankCode + "9" + fmt.Sprintf("%04d", factor) + value + freeField
+	return body[:4] + bankCheckDigit(body) + body[4:], nil
+}
+
+// DueDate returns the due date encoded in a bank slip. The factor is
+// relative to the reference date: it wrapped from 9999 back to 1000 on
+// 2025-02-22, so the cycle closest to reference is chosen. A factor of zero
+// means the slip has no due date.
+func (s *Slip) DueDate(reference time.Time) (types.Date, bool) {
+	if s.Kind != KindBank || s.DueFactor == 0 {
+		return "", false
+	}
+	return dueDate(s.DueFactor, reference), true
+}
+
+var (
+	factorBase      = time.Date(1997, 10, 7, 0, 0, 0, 0, time.UTC)
+	factorResetBase = time.Date(2025, 2, 22, 0, 0, 0, 0, time.UTC)
+)
+
+func dueDate(factor int, reference time.Time) types.Date {
+	first := factorBase.AddDate(0, 0, factor)
+	if factor < 1000 {
+		return types.NewDate(first)
+	}
+
+	best := first
+	ref := time.Date(reference.Year(), reference.Month(), reference.Day(), 0, 0, 0, 0, time.UTC)
+	for cycle := 0; ; cycle++ {
+		candidate := factorResetBase.AddDate(0, 0, cycle*9000+factor-1000)
+		if absDuration(candidate.Sub(ref)) < absDuration(best.Sub(ref)) {
+			best = candidate
+			continue
+		}
+		if candidate.After(ref) {
+			break
+		}
+	}
+	return types.NewDate(best)
+}
+
+// DueFactor returns the factor of a due date, in the cycle that started on
+// 2025-02-22 for dates since then.
+func DueFactor(date types.Date) (int, error) {
+	t, err := date.Time()
+	if err != nil {
+		return 0, err
+	}
+
+	if t.Before(factorResetBase) {
+		factor := int(t.Sub(factorBase).Hours() / 24)
+		if factor < 1000 {
+			return 0, fmt.Errorf("due date %s is too early", date)
+		}
+		return factor, nil
+	}
+
+	return 1000 + int(t.Sub(factorResetBase).Hours()/24)%9000, nil
+}
+
+func parseBank(barcode string) (*Slip, error) {
+	if expected := bankCheckDigit(barcode[:4] + barcode[5:]); expected != barcode[4:5] {
+		return nil, fmt.Errorf("%w: general check digit should be %s", ErrInvalidCheckDigit, expected)
+	}
+
+	factor, _ := strconv.Atoi(barcode[5:9])
+	amount, _ := strconv.ParseFloat(barcode[9:19], 64)
+
+	free := barcode[19:]
+	field1 := barcode[0:4] + free[0:5]
+	field2 := free[5:15]
+	field3 := free[15:25]
+
+	line := field1 + mod10(field1) +
+		field2 + mod10(field2) +
+		field3 + mod10(field3) +
+		barcode[4:5] + barcode[5:19]
+
+	return &Slip{
+		Kind:         KindBank,
+		Barcode:      barcode,
+		WritableLine: line,
+		Amount:       amount,
+		BankCode:     barcode[0:3],
+		Currency:     barcode[3:4],
+		DueFactor:    factor,
+		FreeField:    free,
+	}, nil
+}
+
+func bankLineToBarcode(line string) (string, error) {
+	fields := []struct{ start, end int }{{0, 9}, {10, 20}, {21, 31}}
+	for i, f := range fields {
+		if expected := mod10(line[f.start:f.end]); expected != line[f.end:f.end+1] {
+			return "", fmt.Errorf("%w: field %d check digit should be %s", ErrInvalidCheckDigit, i+1, expected)
+		}
+	}
+
+	return line[0:4] + line[32:33] + line[33:47] + line[4:9] + line[10:20] + line[21:31], nil
+}
+
+func parseUtility(barcode string) (*Slip, error) {
+	checkDigit := utilityCheckFunc(barcode[2])
+	if checkDigit == nil {
+		return nil, fmt.Errorf("%w: unknown value identifier %c", ErrInvalidFormat, barcode[2])
+	}
+
+	if expected := checkDigit(barcode[:3] + barcode[4:]); expected != barcode[3:4] {
+		return nil, fmt.Errorf("%w: general check digit should be %s", ErrInvalidCheckDigit, expected)
+	}
+
+	var line strings.Builder
+	for i := 0; i < 4; i++ {
+		block := barcode[i*11 : i*11+11]
+		line.WriteString(block)
+		line.WriteString(checkDigit(block))
+	}
+
+	slip := &Slip{
+		Kind:            KindUtility,
+		Barcode:         barcode,
+		WritableLine:    line.String(),
+		Segment:         barcode[1:2],
+		ValueIdentifier: barcode[2:3],
+		CompanyID:       barcode[15:19],
+	}
+
+	// Segment 6 identifies the company by the first 8 digits of its CNPJ
+	if slip.Segment == "6" {
+		slip.CompanyID = barcode[15:23]
+	}
+
+	// Identifiers 6 and 8 carry the actual amount, 7 and 9 a reference value
+	if slip.ValueIdentifier == "6" || slip.ValueIdentifier == "8" {
+		slip.Amount, _ = strconv.ParseFloat(barcode[4:15], 64)
+	}
+
+	return slip, nil
+}
+
+func utilityLineToBarcode(line string) (string, error) {
+	if line[0] != utilityPrefix {
+		return "", fmt.Errorf("%w: utility lines start with 8", ErrInvalidFormat)
+	}
+
+	checkDigit := utilityCheckFunc(line[2])
+	if checkDigit == nil {
+		return "", fmt.Errorf("%w: unknown value identifier %c", ErrInvalidFormat, line[2])
+	}
+
+	var barcode strings.Builder
+	for i := 0; i < 4; i++ {
+		block := line[i*12 : i*12+11]
+		if expected := checkDigit(block); expected != line[i*12+11:i*12+12] {
+			return "", fmt.Errorf("%w: field %d check digit should be %s", ErrInvalidCheckDigit, i+1, expected)
+		}
+		barcode.WriteString(block)
+	}
+
+	return barcode.String(), nil
+}
+
+// FormatWritableLine groups a writable line the way it is printed on the
+// slip. Anything that is not a writable line is returned unchanged.
+func FormatWritableLine(line string) string {
+	d := validation.OnlyDigits(line)
+	switch len(d) {
+	case BankLineLength:
+		return fmt.Sprintf("%s.%s %s.%s %s.%s %s %s",
+			d[0:5], d[5:10], d[10:15], d[15:21], d[21:26], d[26:32], d[32:33], d[33:47])
+	case UtilityLineLength:
+		return fmt.Sprintf("%s-%s %s-%s %s-%s %s-%s",
+			d[0:11], d[11:12], d[12:23], d[23:24], d[24:35], d[35:36], d[36:47], d[47:48])
+	}
+	return line
+}
+
+func utilityCheckFunc(valueIdentifier byte) func(string) string {
+	switch valueIdentifier {
+	case '6', '7':
+		return mod10
+	case '8', '9':
+		return utilityMod11
+	}
+	return nil
+}
+
+// mod10 multiplies the digits by 2 and 1 alternately from the right, adding
+// the digits of each product.
+func mod10(s string) string {
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		p := int(s[len(s)-1-i]-'0') * (2 - i%2)
+		sum += p/10 + p%10
+	}
+	return strconv.Itoa((10 - sum%10) % 10)
+}
+
+// weightedMod11 returns the remainder of the digits multiplied by 2 to 9
+// cyclically from the right
+func weightedMod11(s string) int {
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		sum += int(s[len(s)-1-i]-'0') * (2 + i%8)
+	}
+	return sum % 11
+}
+
+// bankCheckDigit is the general check digit of a bank slip, computed over
+// the 43 other digits. It is never zero.
+func bankCheckDigit(s string) string {
+	d := 11 - weightedMod11(s)
+	if d == 0 || d == 10 || d == 11 {
+		return "1"
+	}
+	return strconv.Itoa(d)
+}
+
+func utilityMod11(s string) string {
+	r := weightedMod11(s)
+	if r < 2 {
+		return "0"
+	}
+	return strconv.Itoa(11 - r)
+}
+
+func formatAmount(cents float64, width int) (string, error) {
+	if cents < 0 {
+		return "", errors.New("amount can't be negative")
+	}
+
+	s := strconv.FormatFloat(cents, 'f', 0, 64)
+	if len(s) > width {
+		return "", fmt.Errorf("amount %s doesn't fit in %d digits", s, width)
+	}
+	return strings.Repeat("0", width-len(s)) + s, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,225 @@
+package boleto
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestParseBankWritableLine(t *testing.T) {
+	const line = "00190.50095 40144.816069 06809.350314 3 37370000000100"
+
+	slip, err := Parse(line)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	if slip.Kind != KindBank || slip.BankCode != "001" || slip.Amount != 100 || slip.DueFactor != 3737 {
+		t.Errorf("Parse returned %+v", slip)
+	}
+
+	if slip.Barcode != "00193373700000001000500940144816060680935031" {
+		t.Errorf("Parse returned barcode %s", slip.Barcode)
+	}
+
+	if due, ok := slip.DueDate(time.Date(2008, 1, 1, 0, 0, 0, 0, time.UTC)); !ok || due != "2007-12-31" {
+		t.Errorf("DueDate returned %s, expected 2007-12-31", due)
+	}
+
+	if got := FormatWritableLine(slip.WritableLine); got != line {
+		t.Errorf("FormatWritableLine returned %s, expected %s", got, line)
+	}
+
+	if _, err := Parse("00190.50095 40144.816069 06809.350314 4 37370000000100"); !errors.Is(err, ErrInvalidCheckDigit) {
+		t.Errorf("Parse of a tampered line returned error %v, expected %v", err, ErrInvalidCheckDigit)
+	}
+}
+
+func TestBankBarcodeRoundTrip(t *testing.T) {
+	barcode, err := BankBarcode("341", types.Date("2026-10-30"), 123456, "1090000000000000000000000")
+	if err != nil {
+		t.Fatalf("BankBarcode returned error: %v", err)
+	}
+
+	line, err := WritableLine(barcode)
+	if err != nil {
+		t.Fatalf("WritableLine returned error: %v", err)
+	}
+
+	slip, err := ParseWritableLine(line)
+	if err != nil {
+		t.Fatalf("ParseWritableLine returned error: %v", err)
+	}
+
+	if slip.Barcode != barcode || slip.Amount != 123456 {
+		t.Errorf("ParseWritableLine returned %+v, expected barcode %s", slip, barcode)
+	}
+
+	if due, _ := slip.DueDate(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)); due != "2026-10-30" {
+		t.Errorf("DueDate returned %s, expected 2026-10-30", due)
+	}
+}
+
+func TestUtilityRoundTrip(t *testing.T) {
+	for _, identifier := range []string{"6", "8"} {
+		body := "82" + identifier + "00000012345" + "0123" + "0000000000000000000000000"
+		check := utilityCheckFunc(identifier[0])
+		barcode := body[:3] + check(body) + body[3:]
+
+		slip, err := ParseBarcode(barcode)
+		if err != nil {
+			t.Fatalf("ParseBarcode returned error: %v", err)
+		}
+
+		if slip.Kind != KindUtility || slip.Amount != 12345 || slip.CompanyID != "0123" {
+			t.Errorf("ParseBarcode returned %+v", slip)
+		}
+
+		back, err := Barcode(slip.WritableLine)
+		if err != nil || back != barcode {
+			t.Errorf("Barcode returned %s, %v; expected %s", back, err, barcode)
+		}
+	}
+}
+
+func TestITF(t *testing.T) {
+	const barcode = "00193373700000001000500940144816060680935031"
+
+	widths, err := ITF(barcode)
+	if err != nil {
+		t.Fatalf("ITF returned error: %v", err)
+	}
+	if got := len(widths); got != 4+10*len(barcode)/2+3 {
+		t.Fatalf("ITF returned %d elements", got)
+	}
+
+	total := 0
+	for _, w := range widths {
+		total += w
+	}
+	if total != 405 {
+		t.Errorf("ITF total width is %d units, want 405", total)
+	}
+
+	// decode each pair back from its bars and spaces
+	decode := func(wide [5]bool) byte {
+		for d, pattern := range itfDigits {
+			if pattern == wide {
+				return byte('0' + d)
+			}
+		}
+		return '?'
+	}
+	var digits []byte
+	for i := 4; i+10 <= len(widths)-3; i += 10 {
+		var bars, spaces [5]bool
+		for j := 0; j < 5; j++ {
+			bars[j] = widths[i+2*j] == itfWide
+			spaces[j] = widths[i+2*j+1] == itfWide
+		}
+		digits = append(digits, decode(bars), decode(spaces))
+	}
+	if string(digits) != barcode {
+		t.Errorf("ITF decoded to %s", digits)
+	}
+
+	if _, err := ITF("123"); err == nil {
+		t.Error("ITF expected error for an odd number of digits")
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	invoice := &types.PaymentInvoice{
+		ID:             "inv-1",
+		Amount:         100,
+		WritableLine:   "00190500954014481606906809350314337370000000100",
+		ExpirationDate: "2007-12-31",
+		OurNumber:      "123",
+		QRCode:         "00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-4266554400005204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***63041D3D",
+		Beneficiary:    types.PaymentInvoiceBeneficiary{LegalName: "Acme (Ltda)", Document: "11222333000181"},
+		Payer:          types.PaymentInvoicePayer{LegalName: "João da Silva", Document: "52998224725"},
+		InvoiceRules: types.InvoiceRules{
+			Fine:         &types.InvoiceFine{Type: types.ChargeTypePercent, Value: 2},
+			Instructions: []string{"Referente ao pedido 42"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := RenderPDF(&buf, invoice, &PDFOptions{Branding: Branding{BankName: "Banco"}, ProcessingDate: "2007-12-01"}); err != nil {
+		t.Fatalf("RenderPDF returned error: %v", err)
+	}
+	out := buf.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("RenderPDF didn't write a PDF")
+	}
+
+	// every xref entry must point at its object
+	m := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("RenderPDF wrote no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(out[xref:], -1)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if want := strconv.Itoa(i+1) + " 0 obj"; !bytes.HasPrefix(out[off:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, out[off:off+10])
+		}
+	}
+
+	for _, want := range []string{
+		"(00190.50095 40144.816069 06809.350314 3 37370000000100)",
+		"(001-9)",
+		"(Acme \\(Ltda\\) - 11.222.333/0001-81)",
+		"(Jo\\343o da Silva - 529.982.247-25)",
+		"(R$ 1,00)",
+		"(Ap\\363s o vencimento, cobrar multa de 2,00%)",
+		"(Referente ao pedido 42)",
+		"(Pague com UPI)",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("RenderPDF output doesn't contain %s", want)
+		}
+	}
+
+	// registered late on the 1st in the bank's time zone
+	invoice.RegisteredAt = "2007-12-02T01:30:00Z"
+	buf.Reset()
+	if err := RenderPDF(&buf, invoice, nil); err != nil {
+		t.Fatalf("RenderPDF returned error: %v", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("(01/12/2007)")) {
+		t.Error("RenderPDF didn't default the processing date to the registration day in bank time")
+	}
+
+	invoice.WritableLine = "123"
+	if err := RenderPDF(&buf, invoice, nil); err == nil {
+		t.Error("RenderPDF expected error for an invalid writable line")
+	}
+}
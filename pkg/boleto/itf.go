@@ -0,0 +1,73 @@
+package boleto
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+)
+
+const (
+	itfNarrow = 1
+	itfWide   = 3
+)
+
+// itfDigits are the bar widths of each digit in interleaved 2 of 5, where
+// true is a wide element
+var itfDigits = [10][5]bool{
+	{false, false, true, true, false},
+	{true, false, false, false, true},
+	{false, true, false, false, true},
+	{true, true, false, false, false},
+	{false, false, true, false, true},
+	{true, false, true, false, false},
+	{false, true, true, false, false},
+	{false, false, false, true, true},
+	{true, false, false, true, false},
+	{false, true, false, true, false},
+}
+
+// ITF encodes digits in interleaved 2 of 5, the symbology of slip barcodes.
+// It returns the width of each element in narrow units, alternating bars and
+// spaces and starting with a bar, including the start and stop patterns.
+func ITF(digits string) ([]int, error) {
+	if len(digits) == 0 || len(digits)%2 != 0 {
+		return nil, errors.New("interleaved 2 of 5 requires an even number of digits")
+	}
+
+	widths := []int{itfNarrow, itfNarrow, itfNarrow, itfNarrow}
+	for i := 0; i < len(digits); i += 2 {
+		bars, spaces := digits[i], digits[i+1]
+		if bars < '0' || bars > '9' || spaces < '0' || spaces > '9' {
+			return nil, ErrInvalidFormat
+		}
+		for j := 0; j < 5; j++ {
+			widths = append(widths, itfWidth(itfDigits[bars-'0'][j]), itfWidth(itfDigits[spaces-'0'][j]))
+		}
+	}
+	return append(widths, itfWide, itfNarrow, itfNarrow), nil
+}
+
+func itfWidth(wide bool) int {
+	if wide {
+		return itfWide
+	}
+	return itfNarrow
+}
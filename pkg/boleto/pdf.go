@@ -0,0 +1,214 @@
+package boleto
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+)
+
+const (
+	pageWidth  = 210.0
+	pageHeight = 297.0
+	ptPerMM    = 72 / 25.4
+)
+
+// pdfDoc is a minimal single page A4 PDF writer. It only uses the standard
+// Helvetica fonts, which every reader provides, so nothing is embedded.
+// Coordinates are in millimetres from the top left corner of the page.
+type pdfDoc struct {
+	content bytes.Buffer
+	images  []image.Image
+}
+
+func pt(mm float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", mm*ptPerMM), "0"), ".")
+}
+
+func (d *pdfDoc) op(format string, args ...interface{}) {
+	fmt.Fprintf(&d.content, format, args...)
+	d.content.WriteByte('\n')
+}
+
+func (d *pdfDoc) color(c color.Color) {
+	r, g, b, _ := c.RGBA()
+	rgb := fmt.Sprintf("%.3f %.3f %.3f", float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff)
+	d.op("%s RG %s rg", rgb, rgb)
+}
+
+func (d *pdfDoc) lineWidth(mm float64) {
+	d.op("%s w", pt(mm))
+}
+
+func (d *pdfDoc) dash(on, off float64) {
+	if on == 0 {
+		d.op("[] 0 d")
+		return
+	}
+	d.op("[%s %s] 0 d", pt(on), pt(off))
+}
+
+func (d *pdfDoc) line(x1, y1, x2, y2 float64) {
+	d.op("%s %s m %s %s l S", pt(x1), pt(pageHeight-y1), pt(x2), pt(pageHeight-y2))
+}
+
+func (d *pdfDoc) rect(x, y, w, h float64) {
+	d.op("%s %s %s %s re", pt(x), pt(pageHeight-y-h), pt(w), pt(h))
+}
+
+func (d *pdfDoc) stroke() { d.op("S") }
+func (d *pdfDoc) fill()   { d.op("f") }
+
+// text writes s with its baseline at y, cut to fit maxWidth when positive
+func (d *pdfDoc) text(x, y, size float64, bold bool, maxWidth float64, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	if maxWidth > 0 {
+		s = fitText(s, size, maxWidth)
+	}
+	d.op("BT /%s %.1f Tf %s %s Td (%s) Tj ET", font, size, pt(x), pt(pageHeight-y), pdfString(s))
+}
+
+// image draws img scaled into the box, keeping its aspect ratio
+func (d *pdfDoc) image(x, y, w, h float64, img image.Image) {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return
+	}
+	if ratio := float64(b.Dy()) / float64(b.Dx()); w*ratio > h {
+		w = h / ratio
+	} else {
+		h = w * ratio
+	}
+	d.images = append(d.images, img)
+	d.op("q %s 0 0 %s %s %s cm /Im%d Do Q", pt(w), pt(h), pt(x), pt(pageHeight-y-h), len(d.images))
+}
+
+// fitText cuts s to roughly fit width, using the average Helvetica glyph
+// width since the real metrics are not worth carrying around
+func fitText(s string, size, width float64) string {
+	max := int(width * ptPerMM / (size * 0.52))
+	r := []rune(s)
+	if len(r) <= max || max < 1 {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
+
+// pdfString escapes s as a literal string in WinAnsiEncoding. Characters
+// outside Latin-1 become question marks.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '…':
+			b.WriteString(`\205`)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// WriteTo writes the document, implementing io.WriterTo
+func (d *pdfDoc) WriteTo(w io.Writer) (int64, error) {
+	var objects [][]byte
+	add := func(format string, args ...interface{}) int {
+		objects = append(objects, []byte(fmt.Sprintf(format, args...)))
+		return len(objects)
+	}
+
+	add("<< /Type /Catalog /Pages 2 0 R >>")
+	add("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	page := add("")
+	content := add("<< /Length %d >>\nstream\n%s\nendstream", d.content.Len(), d.content.Bytes())
+	regular := add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	bold := add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	var xobjects strings.Builder
+	for i, img := range d.images {
+		data, err := deflateRGB(img)
+		if err != nil {
+			return 0, err
+		}
+		b := img.Bounds()
+		n := add("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+			b.Dx(), b.Dy(), len(data), data)
+		fmt.Fprintf(&xobjects, " /Im%d %d 0 R", i+1, n)
+	}
+
+	objects[page-1] = []byte(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Contents %d 0 R /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> /XObject <<%s >> >> >>",
+		pt(pageWidth), pt(pageHeight), content, regular, bold, xobjects.String()))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.WriteTo(w)
+}
+
+// deflateRGB compresses the pixels of img over a white background
+func deflateRGB(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	b := img.Bounds()
+	row := make([]byte, 0, b.Dx()*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			white := 0xffff - a
+			row = append(row, byte((r+white)>>8), byte((g+white)>>8), byte((bl+white)>>8))
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,432 @@
+package boleto
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/qrcode"
+	"github.com/bhojpur/bank/pkg/types"
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
+const (
+	margin       = 10.0
+	contentWidth = pageWidth - 2*margin
+	rightColumn  = 40.0
+	rowHeight    = 9.0
+
+	// itfModule is the narrow bar width in millimetres, which makes the
+	// barcode 103mm long as the specification requires
+	itfModule       = 0.254
+	itfHeight       = 13.0
+	maxInstructions = 10
+)
+
+// Branding customises the parts of the slip that belong to the issuer
+type Branding struct {
+	// BankName is printed in the header when there is no Logo
+	BankName string
+	// Logo is drawn in the header, scaled to fit
+	Logo image.Image
+	// Color is used for rules and the bank name; defaults to black
+	Color color.Color
+	// PaymentPlace replaces the default "Local de pagamento" text
+	PaymentPlace string
+	// Instructions are printed after those of the invoice
+	Instructions []string
+}
+
+// PDFOptions controls RenderPDF
+type PDFOptions struct {
+	Branding Branding
+	// ProcessingDate is printed as "Data do processamento"; defaults to the
+	// registration date of the invoice, or today
+	ProcessingDate types.Date
+}
+
+// RenderPDF writes a printable A4 slip for invoice with the payer receipt
+// and the compensation form, including the writable line and the barcode.
+// Hybrid invoices also get their UPI QR code. Nothing is fetched over the
+// network.
+func RenderPDF(w io.Writer, invoice *types.PaymentInvoice, opts *PDFOptions) error {
+	if invoice == nil {
+		return errors.New("invoice can't be nil")
+	}
+	var o PDFOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	code := invoice.Barcode
+	if code == "" {
+		code = invoice.WritableLine
+	}
+	slip, err := Parse(code)
+	if err != nil {
+		return err
+	}
+	if slip.Kind != KindBank {
+		return errors.New("only bank slips can be rendered")
+	}
+
+	var qr *qrcode.Code
+	if invoice.QRCode != "" {
+		if qr, err = qrcode.Encode(invoice.QRCode, qrcode.Medium); err != nil {
+			return err
+		}
+	}
+
+	r := slipRenderer{doc: &pdfDoc{}, invoice: invoice, slip: slip, branding: o.Branding}
+	if r.branding.Color == nil {
+		r.branding.Color = color.Black
+	}
+	if r.branding.PaymentPlace == "" {
+		r.branding.PaymentPlace = "Pagável em qualquer banco até o vencimento"
+	}
+	r.processed = o.ProcessingDate
+	if r.processed.IsZero() {
+		r.processed = types.NewDate(types.BankNow())
+		if registered, err := types.BankDate(invoice.RegisteredAt); err == nil {
+			r.processed = registered
+		}
+	}
+
+	r.receipt(qr)
+	r.cutLine(margin + 88)
+	if err := r.compensation(margin + 95); err != nil {
+		return err
+	}
+
+	_, err = r.doc.WriteTo(w)
+	return err
+}
+
+type slipRenderer struct {
+	doc       *pdfDoc
+	invoice   *types.PaymentInvoice
+	slip      *Slip
+	branding  Branding
+	processed types.Date
+}
+
+// receipt draws the payer receipt at the top of the page
+func (r *slipRenderer) receipt(qr *qrcode.Code) {
+	inv := r.invoice
+	y := margin
+	r.header(y, "Recibo do Pagador")
+	y += 10
+
+	left := contentWidth - 2*rightColumn
+	r.field(margin, y, left, rowHeight, "Beneficiário", party(inv.Beneficiary.LegalName, inv.Beneficiary.Document))
+	r.field(margin+left, y, rightColumn, rowHeight, "Agência/Código do beneficiário", r.beneficiaryCode())
+	r.field(margin+left+rightColumn, y, rightColumn, rowHeight, "Vencimento", formatDate(inv.ExpirationDate))
+	y += rowHeight
+
+	r.field(margin, y, left, rowHeight, "Pagador", party(inv.Payer.LegalName, inv.Payer.Document))
+	r.field(margin+left, y, rightColumn, rowHeight, "Nosso número", inv.OurNumber)
+	r.field(margin+left+rightColumn, y, rightColumn, rowHeight, "(=) Valor do documento", formatMoney(inv.Amount))
+	y += rowHeight
+
+	r.field(margin, y, contentWidth-rightColumn, rowHeight, "Linha digitável", FormatWritableLine(r.slip.WritableLine))
+	r.field(margin+contentWidth-rightColumn, y, rightColumn, rowHeight, "Data do documento", formatDate(r.documentDate()))
+	y += rowHeight
+
+	h := 45.0
+	r.field(margin, y, contentWidth-rightColumn, h, "Autenticação mecânica", "")
+	if qr == nil {
+		r.field(margin+contentWidth-rightColumn, y, rightColumn, h, "", "")
+		return
+	}
+	r.field(margin+contentWidth-rightColumn, y, rightColumn, h, "Pague com UPI", "")
+	r.qrCode(margin+contentWidth-rightColumn+3, y+5, rightColumn-6, qr)
+}
+
+// compensation draws the compensation form (ficha de compensação) at y
+func (r *slipRenderer) compensation(y float64) error {
+	inv := r.invoice
+	left := contentWidth - rightColumn
+	x := margin + left
+
+	r.header(y, FormatWritableLine(r.slip.WritableLine))
+	y += 10
+
+	r.field(margin, y, left, rowHeight, "Local de pagamento", r.branding.PaymentPlace)
+	r.field(x, y, rightColumn, rowHeight, "Vencimento", formatDate(inv.ExpirationDate))
+	y += rowHeight
+
+	r.field(margin, y, left, rowHeight, "Beneficiário", party(inv.Beneficiary.LegalName, inv.Beneficiary.Document))
+	r.field(x, y, rightColumn, rowHeight, "Agência/Código do beneficiário", r.beneficiaryCode())
+	y += rowHeight
+
+	r.row(y, []cell{
+		{30, "Data do documento", formatDate(r.documentDate())},
+		{40, "Nº do documento", inv.ID},
+		{20, "Espécie doc.", documentKind(inv.InvoiceType)},
+		{15, "Aceite", "N"},
+		{left - 105, "Data do processamento", formatDate(string(r.processed))},
+	})
+	r.field(x, y, rightColumn, rowHeight, "Nosso número", inv.OurNumber)
+	y += rowHeight
+
+	r.row(y, []cell{
+		{30, "Uso do banco", ""},
+		{20, "Carteira", ""},
+		{20, "Espécie", "R$"},
+		{40, "Quantidade", ""},
+		{left - 110, "Valor", ""},
+	})
+	r.field(x, y, rightColumn, rowHeight, "(=) Valor do documento", formatMoney(inv.Amount))
+	y += rowHeight
+
+	labels := []string{"(-) Desconto/Abatimento", "(-) Outras deduções", "(+) Mora/Multa", "(+) Outros acréscimos", "(=) Valor cobrado"}
+	r.field(margin, y, left, rowHeight*float64(len(labels)), "Instruções (texto de responsabilidade do beneficiário)", "")
+	for i, line := range r.instructions() {
+		r.doc.text(margin+1.5, y+7+float64(i)*4, 8, false, left-3, line)
+	}
+	for i, label := range labels {
+		r.field(x, y+float64(i)*rowHeight, rightColumn, rowHeight, label, "")
+	}
+	y += rowHeight * float64(len(labels))
+
+	r.field(margin, y, contentWidth, 12, "Pagador", party(inv.Payer.LegalName, inv.Payer.Document))
+	y += 12
+
+	r.doc.color(color.Black)
+	r.doc.text(margin+contentWidth-70, y+3, 6, false, 0, "Autenticação mecânica - Ficha de Compensação")
+	return r.barcode(margin+2, y+5)
+}
+
+// header draws the bank identification followed by title on the right
+func (r *slipRenderer) header(y float64, title string) {
+	d := r.doc
+	d.color(r.branding.Color)
+	if r.branding.Logo != nil {
+		d.image(margin, y+1, 38, 8, r.branding.Logo)
+	} else {
+		d.text(margin, y+7, 11, true, 38, r.branding.BankName)
+	}
+
+	d.lineWidth(0.5)
+	d.line(margin+40, y+1, margin+40, y+10)
+	d.line(margin+60, y+1, margin+60, y+10)
+	d.line(margin, y+10, margin+contentWidth, y+10)
+	d.text(margin+42, y+8, 13, true, 0, r.slip.BankCode+"-"+bankCodeDigit(r.slip.BankCode))
+
+	d.color(color.Black)
+	d.text(margin+63, y+8, 10, true, contentWidth-63, title)
+}
+
+type cell struct {
+	width float64
+	label string
+	value string
+}
+
+func (r *slipRenderer) row(y float64, cells []cell) {
+	x := margin
+	for _, c := range cells {
+		r.field(x, y, c.width, rowHeight, c.label, c.value)
+		x += c.width
+	}
+}
+
+// field draws a box with a small label and its value
+func (r *slipRenderer) field(x, y, w, h float64, label, value string) {
+	d := r.doc
+	d.color(r.branding.Color)
+	d.lineWidth(0.2)
+	d.rect(x, y, w, h)
+	d.stroke()
+
+	d.color(color.Black)
+	if label != "" {
+		d.text(x+1, y+2.5, 5.5, false, w-2, label)
+	}
+	if value != "" {
+		d.text(x+1.5, y+7, 9, false, w-3, value)
+	}
+}
+
+func (r *slipRenderer) cutLine(y float64) {
+	d := r.doc
+	d.color(color.Gray{Y: 0x80})
+	d.lineWidth(0.2)
+	d.dash(1, 1)
+	d.line(margin, y, margin+contentWidth, y)
+	d.dash(0, 0)
+	d.text(margin+contentWidth-25, y-1, 5.5, false, 0, "Corte na linha pontilhada")
+}
+
+// barcode draws the ITF-25 barcode of the slip with its left edge at x
+func (r *slipRenderer) barcode(x, y float64) error {
+	widths, err := ITF(r.slip.Barcode)
+	if err != nil {
+		return err
+	}
+
+	d := r.doc
+	d.color(color.Black)
+	for i, w := range widths {
+		width := float64(w) * itfModule
+		if i%2 == 0 {
+			d.rect(x, y, width, itfHeight)
+		}
+		x += width
+	}
+	d.fill()
+	return nil
+}
+
+// qrCode draws code as vector modules in a square of side size
+func (r *slipRenderer) qrCode(x, y, size float64, code *qrcode.Code) {
+	d := r.doc
+	d.color(color.Black)
+	module := size / float64(code.Size())
+	for j := 0; j < code.Size(); j++ {
+		for i := 0; i < code.Size(); i++ {
+			if code.Dark(i, j) {
+				d.rect(x+float64(i)*module, y+float64(j)*module, module, module)
+			}
+		}
+	}
+	d.fill()
+}
+
+func (r *slipRenderer) beneficiaryCode() string {
+	b := r.invoice.Beneficiary
+	if b.BranchCode == "" {
+		return b.AccountCode
+	}
+	return b.BranchCode + " / " + b.AccountCode
+}
+
+func (r *slipRenderer) documentDate() string {
+	if r.invoice.IssuanceDate != "" {
+		return r.invoice.IssuanceDate
+	}
+	if created, err := types.BankDate(r.invoice.CreatedAt); err == nil {
+		return created.String()
+	}
+	return ""
+}
+
+// instructions describes the charges of the invoice followed by its own
+// instructions and those of the branding
+func (r *slipRenderer) instructions() []string {
+	inv := r.invoice
+	var lines []string
+
+	if inv.LimitDate != "" && inv.LimitDate != inv.ExpirationDate {
+		lines = append(lines, "Não receber após "+formatDate(inv.LimitDate))
+	}
+	if f := inv.Fine; f != nil {
+		lines = append(lines, "Após o vencimento, cobrar multa de "+formatCharge(f.Type, f.Value))
+	}
+	if i := inv.Interest; i != nil {
+		switch i.Type {
+		case types.InterestTypeDailyAmount:
+			lines = append(lines, "Após o vencimento, cobrar juros de "+formatMoney(i.Value)+" por dia de atraso")
+		case types.InterestTypeMonthlyPercent:
+			lines = append(lines, "Após o vencimento, cobrar juros de "+formatPercent(i.Value)+" ao mês")
+		}
+	}
+	for _, disc := range inv.Discounts {
+		lines = append(lines, "Conceder desconto de "+formatCharge(disc.Type, disc.Value)+" até "+formatDate(string(disc.LimitDate)))
+	}
+	lines = append(lines, inv.Instructions...)
+	lines = append(lines, r.branding.Instructions...)
+
+	if len(lines) > maxInstructions {
+		lines = lines[:maxInstructions]
+	}
+	return lines
+}
+
+func party(name, document string) string {
+	if document == "" {
+		return name
+	}
+	return name + " - " + validation.FormatDocument(document)
+}
+
+// documentKind is the FEBRABAN species of each invoice type
+func documentKind(invoiceType string) string {
+	switch invoiceType {
+	case types.InvoiceTypeBillOfExchange:
+		return "LC"
+	case types.InvoiceTypeProposal:
+		return "BDP"
+	}
+	return "OU"
+}
+
+// bankCodeDigit is the check digit printed after the bank code
+func bankCodeDigit(code string) string {
+	d := 11 - weightedMod11(code)
+	if d >= 10 {
+		return "0"
+	}
+	return strconv.Itoa(d)
+}
+
+func formatDate(date string) string {
+	t, err := time.Parse(types.DateLayout, date)
+	if err != nil {
+		return date
+	}
+	return t.Format("02/01/2006")
+}
+
+func formatCharge(chargeType string, value float64) string {
+	if chargeType == types.ChargeTypePercent {
+		return formatPercent(value)
+	}
+	return formatMoney(value)
+}
+
+func formatPercent(value float64) string {
+	return strings.Replace(strconv.FormatFloat(value, 'f', 2, 64), ".", ",", 1) + "%"
+}
+
+// formatMoney formats cents as reais, such as R$ 1.234,56
+func formatMoney(cents float64) string {
+	s := strconv.FormatFloat(cents, 'f', 0, 64)
+	for len(s) < 3 {
+		s = "0" + s
+	}
+	units, decimals := s[:len(s)-2], s[len(s)-2:]
+
+	var b strings.Builder
+	for i, c := range units {
+		if i > 0 && (len(units)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(c)
+	}
+	return "R$ " + b.String() + "," + decimals
+}
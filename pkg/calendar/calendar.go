@@ -0,0 +1,355 @@
+package calendar
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// Brasilia is the time zone of the Brazilian payment system, see
+// types.BankLocation.
+var Brasilia = types.BankLocation
+
+// Operation is a kind of payment with its own settlement window
+type Operation string
+
+const (
+	// OperationInternalTransfer moves money between accounts of the bank and
+	// settles at any time
+	OperationInternalTransfer Operation = "internal_transfer"
+	// OperationExternalTransfer goes through the STR and settles on business
+	// days before the cut-off
+	OperationExternalTransfer Operation = "external_transfer"
+	// OperationUpi settles at any time, every day
+	OperationUpi Operation = "upi"
+	// OperationBarcodePayment pays a slip on business days before the cut-off
+	OperationBarcodePayment Operation = "barcode_payment"
+	// OperationInvoice is the settlement of an issued invoice
+	OperationInvoice Operation = "invoice"
+)
+
+// CutOff is the time of day after which an operation settles on the next
+// business day
+type CutOff struct {
+	Hour   int
+	Minute int
+}
+
+func (c CutOff) String() string {
+	return fmt.Sprintf("%02d:%02d", c.Hour, c.Minute)
+}
+
+// DefaultCutOffs are the windows of the operations that follow business days
+var DefaultCutOffs = map[Operation]CutOff{
+	OperationExternalTransfer: {Hour: 17},
+	OperationBarcodePayment:   {Hour: 20},
+	OperationInvoice:          {Hour: 21},
+}
+
+type monthDay struct {
+	month time.Month
+	day   int
+}
+
+// Calendar tells business days apart from weekends and holidays. The national
+// holidays are built in; local ones are added with AddHoliday and
+// AddRecurringHoliday. It is safe for concurrent use.
+type Calendar struct {
+	mu        sync.RWMutex
+	loc       *time.Location
+	holidays  map[types.Date]string
+	recurring map[monthDay]string
+	cutOffs   map[Operation]CutOff
+	national  map[int]map[types.Date]string
+}
+
+// New returns a calendar with the national holidays and DefaultCutOffs, in
+// the Brasilia time zone.
+func New() *Calendar {
+	c := &Calendar{
+		loc:       Brasilia,
+		holidays:  make(map[types.Date]string),
+		recurring: make(map[monthDay]string),
+		cutOffs:   make(map[Operation]CutOff),
+		national:  make(map[int]map[types.Date]string),
+	}
+	for op, cutOff := range DefaultCutOffs {
+		c.cutOffs[op] = cutOff
+	}
+	return c
+}
+
+// Location returns the time zone cut-offs are evaluated in
+func (c *Calendar) Location() *time.Location {
+	return c.loc
+}
+
+// AddHoliday adds a local holiday on a single date
+func (c *Calendar) AddHoliday(date types.Date, name string) error {
+	if _, err := date.Time(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.holidays[date] = name
+	return nil
+}
+
+// AddRecurringHoliday adds a local holiday on the same day every year, such
+// as the anniversary of a city
+func (c *Calendar) AddRecurringHoliday(month time.Month, day int, name string) error {
+	if month < time.January || month > time.December || day < 1 || day > 31 {
+		return fmt.Errorf("invalid holiday %02d-%02d", month, day)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recurring[monthDay{month, day}] = name
+	return nil
+}
+
+// SetCutOff changes the cut-off of an operation
+func (c *Calendar) SetCutOff(op Operation, cutOff CutOff) error {
+	if cutOff.Hour < 0 || cutOff.Hour > 23 || cutOff.Minute < 0 || cutOff.Minute > 59 {
+		return fmt.Errorf("invalid cut-off %s", cutOff)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cutOffs[op] = cutOff
+	return nil
+}
+
+// CutOffOf returns the cut-off of an operation. Operations without one settle
+// at any time, every day.
+func (c *Calendar) CutOffOf(op Operation) (CutOff, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cutOff, ok := c.cutOffs[op]
+	return cutOff, ok
+}
+
+// Holiday returns the name of the holiday on date, if any
+func (c *Calendar) Holiday(date types.Date) (string, bool) {
+	t, err := date.Time()
+	if err != nil {
+		return "", false
+	}
+	return c.holiday(t)
+}
+
+// IsBusinessDay reports whether date is neither a weekend nor a holiday
+func (c *Calendar) IsBusinessDay(date types.Date) bool {
+	t, err := date.Time()
+	if err != nil {
+		return false
+	}
+	return c.isBusinessDay(t)
+}
+
+// Following returns date when it is a business day, or the next one.
+// Invalid dates are returned unchanged by this and the other date helpers.
+func (c *Calendar) Following(date types.Date) types.Date {
+	t, err := date.Time()
+	if err != nil {
+		return date
+	}
+	return types.NewDate(c.following(t))
+}
+
+// NextBusinessDay returns the first business day after date
+func (c *Calendar) NextBusinessDay(date types.Date) types.Date {
+	t, err := date.Time()
+	if err != nil {
+		return date
+	}
+	return types.NewDate(c.following(t.AddDate(0, 0, 1)))
+}
+
+// AddBusinessDays moves n business days from date, backwards when n is
+// negative. A non business date counts from the following business day.
+func (c *Calendar) AddBusinessDays(date types.Date, n int) types.Date {
+	t, err := date.Time()
+	if err != nil {
+		return date
+	}
+
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	} else {
+		t = c.following(t)
+	}
+
+	for n > 0 {
+		t = t.AddDate(0, 0, step)
+		if c.isBusinessDay(t) {
+			n--
+		}
+	}
+	return types.NewDate(t)
+}
+
+func (c *Calendar) holiday(t time.Time) (string, bool) {
+	date := types.NewDate(t)
+	if name, ok := c.nationalHolidays(t.Year())[date]; ok {
+		return name, true
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if name, ok := c.holidays[date]; ok {
+		return name, true
+	}
+	name, ok := c.recurring[monthDay{t.Month(), t.Day()}]
+	return name, ok
+}
+
+// nationalHolidays is NationalHolidays computed once per year
+func (c *Calendar) nationalHolidays(year int) map[types.Date]string {
+	c.mu.RLock()
+	holidays, ok := c.national[year]
+	c.mu.RUnlock()
+	if ok {
+		return holidays
+	}
+
+	holidays = NationalHolidays(year)
+	c.mu.Lock()
+	c.national[year] = holidays
+	c.mu.Unlock()
+	return holidays
+}
+
+func (c *Calendar) isBusinessDay(t time.Time) bool {
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := c.holiday(t)
+	return !holiday
+}
+
+func (c *Calendar) following(t time.Time) time.Time {
+	for !c.isBusinessDay(t) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// Settlement returns the date an operation submitted at t settles on.
+// Operations with a cut-off settle on t's date only when it is a business
+// day and t is before the cut-off.
+func (c *Calendar) Settlement(op Operation, t time.Time) types.Date {
+	local := t.In(c.loc)
+	date := types.NewDate(local)
+
+	cutOff, ok := c.CutOffOf(op)
+	if !ok {
+		return date
+	}
+
+	if !c.IsBusinessDay(date) {
+		return c.Following(date)
+	}
+	if local.Hour()*60+local.Minute() >= cutOff.Hour*60+cutOff.Minute {
+		return c.NextBusinessDay(date)
+	}
+	return date
+}
+
+// Scheduled returns the date an operation scheduled to date settles on, and
+// whether it was delayed. A zero date or one not after now's date is
+// submitted immediately, so it is subject to the cut-off.
+func (c *Calendar) Scheduled(op Operation, date types.Date, now time.Time) (types.Date, bool) {
+	today := types.NewDate(now.In(c.loc))
+	if date.IsZero() || !today.Before(date) {
+		effective := c.Settlement(op, now)
+		return effective, today.Before(effective)
+	}
+
+	if _, ok := c.CutOffOf(op); !ok {
+		return date, false
+	}
+	effective := c.Following(date)
+	return effective, effective != date
+}
+
+// DueDate returns the last day an invoice expiring on expiration can be paid
+// without charges, which moves to the next business day when it expires on a
+// weekend or holiday. It makes Calendar a types.DueDates.
+func (c *Calendar) DueDate(expiration types.Date) types.Date {
+	return c.Following(expiration)
+}
+
+// NationalHolidays returns the national bank holidays of a year, Carnival
+// included, by date.
+func NationalHolidays(year int) map[types.Date]string {
+	on := func(month time.Month, day int) types.Date {
+		return types.NewDate(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+	}
+
+	holidays := map[types.Date]string{
+		on(time.January, 1):   "Confraternização Universal",
+		on(time.April, 21):    "Tiradentes",
+		on(time.May, 1):       "Dia do Trabalho",
+		on(time.September, 7): "Independência do Brasil",
+		on(time.October, 12):  "Nossa Senhora Aparecida",
+		on(time.November, 2):  "Finados",
+		on(time.November, 15): "Proclamação da República",
+		on(time.December, 25): "Natal",
+	}
+	if year >= 2024 {
+		holidays[on(time.November, 20)] = "Dia Nacional de Zumbi e da Consciência Negra"
+	}
+
+	easter := easterSunday(year)
+	holidays[types.NewDate(easter.AddDate(0, 0, -48))] = "Carnaval"
+	holidays[types.NewDate(easter.AddDate(0, 0, -47))] = "Carnaval"
+	holidays[types.NewDate(easter.AddDate(0, 0, -2))] = "Sexta-feira Santa"
+	holidays[types.NewDate(easter.AddDate(0, 0, 60))] = "Corpus Christi"
+
+	return holidays
+}
+
+// easterSunday uses the anonymous Gregorian algorithm
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,172 @@
+package calendar
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestNationalHolidays(t *testing.T) {
+	holidays := NationalHolidays(2024)
+	for date, name := range map[types.Date]string{
+		"2024-02-12": "Carnaval",
+		"2024-02-13": "Carnaval",
+		"2024-03-29": "Sexta-feira Santa",
+		"2024-05-30": "Corpus Christi",
+		"2024-11-20": "Dia Nacional de Zumbi e da Consciência Negra",
+		"2024-12-25": "Natal",
+	} {
+		if holidays[date] != name {
+			t.Errorf("NationalHolidays(2024)[%s] = %q, expected %q", date, holidays[date], name)
+		}
+	}
+
+	if _, ok := NationalHolidays(2023)["2023-11-20"]; ok {
+		t.Error("NationalHolidays(2023) has 2023-11-20, a national holiday only since 2024")
+	}
+	if _, ok := NationalHolidays(2025)["2025-04-18"]; !ok {
+		t.Error("NationalHolidays(2025) misses Good Friday on 2025-04-18")
+	}
+}
+
+func TestBusinessDays(t *testing.T) {
+	c := New()
+	if err := c.AddRecurringHoliday(time.January, 25, "Aniversário de São Paulo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddHoliday("2024-07-09", "Revolução Constitucionalista"); err != nil {
+		t.Fatal(err)
+	}
+
+	for date, want := range map[types.Date]bool{
+		"2024-11-19": true,
+		"2024-11-20": false,
+		"2024-11-23": false,
+		"2024-01-25": false,
+		"2025-01-25": false,
+		"2024-07-09": false,
+		"2025-07-09": true,
+		"invalid":    false,
+	} {
+		if got := c.IsBusinessDay(date); got != want {
+			t.Errorf("IsBusinessDay(%s) = %v, expected %v", date, got, want)
+		}
+	}
+
+	dates := []struct {
+		name string
+		got  types.Date
+		want types.Date
+	}{
+		{"Following holiday", c.Following("2024-11-15"), "2024-11-18"},
+		{"Following business day", c.Following("2024-11-19"), "2024-11-19"},
+		{"NextBusinessDay", c.NextBusinessDay("2024-11-19"), "2024-11-21"},
+		{"AddBusinessDays forward", c.AddBusinessDays("2024-12-24", 1), "2024-12-26"},
+		{"AddBusinessDays from weekend", c.AddBusinessDays("2024-11-16", 2), "2024-11-21"},
+		{"AddBusinessDays backwards", c.AddBusinessDays("2024-12-26", -2), "2024-12-23"},
+		{"DueDate", c.DueDate("2024-03-29"), "2024-04-01"},
+	}
+	for _, d := range dates {
+		if d.got != d.want {
+			t.Errorf("%s = %s, expected %s", d.name, d.got, d.want)
+		}
+	}
+}
+
+func TestSettlement(t *testing.T) {
+	c := New()
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, Brasilia)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	settlements := []struct {
+		op   Operation
+		at   time.Time
+		want types.Date
+	}{
+		{OperationExternalTransfer, at("2024-11-19 16:59"), "2024-11-19"},
+		{OperationExternalTransfer, at("2024-11-19 17:00"), "2024-11-21"},
+		{OperationExternalTransfer, at("2024-11-23 10:00"), "2024-11-25"},
+		// 23:30 UTC is still the same day in Brasilia
+		{OperationExternalTransfer, time.Date(2024, 11, 18, 23, 30, 0, 0, time.UTC), "2024-11-19"},
+		{OperationUpi, at("2024-11-23 10:00"), "2024-11-23"},
+		{OperationInternalTransfer, at("2024-11-20 23:00"), "2024-11-20"},
+	}
+	for _, s := range settlements {
+		if got := c.Settlement(s.op, s.at); got != s.want {
+			t.Errorf("Settlement(%s, %s) = %s, expected %s", s.op, s.at, got, s.want)
+		}
+	}
+
+	now := at("2024-11-18 09:00")
+	if date, delayed := c.Scheduled(OperationExternalTransfer, "2024-11-23", now); date != "2024-11-25" || !delayed {
+		t.Errorf("Scheduled on a saturday = %s, %v, expected 2024-11-25 delayed", date, delayed)
+	}
+	if date, delayed := c.Scheduled(OperationUpi, "2024-11-23", now); date != "2024-11-23" || delayed {
+		t.Errorf("Scheduled UPI on a saturday = %s, %v, expected 2024-11-23", date, delayed)
+	}
+	if date, delayed := c.Scheduled(OperationExternalTransfer, "", at("2024-11-19 18:00")); date != "2024-11-21" || !delayed {
+		t.Errorf("Scheduled after the cut-off = %s, %v, expected 2024-11-21 delayed", date, delayed)
+	}
+
+	if err := c.SetCutOff(OperationExternalTransfer, CutOff{Hour: 18, Minute: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Settlement(OperationExternalTransfer, at("2024-11-19 18:00")); got != "2024-11-19" {
+		t.Errorf("Settlement before a later cut-off = %s, expected 2024-11-19", got)
+	}
+	if err := c.SetCutOff(OperationExternalTransfer, CutOff{Hour: 24}); err == nil {
+		t.Error("SetCutOff expected error for hour 24")
+	}
+}
+
+func TestInvoiceAmountDueOn(t *testing.T) {
+	c := New()
+	rules := types.InvoiceRules{
+		Fine:     &types.InvoiceFine{Type: types.ChargeTypePercent, Value: 2},
+		Interest: &types.InvoiceInterest{Type: types.InterestTypeDailyAmount, Value: 10},
+	}
+
+	// Expires on Saturday, paid on Monday without charges
+	due, err := rules.AmountDueOn(c, 10000, "2024-11-16", "2024-11-18")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due.Total != 10000 {
+		t.Errorf("AmountDueOn next business day = %+v, expected no charges", due)
+	}
+
+	// Paid on Tuesday, interest accrues from Saturday
+	due, err = rules.AmountDueOn(c, 10000, "2024-11-16", "2024-11-19")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due.DaysLate != 3 || due.Total != 10000+200+30 {
+		t.Errorf("AmountDueOn after the due date = %+v, expected 3 days late", due)
+	}
+}
@@ -0,0 +1,396 @@
+package cnab
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
+// Format is the record length of a CNAB file
+type Format int
+
+const (
+	Format240 Format = 240
+	Format400 Format = 400
+)
+
+var (
+	ErrLineLength  = errors.New("invalid line length")
+	ErrRecordOrder = errors.New("unexpected record")
+	ErrNotNumeric  = errors.New("numeric field has non digit characters")
+	ErrOverflow    = errors.New("value doesn't fit the field")
+	ErrCount       = errors.New("record count doesn't match")
+	ErrInvalidDate = errors.New("invalid date")
+	ErrUnsupported = errors.New("unsupported value")
+)
+
+// LineError reports a problem found in a line of a CNAB file
+type LineError struct {
+	Line  int
+	Field string
+	Err   error
+}
+
+func (e *LineError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %s: %v", e.Line, e.Field, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorList holds every error found in a file, in line order
+type ErrorList []*LineError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", l[0], len(l)-1)
+}
+
+// Is reports whether any error of the list matches target
+func (l ErrorList) Is(target error) bool {
+	for _, e := range l {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *ErrorList) add(line int, field string, err error) {
+	*l = append(*l, &LineError{Line: line, Field: field, Err: err})
+}
+
+// err returns the list sorted by line, or nil when empty
+func (l ErrorList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	sort.SliceStable(l, func(i, j int) bool { return l[i].Line < l[j].Line })
+	return l
+}
+
+// Company is the beneficiary that exchanges files with the bank
+type Company struct {
+	Document     string
+	Name         string
+	Agreement    string
+	Agency       string
+	AgencyDigit  string
+	Account      string
+	AccountDigit string
+}
+
+// Header holds what is common to remittance and return files
+type Header struct {
+	Format    Format
+	BankCode  string
+	BankName  string
+	Company   Company
+	Sequence  int
+	CreatedAt time.Time
+}
+
+// field is a fixed width field, with positions as given in the bank
+// manuals: 1-based and inclusive.
+type field struct {
+	name    string
+	start   int
+	end     int
+	numeric bool
+}
+
+func num(name string, start, end int) field   { return field{name, start, end, true} }
+func alpha(name string, start, end int) field { return field{name, start, end, false} }
+
+func (f field) width() int {
+	return f.end - f.start + 1
+}
+
+// record builds a line, collecting errors for its line number
+type record struct {
+	data []byte
+	line int
+	errs *ErrorList
+}
+
+func (r *record) put(f field, v string) {
+	if f.numeric {
+		if v != "" && !validation.IsDigits(v) {
+			r.errs.add(r.line, f.name, ErrNotNumeric)
+			return
+		}
+		if len(v) > f.width() {
+			r.errs.add(r.line, f.name, ErrOverflow)
+			return
+		}
+		v = strings.Repeat("0", f.width()-len(v)) + v
+	} else {
+		v = toAlpha(v)
+		if len(v) > f.width() {
+			v = v[:f.width()]
+		}
+		v += strings.Repeat(" ", f.width()-len(v))
+	}
+	copy(r.data[f.start-1:f.end], v)
+}
+
+func (r *record) putInt(f field, n int) {
+	if n < 0 {
+		r.errs.add(r.line, f.name, ErrOverflow)
+		return
+	}
+	r.put(f, strconv.Itoa(n))
+}
+
+// putAmount writes cents, or hundredths of a percent
+func (r *record) putAmount(f field, v float64) {
+	if v < 0 {
+		r.errs.add(r.line, f.name, ErrOverflow)
+		return
+	}
+	r.put(f, strconv.FormatFloat(v, 'f', 0, 64))
+}
+
+func (r *record) putDate(f field, d types.Date) {
+	if d.IsZero() {
+		r.put(f, "")
+		return
+	}
+	t, err := d.Time()
+	if err != nil {
+		r.errs.add(r.line, f.name, ErrInvalidDate)
+		return
+	}
+	if f.width() == 6 {
+		r.put(f, t.Format("020106"))
+		return
+	}
+	r.put(f, t.Format("02012006"))
+}
+
+// writer accumulates the lines of a file
+type writer struct {
+	size  int
+	lines []*record
+	errs  ErrorList
+}
+
+// record starts a line, with zeros in the numeric fields of layout and
+// spaces everywhere else
+func (w *writer) record(layout []field) *record {
+	r := &record{data: []byte(strings.Repeat(" ", w.size)), line: len(w.lines) + 1, errs: &w.errs}
+	for _, f := range layout {
+		if f.numeric {
+			copy(r.data[f.start-1:f.end], strings.Repeat("0", f.width()))
+		}
+	}
+	w.lines = append(w.lines, r)
+	return r
+}
+
+// flush writes every line terminated by CRLF, or the errors found
+func (w *writer) flush(out io.Writer) error {
+	if err := w.errs.err(); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(out)
+	for _, r := range w.lines {
+		bw.Write(r.data)
+		bw.WriteString("\r\n")
+	}
+	return bw.Flush()
+}
+
+// line is a line read from a file
+type line struct {
+	data string
+	num  int
+	errs *ErrorList
+}
+
+// check reports every numeric field of layout holding anything but digits
+func (l *line) check(layout []field) {
+	for _, f := range layout {
+		if f.numeric && !validation.IsDigits(l.raw(f)) {
+			l.errs.add(l.num, f.name, ErrNotNumeric)
+		}
+	}
+}
+
+func (l *line) raw(f field) string {
+	return l.data[f.start-1 : f.end]
+}
+
+func (l *line) text(f field) string {
+	return strings.TrimSpace(l.raw(f))
+}
+
+// digits returns a numeric field as is, or nothing when it holds anything
+// else, which check reports
+func (l *line) digits(f field) string {
+	v := l.raw(f)
+	if !validation.IsDigits(v) {
+		return ""
+	}
+	return v
+}
+
+func (l *line) number(f field) int {
+	n, _ := strconv.Atoi(l.digits(f))
+	return n
+}
+
+func (l *line) amount(f field) float64 {
+	n, _ := strconv.ParseFloat(l.digits(f), 64)
+	return n
+}
+
+// date reads DDMMAAAA or DDMMAA, where zeros mean no date
+func (l *line) date(f field) types.Date {
+	v := l.digits(f)
+	if v == "" || strings.Trim(v, "0") == "" {
+		return ""
+	}
+	layout := "02012006"
+	if f.width() == 6 {
+		layout = "020106"
+	}
+	t, err := time.Parse(layout, v)
+	if err != nil {
+		l.errs.add(l.num, f.name, ErrInvalidDate)
+		return ""
+	}
+	return types.NewDate(t)
+}
+
+// expect reports the field unless it holds want
+func (l *line) expect(f field, want string) bool {
+	if l.raw(f) != want {
+		l.errs.add(l.num, f.name, fmt.Errorf("%w: want %q, got %q", ErrRecordOrder, want, l.raw(f)))
+		return false
+	}
+	return true
+}
+
+// readLines splits a file in lines of the same length, which tells the
+// format apart. Both LF and CRLF endings are accepted.
+func readLines(r io.Reader) (Format, []*line, *ErrorList, error) {
+	errs := &ErrorList{}
+	var lines []*line
+	var format Format
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		data := strings.TrimRight(scanner.Text(), "\r")
+		if data == "" {
+			continue
+		}
+		if format == 0 {
+			format = Format(len(data))
+			if format != Format240 && format != Format400 {
+				return 0, nil, nil, &LineError{Line: n, Err: ErrLineLength}
+			}
+		}
+		if len(data) != int(format) {
+			errs.add(n, "", fmt.Errorf("%w: %d, want %d", ErrLineLength, len(data), format))
+			continue
+		}
+		lines = append(lines, &line{data: data, num: n, errs: errs})
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, nil, nil, err
+	}
+	if len(lines) == 0 {
+		return 0, nil, nil, errors.New("empty file")
+	}
+	return format, lines, errs, nil
+}
+
+// toAlpha upper cases s and drops accents, since alphanumeric fields only
+// take ASCII
+func toAlpha(s string) string {
+	s = strings.ToUpper(validation.FoldAccents(s))
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			r = ' '
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// documentType is the CNAB code of a CPF (1) or CNPJ (2)
+func documentType(doc string) string {
+	if validation.DocumentTypeOf(doc) == validation.DocumentTypeCPF {
+		return "1"
+	}
+	return "2"
+}
+
+// document trims the zero padding of a CPF or CNPJ
+func document(kind, doc string) string {
+	if kind == "1" && len(doc) > 11 {
+		return doc[len(doc)-11:]
+	}
+	if len(doc) > 14 {
+		return doc[len(doc)-14:]
+	}
+	return doc
+}
+
+// Species maps the species of titles (espécie do título) to invoice types.
+// Titles of other species are rejected.
+var Species = map[string]string{
+	"02": types.InvoiceTypeBillOfExchange,
+	"07": types.InvoiceTypeBillOfExchange,
+	"32": types.InvoiceTypeProposal,
+	"99": types.InvoiceTypeDeposit,
+}
+
+func speciesOf(invoiceType string) string {
+	switch invoiceType {
+	case types.InvoiceTypeBillOfExchange:
+		return "07"
+	case types.InvoiceTypeProposal:
+		return "32"
+	}
+	return "99"
+}
@@ -0,0 +1,746 @@
+package cnab
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// FEBRABAN CNAB 240 layout, version 10.7, for collection (cobrança) files.
+// Fields unused by invoices are kept blank or zeroed.
+
+const (
+	layout240Version    = "107"
+	layout240LotVersion = "060"
+
+	directionRemittance = "1"
+	directionReturn     = "2"
+
+	record240FileHeader  = "0"
+	record240LotHeader   = "1"
+	record240Detail      = "3"
+	record240LotTrailer  = "5"
+	record240FileTrailer = "9"
+
+	movementEntry  = "01"
+	currencyReal   = "09"
+	acceptNo       = "N"
+	noProtest      = "3"
+	writeOff       = "1"
+	noWriteOff     = "2"
+	walletSimple   = "1"
+	maxR240Message = 2
+)
+
+var (
+	c240Bank = num("bank_code", 1, 3)
+	c240Lot  = num("lot", 4, 7)
+	c240Type = num("record_type", 8, 8)
+
+	c240DocType      = num("document_type", 18, 18)
+	c240Doc          = num("document", 19, 32)
+	c240Agreement    = alpha("agreement", 33, 52)
+	c240Agency       = num("agency", 53, 57)
+	c240AgencyDigit  = alpha("agency_digit", 58, 58)
+	c240Account      = num("account", 59, 70)
+	c240AccountDigit = alpha("account_digit", 71, 71)
+	c240Company      = alpha("company_name", 73, 102)
+	c240BankName     = alpha("bank_name", 103, 132)
+	c240Direction    = num("direction", 143, 143)
+	c240Date         = num("created_date", 144, 151)
+	c240Time         = num("created_time", 152, 157)
+	c240Sequence     = num("file_sequence", 158, 163)
+	c240Version      = num("layout_version", 164, 166)
+	c240Density      = num("density", 167, 171)
+
+	fileHeader240 = []field{c240Bank, c240Lot, c240Type, c240DocType, c240Doc, c240Agreement,
+		c240Agency, c240AgencyDigit, c240Account, c240AccountDigit, c240Company, c240BankName,
+		c240Direction, c240Date, c240Time, c240Sequence, c240Version, c240Density}
+
+	l240Operation    = alpha("operation", 9, 9)
+	l240Service      = num("service", 10, 11)
+	l240Version      = num("layout_version", 14, 16)
+	l240DocType      = num("document_type", 18, 18)
+	l240Doc          = num("document", 19, 33)
+	l240Agreement    = alpha("agreement", 34, 53)
+	l240Agency       = num("agency", 54, 58)
+	l240AgencyDigit  = alpha("agency_digit", 59, 59)
+	l240Account      = num("account", 60, 71)
+	l240AccountDigit = alpha("account_digit", 72, 72)
+	l240Company      = alpha("company_name", 74, 103)
+	l240Number       = num("remittance_number", 184, 191)
+	l240Date         = num("recorded_date", 192, 199)
+	l240CreditDate   = num("credit_date", 200, 207)
+
+	lotHeader240 = []field{c240Bank, c240Lot, c240Type, l240Operation, l240Service, l240Version,
+		l240DocType, l240Doc, l240Agreement, l240Agency, l240AgencyDigit, l240Account,
+		l240AccountDigit, l240Company, l240Number, l240Date, l240CreditDate}
+
+	d240Sequence     = num("sequence", 9, 13)
+	d240Segment      = alpha("segment", 14, 14)
+	d240Movement     = num("movement", 16, 17)
+	d240Agency       = num("agency", 18, 22)
+	d240AgencyDigit  = alpha("agency_digit", 23, 23)
+	d240Account      = num("account", 24, 35)
+	d240AccountDigit = alpha("account_digit", 36, 36)
+	d240OurNumber    = alpha("our_number", 38, 57)
+
+	p240Wallet        = num("wallet", 58, 58)
+	p240DocNumber     = alpha("document_number", 63, 77)
+	p240DueDate       = num("due_date", 78, 85)
+	p240Amount        = num("amount", 86, 100)
+	p240Collector     = num("collecting_agency", 101, 105)
+	p240Species       = num("species", 107, 108)
+	p240Accept        = alpha("accept", 109, 109)
+	p240IssueDate     = num("issue_date", 110, 117)
+	p240InterestCode  = num("interest_code", 118, 118)
+	p240InterestDate  = num("interest_date", 119, 126)
+	p240Interest      = num("interest", 127, 141)
+	p240DiscountCode  = num("discount_code", 142, 142)
+	p240DiscountDate  = num("discount_date", 143, 150)
+	p240Discount      = num("discount", 151, 165)
+	p240IOF           = num("iof", 166, 180)
+	p240Rebate        = num("rebate", 181, 195)
+	p240CompanyID     = alpha("company_id", 196, 220)
+	p240ProtestCode   = num("protest_code", 221, 221)
+	p240ProtestDays   = num("protest_days", 222, 223)
+	p240WriteOffCode  = num("write_off_code", 224, 224)
+	p240WriteOffDays  = num("write_off_days", 225, 227)
+	p240Currency      = num("currency", 228, 229)
+	p240Contract      = num("contract", 230, 239)
+	segmentP240Layout = []field{c240Bank, c240Lot, c240Type, d240Sequence, d240Segment, d240Movement,
+		d240Agency, d240AgencyDigit, d240Account, d240AccountDigit, d240OurNumber, p240Wallet,
+		p240DocNumber, p240DueDate, p240Amount, p240Collector, p240Species, p240Accept,
+		p240IssueDate, p240InterestCode, p240InterestDate, p240Interest, p240DiscountCode,
+		p240DiscountDate, p240Discount, p240IOF, p240Rebate, p240CompanyID, p240ProtestCode,
+		p240ProtestDays, p240WriteOffCode, p240WriteOffDays, p240Currency, p240Contract}
+
+	q240DocType       = num("payer_document_type", 18, 18)
+	q240Doc           = num("payer_document", 19, 33)
+	q240Name          = alpha("payer_name", 34, 73)
+	q240Address       = alpha("payer_address", 74, 113)
+	q240District      = alpha("payer_district", 114, 128)
+	q240ZipCode       = num("payer_zip_code", 129, 136)
+	q240City          = alpha("payer_city", 137, 151)
+	q240State         = alpha("payer_state", 152, 153)
+	q240GuarantorType = num("guarantor_document_type", 154, 154)
+	q240GuarantorDoc  = num("guarantor_document", 155, 169)
+	q240Guarantor     = alpha("guarantor_name", 170, 209)
+	q240Correspondent = num("correspondent_bank", 210, 212)
+	segmentQ240Layout = []field{c240Bank, c240Lot, c240Type, d240Sequence, d240Segment, d240Movement,
+		q240DocType, q240Doc, q240Name, q240Address, q240District, q240ZipCode, q240City,
+		q240State, q240GuarantorType, q240GuarantorDoc, q240Guarantor, q240Correspondent}
+
+	r240Discount2Code = num("discount2_code", 18, 18)
+	r240Discount2Date = num("discount2_date", 19, 26)
+	r240Discount2     = num("discount2", 27, 41)
+	r240Discount3Code = num("discount3_code", 42, 42)
+	r240Discount3Date = num("discount3_date", 43, 50)
+	r240Discount3     = num("discount3", 51, 65)
+	r240FineCode      = num("fine_code", 66, 66)
+	r240FineDate      = num("fine_date", 67, 74)
+	r240Fine          = num("fine", 75, 89)
+	r240Message3      = alpha("message3", 100, 139)
+	r240Message4      = alpha("message4", 140, 179)
+	segmentR240Layout = []field{c240Bank, c240Lot, c240Type, d240Sequence, d240Segment, d240Movement,
+		r240Discount2Code, r240Discount2Date, r240Discount2, r240Discount3Code, r240Discount3Date,
+		r240Discount3, r240FineCode, r240FineDate, r240Fine, r240Message3, r240Message4}
+
+	t240Wallet        = num("wallet", 58, 58)
+	t240DocNumber     = alpha("document_number", 59, 73)
+	t240DueDate       = num("due_date", 74, 81)
+	t240Amount        = num("amount", 82, 96)
+	t240Collector     = num("collecting_bank", 97, 99)
+	t240CollectorAg   = num("collecting_agency", 100, 104)
+	t240CompanyID     = alpha("company_id", 106, 130)
+	t240Currency      = num("currency", 131, 132)
+	t240PayerType     = num("payer_document_type", 133, 133)
+	t240PayerDoc      = num("payer_document", 134, 148)
+	t240PayerName     = alpha("payer_name", 149, 188)
+	t240Contract      = num("contract", 189, 198)
+	t240Fee           = num("fee", 199, 213)
+	t240Reasons       = alpha("reasons", 214, 223)
+	segmentT240Layout = []field{c240Bank, c240Lot, c240Type, d240Sequence, d240Segment, d240Movement,
+		d240Agency, d240AgencyDigit, d240Account, d240AccountDigit, d240OurNumber, t240Wallet,
+		t240DocNumber, t240DueDate, t240Amount, t240Collector, t240CollectorAg, t240CompanyID,
+		t240Currency, t240PayerType, t240PayerDoc, t240PayerName, t240Contract, t240Fee, t240Reasons}
+
+	u240Charges       = num("charges", 18, 32)
+	u240Discount      = num("discount", 33, 47)
+	u240Rebate        = num("rebate", 48, 62)
+	u240IOF           = num("iof", 63, 77)
+	u240Paid          = num("paid_amount", 78, 92)
+	u240Net           = num("net_amount", 93, 107)
+	u240Expenses      = num("expenses", 108, 122)
+	u240Credits       = num("other_credits", 123, 137)
+	u240OccurredAt    = num("occurrence_date", 138, 145)
+	u240CreditedAt    = num("credit_date", 146, 153)
+	segmentU240Layout = []field{c240Bank, c240Lot, c240Type, d240Sequence, d240Segment, d240Movement,
+		u240Charges, u240Discount, u240Rebate, u240IOF, u240Paid, u240Net, u240Expenses,
+		u240Credits, u240OccurredAt, u240CreditedAt}
+
+	t240Records     = num("record_count", 18, 23)
+	t240Titles      = num("title_count", 24, 29)
+	t240Total       = num("total_amount", 30, 46)
+	lotTrailer240   = []field{c240Bank, c240Lot, c240Type, t240Records, t240Titles, t240Total}
+	f240Lots        = num("lot_count", 18, 23)
+	f240Records     = num("record_count", 24, 29)
+	f240Accounts    = num("account_count", 30, 35)
+	fileTrailer240  = []field{c240Bank, c240Lot, c240Type, f240Lots, f240Records, f240Accounts}
+	segments240     = map[string][]field{"P": segmentP240Layout, "Q": segmentQ240Layout, "R": segmentR240Layout, "T": segmentT240Layout, "U": segmentU240Layout}
+	operations240   = map[string]string{directionRemittance: "R", directionReturn: "T"}
+	firstSegment240 = map[string]string{directionRemittance: "P", directionReturn: "T"}
+)
+
+// read240 checks the structure of a CNAB 240 file: a file header, lots of
+// detail records each between a lot header and trailer, and a file trailer.
+// The detail records of each title, starting with its first segment, are
+// passed to detail.
+func read240(lines []*line, direction string, detail func(group []*line)) Header {
+	head := lines[0]
+	if len(lines) < 2 {
+		head.errs.add(head.num, "", fmt.Errorf("%w: missing file trailer", ErrRecordOrder))
+		return Header{Format: Format240}
+	}
+	head.check(fileHeader240)
+	head.expect(c240Type, record240FileHeader)
+	head.expect(c240Lot, "0000")
+	head.expect(c240Direction, direction)
+
+	h := Header{
+		Format:   Format240,
+		BankCode: head.digits(c240Bank),
+		BankName: head.text(c240BankName),
+		Company: Company{
+			Document:     document(head.raw(c240DocType), head.digits(c240Doc)),
+			Name:         head.text(c240Company),
+			Agreement:    head.text(c240Agreement),
+			Agency:       strings.TrimLeft(head.digits(c240Agency), "0"),
+			AgencyDigit:  head.text(c240AgencyDigit),
+			Account:      strings.TrimLeft(head.digits(c240Account), "0"),
+			AccountDigit: head.text(c240AccountDigit),
+		},
+		Sequence: head.number(c240Sequence),
+	}
+	if t, err := time.Parse("02012006150405", head.digits(c240Date)+head.digits(c240Time)); err == nil {
+		h.CreatedAt = t
+	} else {
+		head.errs.add(head.num, c240Date.name, ErrInvalidDate)
+	}
+
+	var (
+		lots, lotRecords, sequence int
+		inLot                      bool
+		group                      []*line
+	)
+	flush := func() {
+		if len(group) > 0 {
+			detail(group)
+			group = nil
+		}
+	}
+
+	for _, l := range lines[1 : len(lines)-1] {
+		l.expect(c240Bank, h.BankCode)
+		lotRecords++
+
+		switch l.raw(c240Type) {
+		case record240LotHeader:
+			l.check(lotHeader240)
+			if inLot {
+				l.errs.add(l.num, "", fmt.Errorf("%w: lot header inside a lot", ErrRecordOrder))
+			}
+			lots++
+			inLot, lotRecords, sequence = true, 1, 0
+			l.expect(c240Lot, fmt.Sprintf("%04d", lots))
+			l.expect(l240Operation, operations240[direction])
+			l.expect(l240Service, "01")
+
+		case record240Detail:
+			if !inLot {
+				l.errs.add(l.num, "", fmt.Errorf("%w: detail outside a lot", ErrRecordOrder))
+				continue
+			}
+			sequence++
+			l.expect(c240Lot, fmt.Sprintf("%04d", lots))
+			l.expect(d240Sequence, fmt.Sprintf("%05d", sequence))
+
+			segment := l.raw(d240Segment)
+			layout, ok := segments240[segment]
+			if !ok || !strings.Contains(segmentsOf(direction), segment) {
+				l.errs.add(l.num, d240Segment.name, fmt.Errorf("%w: segment %q", ErrRecordOrder, segment))
+				continue
+			}
+			l.check(layout)
+			if segment == firstSegment240[direction] {
+				flush()
+			} else if len(group) == 0 {
+				l.errs.add(l.num, d240Segment.name, fmt.Errorf("%w: segment %s without %s", ErrRecordOrder, segment, firstSegment240[direction]))
+				continue
+			}
+			group = append(group, l)
+
+		case record240LotTrailer:
+			l.check(lotTrailer240)
+			flush()
+			if !inLot {
+				l.errs.add(l.num, "", fmt.Errorf("%w: lot trailer outside a lot", ErrRecordOrder))
+			}
+			l.expect(c240Lot, fmt.Sprintf("%04d", lots))
+			if l.number(t240Records) != lotRecords {
+				l.errs.add(l.num, t240Records.name, fmt.Errorf("%w: %d, want %d", ErrCount, l.number(t240Records), lotRecords))
+			}
+			inLot = false
+
+		default:
+			l.errs.add(l.num, c240Type.name, fmt.Errorf("%w: type %q", ErrRecordOrder, l.raw(c240Type)))
+		}
+	}
+
+	tail := lines[len(lines)-1]
+	if inLot {
+		tail.errs.add(tail.num, "", fmt.Errorf("%w: lot without trailer", ErrRecordOrder))
+	}
+	if tail.expect(c240Type, record240FileTrailer) {
+		tail.check(fileTrailer240)
+		tail.expect(c240Lot, "9999")
+		if tail.number(f240Lots) != lots {
+			tail.errs.add(tail.num, f240Lots.name, fmt.Errorf("%w: %d, want %d", ErrCount, tail.number(f240Lots), lots))
+		}
+		if tail.number(f240Records) != len(lines) {
+			tail.errs.add(tail.num, f240Records.name, fmt.Errorf("%w: %d, want %d", ErrCount, tail.number(f240Records), len(lines)))
+		}
+	}
+
+	return h
+}
+
+func segmentsOf(direction string) string {
+	if direction == directionReturn {
+		return "TU"
+	}
+	return "PQR"
+}
+
+func read240Remittance(lines []*line, accountID string) *Remittance {
+	rem := &Remittance{}
+	rem.Header = read240(lines, directionRemittance, func(group []*line) {
+		p := group[0]
+		title := Title{
+			Line:           p.num,
+			OurNumber:      p.text(d240OurNumber),
+			DocumentNumber: p.text(p240DocNumber),
+			CompanyID:      p.text(p240CompanyID),
+		}
+		title.Err = convert240(&title, group, accountID)
+		rem.Titles = append(rem.Titles, title)
+	})
+	return rem
+}
+
+// convert240 fills the invoice of a title from its segments
+func convert240(title *Title, group []*line, accountID string) error {
+	p := group[0]
+	var q, r *line
+	for _, l := range group[1:] {
+		switch {
+		case l.raw(d240Segment) == "Q" && q == nil && r == nil:
+			q = l
+		case l.raw(d240Segment) == "R" && q != nil && r == nil:
+			r = l
+		default:
+			return &LineError{Line: l.num, Field: d240Segment.name, Err: fmt.Errorf("%w: segment %s", ErrRecordOrder, l.raw(d240Segment))}
+		}
+	}
+	if q == nil {
+		return &LineError{Line: p.num, Err: fmt.Errorf("%w: segment P without Q", ErrRecordOrder)}
+	}
+
+	if movement := p.raw(d240Movement); movement != movementEntry {
+		return &LineError{Line: p.num, Field: d240Movement.name, Err: fmt.Errorf("%w: movement %s", ErrUnsupported, movement)}
+	}
+	if currency := p.raw(p240Currency); currency != currencyReal {
+		return &LineError{Line: p.num, Field: p240Currency.name, Err: fmt.Errorf("%w: currency %s", ErrUnsupported, currency)}
+	}
+	invoiceType, ok := Species[p.raw(p240Species)]
+	if !ok {
+		return &LineError{Line: p.num, Field: p240Species.name, Err: fmt.Errorf("%w: species %s", ErrUnsupported, p.raw(p240Species))}
+	}
+
+	expiration := p.date(p240DueDate)
+	in := &title.Input
+	*in = types.PaymentInvoiceInput{
+		AccountID:      accountID,
+		Currency:       defaultCurrency,
+		Amount:         p.amount(p240Amount),
+		ExpirationDate: string(expiration),
+		InvoiceType:    invoiceType,
+	}
+
+	if p.raw(p240WriteOffCode) == writeOff {
+		if days := p.number(p240WriteOffDays); days > 0 {
+			limit, err := expiration.AddDays(days)
+			if err != nil {
+				return &LineError{Line: p.num, Field: p240DueDate.name, Err: err}
+			}
+			in.LimitDate = string(limit)
+		}
+	}
+
+	if doc := q.digits(q240Doc); strings.Trim(doc, "0") != "" {
+		in.Payer.Document = document(q.raw(q240DocType), doc)
+	}
+	in.Payer.LegalName = q.text(q240Name)
+
+	interest, err := interestFor(p.raw(p240InterestCode), p.amount(p240Interest))
+	if err != nil {
+		return &LineError{Line: p.num, Field: p240InterestCode.name, Err: err}
+	}
+	in.Interest = interest
+
+	discounts := []discountFields{{p, p240DiscountCode, p240DiscountDate, p240Discount}}
+	if r != nil {
+		discounts = append(discounts,
+			discountFields{r, r240Discount2Code, r240Discount2Date, r240Discount2},
+			discountFields{r, r240Discount3Code, r240Discount3Date, r240Discount3})
+	}
+	for _, d := range discounts {
+		chargeType, value, ok, err := chargeFor(d.l.raw(d.code), d.l.amount(d.value))
+		if err != nil {
+			return &LineError{Line: d.l.num, Field: d.code.name, Err: err}
+		}
+		if ok {
+			in.Discounts = append(in.Discounts, types.InvoiceDiscount{Type: chargeType, Value: value, LimitDate: d.l.date(d.date)})
+		}
+	}
+
+	if r != nil {
+		chargeType, value, ok, err := chargeFor(r.raw(r240FineCode), r.amount(r240Fine))
+		if err != nil {
+			return &LineError{Line: r.num, Field: r240FineCode.name, Err: err}
+		}
+		if ok {
+			in.Fine = &types.InvoiceFine{Type: chargeType, Value: value}
+		}
+		for _, f := range []field{r240Message3, r240Message4} {
+			if msg := r.text(f); msg != "" {
+				in.Instructions = append(in.Instructions, msg)
+			}
+		}
+	}
+
+	return nil
+}
+
+// discountFields locates one discount tier of a title
+type discountFields struct {
+	l                 *line
+	code, date, value field
+}
+
+func read240Return(lines []*line) *Return {
+	ret := &Return{}
+	ret.Header = read240(lines, directionReturn, func(group []*line) {
+		t := group[0]
+		if len(group) != 2 || group[1].raw(d240Segment) != "U" {
+			t.errs.add(t.num, d240Segment.name, fmt.Errorf("%w: segment T must be followed by one U", ErrRecordOrder))
+			return
+		}
+		u := group[1]
+
+		item := ReturnItem{
+			Line:           t.num,
+			OurNumber:      t.text(d240OurNumber),
+			DocumentNumber: t.text(t240DocNumber),
+			CompanyID:      t.text(t240CompanyID),
+			Occurrence:     t.raw(d240Movement),
+			Reasons:        t.text(t240Reasons),
+			ExpirationDate: t.date(t240DueDate),
+			Amount:         t.amount(t240Amount),
+			PaidAmount:     u.amount(u240Paid),
+			Charges:        u.amount(u240Charges),
+			Discount:       u.amount(u240Discount),
+			OccurredAt:     u.date(u240OccurredAt),
+			CreditedAt:     u.date(u240CreditedAt),
+			PayerName:      t.text(t240PayerName),
+		}
+		if doc := t.digits(t240PayerDoc); strings.Trim(doc, "0") != "" {
+			item.PayerDocument = document(t.raw(t240PayerType), doc)
+		}
+		ret.Items = append(ret.Items, item)
+	})
+	return ret
+}
+
+// writer240 writes the records shared by remittance and return files
+type writer240 struct {
+	writer
+	h        *Header
+	lotLines int
+}
+
+func newWriter240(h *Header) *writer240 {
+	return &writer240{writer: writer{size: int(Format240)}, h: h}
+}
+
+func (w *writer240) fileHeader(direction string) {
+	c := w.h.Company
+	r := w.record(fileHeader240)
+	r.put(c240Bank, w.h.BankCode)
+	r.put(c240Lot, "0000")
+	r.put(c240Type, record240FileHeader)
+	r.put(c240DocType, documentType(c.Document))
+	r.put(c240Doc, c.Document)
+	r.put(c240Agreement, c.Agreement)
+	r.put(c240Agency, c.Agency)
+	r.put(c240AgencyDigit, c.AgencyDigit)
+	r.put(c240Account, c.Account)
+	r.put(c240AccountDigit, c.AccountDigit)
+	r.put(c240Company, c.Name)
+	r.put(c240BankName, w.h.BankName)
+	r.put(c240Direction, direction)
+	r.put(c240Date, w.h.CreatedAt.Format("02012006"))
+	r.put(c240Time, w.h.CreatedAt.Format("150405"))
+	r.putInt(c240Sequence, w.h.Sequence)
+	r.put(c240Version, layout240Version)
+
+	r = w.record(lotHeader240)
+	r.put(c240Bank, w.h.BankCode)
+	r.put(c240Lot, "0001")
+	r.put(c240Type, record240LotHeader)
+	r.put(l240Operation, operations240[direction])
+	r.put(l240Service, "01")
+	r.put(l240Version, layout240LotVersion)
+	r.put(l240DocType, documentType(c.Document))
+	r.put(l240Doc, c.Document)
+	r.put(l240Agreement, c.Agreement)
+	r.put(l240Agency, c.Agency)
+	r.put(l240AgencyDigit, c.AgencyDigit)
+	r.put(l240Account, c.Account)
+	r.put(l240AccountDigit, c.AccountDigit)
+	r.put(l240Company, c.Name)
+	r.putInt(l240Number, w.h.Sequence)
+	r.put(l240Date, w.h.CreatedAt.Format("02012006"))
+	w.lotLines = 1
+}
+
+// detail starts a detail record of segment in the single lot
+func (w *writer240) detail(segment, movement string) *record {
+	w.lotLines++
+	r := w.record(segments240[segment])
+	r.put(c240Bank, w.h.BankCode)
+	r.put(c240Lot, "0001")
+	r.put(c240Type, record240Detail)
+	r.putInt(d240Sequence, w.lotLines-1)
+	r.put(d240Segment, segment)
+	r.put(d240Movement, movement)
+	return r
+}
+
+func (w *writer240) account(r *record) {
+	r.put(d240Agency, w.h.Company.Agency)
+	r.put(d240AgencyDigit, w.h.Company.AgencyDigit)
+	r.put(d240Account, w.h.Company.Account)
+	r.put(d240AccountDigit, w.h.Company.AccountDigit)
+}
+
+func (w *writer240) trailers(titles int, total float64) {
+	r := w.record(lotTrailer240)
+	r.put(c240Bank, w.h.BankCode)
+	r.put(c240Lot, "0001")
+	r.put(c240Type, record240LotTrailer)
+	r.putInt(t240Records, w.lotLines+1)
+	r.putInt(t240Titles, titles)
+	r.putAmount(t240Total, total)
+
+	r = w.record(fileTrailer240)
+	r.put(c240Bank, w.h.BankCode)
+	r.put(c240Lot, "9999")
+	r.put(c240Type, record240FileTrailer)
+	r.putInt(f240Lots, 1)
+	r.putInt(f240Records, len(w.lines))
+}
+
+func write240Remittance(out io.Writer, rem *Remittance) error {
+	w := newWriter240(&rem.Header)
+	w.fileHeader(directionRemittance)
+
+	var total float64
+	for _, title := range rem.Titles {
+		in := title.Input
+		total += in.Amount
+		expiration := types.Date(in.ExpirationDate)
+
+		p := w.detail("P", movementEntry)
+		w.account(p)
+		p.put(d240OurNumber, title.OurNumber)
+		p.put(p240Wallet, walletSimple)
+		p.put(p240DocNumber, title.DocumentNumber)
+		p.putDate(p240DueDate, expiration)
+		p.putAmount(p240Amount, in.Amount)
+		p.put(p240Species, speciesOf(in.InvoiceType))
+		p.put(p240Accept, acceptNo)
+		p.putDate(p240IssueDate, types.NewDate(rem.CreatedAt))
+
+		code, value := interestCode(in.Interest)
+		p.put(p240InterestCode, code)
+		p.putAmount(p240Interest, value)
+		if in.Interest != nil {
+			p.putDate(p240InterestDate, dayAfter(expiration))
+		}
+
+		discounts := sortedDiscounts(in.Discounts)
+		if len(discounts) > 0 {
+			code, value := chargeCode(discounts[0].Type, discounts[0].Value)
+			p.put(p240DiscountCode, code)
+			p.putDate(p240DiscountDate, discounts[0].LimitDate)
+			p.putAmount(p240Discount, value)
+		}
+
+		p.put(p240CompanyID, title.CompanyID)
+		p.put(p240ProtestCode, noProtest)
+		p.put(p240WriteOffCode, noWriteOff)
+		if days := daysBetween(expiration, types.Date(in.LimitDate)); days > 0 {
+			p.put(p240WriteOffCode, writeOff)
+			p.putInt(p240WriteOffDays, days)
+		}
+		p.put(p240Currency, currencyReal)
+
+		q := w.detail("Q", movementEntry)
+		if in.Payer.Document != "" {
+			q.put(q240DocType, documentType(in.Payer.Document))
+			q.put(q240Doc, in.Payer.Document)
+		}
+		q.put(q240Name, in.Payer.LegalName)
+
+		if len(discounts) > 1 || in.Fine != nil || len(in.Instructions) > 0 {
+			r := w.detail("R", movementEntry)
+			for i, f := range [][3]field{
+				{r240Discount2Code, r240Discount2Date, r240Discount2},
+				{r240Discount3Code, r240Discount3Date, r240Discount3},
+			} {
+				if len(discounts) > i+1 {
+					d := discounts[i+1]
+					code, value := chargeCode(d.Type, d.Value)
+					r.put(f[0], code)
+					r.putDate(f[1], d.LimitDate)
+					r.putAmount(f[2], value)
+				}
+			}
+			if len(discounts) > 3 {
+				w.errs.add(p.line, p240Discount.name, fmt.Errorf("%w: at most 3 discounts", ErrOverflow))
+			}
+
+			if in.Fine != nil {
+				code, value := chargeCode(in.Fine.Type, in.Fine.Value)
+				r.put(r240FineCode, code)
+				r.putDate(r240FineDate, dayAfter(expiration))
+				r.putAmount(r240Fine, value)
+			}
+
+			if len(in.Instructions) > maxR240Message {
+				w.errs.add(r.line, r240Message3.name, fmt.Errorf("%w: at most %d instructions", ErrOverflow, maxR240Message))
+			}
+			for i, f := range []field{r240Message3, r240Message4} {
+				if len(in.Instructions) > i {
+					r.put(f, in.Instructions[i])
+				}
+			}
+		}
+	}
+
+	w.trailers(len(rem.Titles), total)
+	return w.flush(out)
+}
+
+func write240Return(out io.Writer, ret *Return) error {
+	w := newWriter240(&ret.Header)
+	w.fileHeader(directionReturn)
+
+	var total float64
+	for _, item := range ret.Items {
+		total += item.PaidAmount
+
+		t := w.detail("T", item.Occurrence)
+		w.account(t)
+		t.put(d240OurNumber, item.OurNumber)
+		t.put(t240Wallet, walletSimple)
+		t.put(t240DocNumber, item.DocumentNumber)
+		t.putDate(t240DueDate, item.ExpirationDate)
+		t.putAmount(t240Amount, item.Amount)
+		t.put(t240Collector, ret.BankCode)
+		t.put(t240CompanyID, item.CompanyID)
+		t.put(t240Currency, currencyReal)
+		if item.PayerDocument != "" {
+			t.put(t240PayerType, documentType(item.PayerDocument))
+			t.put(t240PayerDoc, item.PayerDocument)
+		}
+		t.put(t240PayerName, item.PayerName)
+		t.put(t240Reasons, item.Reasons)
+
+		u := w.detail("U", item.Occurrence)
+		u.putAmount(u240Charges, item.Charges)
+		u.putAmount(u240Discount, item.Discount)
+		u.putAmount(u240Paid, item.PaidAmount)
+		u.putAmount(u240Net, item.PaidAmount)
+		u.putDate(u240OccurredAt, item.occurredAt(&ret.Header))
+		u.putDate(u240CreditedAt, item.CreditedAt)
+	}
+
+	w.trailers(len(ret.Items), total)
+	return w.flush(out)
+}
+
+func dayAfter(d types.Date) types.Date {
+	next, err := d.AddDays(1)
+	if err != nil {
+		return ""
+	}
+	return next
+}
+
+// daysBetween returns how many days to is after from, or zero
+func daysBetween(from, to types.Date) int {
+	f, err := from.Time()
+	if err != nil {
+		return 0
+	}
+	t, err := to.Time()
+	if err != nil || !t.After(f) {
+		return 0
+	}
+	return int(t.Sub(f).Hours() / 24)
+}
+
+func sortedDiscounts(discounts []types.InvoiceDiscount) []types.InvoiceDiscount {
+	sorted := append([]types.InvoiceDiscount{}, discounts...)
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j].LimitDate.Before(sorted[j-1].LimitDate); j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+	return sorted
+}
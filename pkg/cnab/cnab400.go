@@ -0,0 +1,405 @@
+package cnab
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// CNAB 400 collection layout. Banks differ in the detail record; this one
+// follows the common positions of the Bradesco layout, with the fine and
+// interest codes in the positions it leaves for bank use.
+
+const (
+	record400Header  = "0"
+	record400Detail  = "1"
+	record400Trailer = "9"
+)
+
+var (
+	c400Type     = num("record_type", 1, 1)
+	c400Sequence = num("sequence", 395, 400)
+
+	h400Direction   = num("direction", 2, 2)
+	h400Literal     = alpha("literal", 3, 9)
+	h400Service     = num("service", 10, 11)
+	h400ServiceName = alpha("service_name", 12, 26)
+	h400Agreement   = alpha("agreement", 27, 46)
+	h400Company     = alpha("company_name", 47, 76)
+	h400Bank        = num("bank_code", 77, 79)
+	h400BankName    = alpha("bank_name", 80, 94)
+	h400Date        = num("created_date", 95, 100)
+	h400FileSeq     = num("file_sequence", 111, 117)
+	header400       = []field{c400Type, h400Direction, h400Literal, h400Service, h400ServiceName,
+		h400Agreement, h400Company, h400Bank, h400BankName, h400Date, h400FileSeq, c400Sequence}
+
+	d400DocType      = num("document_type", 2, 3)
+	d400Doc          = num("document", 4, 17)
+	d400Agency       = num("agency", 18, 22)
+	d400Account      = num("account", 23, 34)
+	d400AccountDigit = alpha("account_digit", 35, 35)
+	d400CompanyID    = alpha("company_id", 38, 62)
+	d400OurNumber    = alpha("our_number", 63, 82)
+	d400Occurrence   = num("occurrence", 109, 110)
+
+	r400FineCode     = num("fine_code", 83, 83)
+	r400Fine         = num("fine", 84, 96)
+	r400InterestCode = num("interest_code", 97, 97)
+	r400DiscountCode = num("discount_code", 98, 98)
+	r400DocNumber    = alpha("document_number", 111, 120)
+	r400DueDate      = num("due_date", 121, 126)
+	r400Amount       = num("amount", 127, 139)
+	r400Bank         = num("collecting_bank", 140, 142)
+	r400Collector    = num("collecting_agency", 143, 147)
+	r400Species      = num("species", 148, 149)
+	r400Accept       = alpha("accept", 150, 150)
+	r400IssueDate    = num("issue_date", 151, 156)
+	r400Instructions = num("instructions", 157, 160)
+	r400Interest     = num("interest", 161, 173)
+	r400DiscountDate = num("discount_date", 174, 179)
+	r400Discount     = num("discount", 180, 192)
+	r400IOF          = num("iof", 193, 205)
+	r400Rebate       = num("rebate", 206, 218)
+	r400PayerType    = num("payer_document_type", 219, 220)
+	r400PayerDoc     = num("payer_document", 221, 234)
+	r400PayerName    = alpha("payer_name", 235, 274)
+	r400Address      = alpha("payer_address", 275, 314)
+	r400Message1     = alpha("message1", 315, 326)
+	r400ZipCode      = num("payer_zip_code", 327, 334)
+	r400Message2     = alpha("message2", 335, 394)
+	remittance400    = []field{c400Type, d400DocType, d400Doc, d400Agency, d400Account,
+		d400AccountDigit, d400CompanyID, d400OurNumber, r400FineCode, r400Fine, r400InterestCode,
+		r400DiscountCode, d400Occurrence, r400DocNumber, r400DueDate, r400Amount, r400Bank,
+		r400Collector, r400Species, r400Accept, r400IssueDate, r400Instructions, r400Interest,
+		r400DiscountDate, r400Discount, r400IOF, r400Rebate, r400PayerType, r400PayerDoc,
+		r400PayerName, r400Address, r400Message1, r400ZipCode, r400Message2, c400Sequence}
+
+	t400OccurredAt = num("occurrence_date", 111, 116)
+	t400DocNumber  = alpha("document_number", 117, 126)
+	t400DueDate    = num("due_date", 147, 152)
+	t400Amount     = num("amount", 153, 165)
+	t400Bank       = num("collecting_bank", 166, 168)
+	t400Collector  = num("collecting_agency", 169, 173)
+	t400Species    = num("species", 174, 175)
+	t400Fee        = num("fee", 176, 188)
+	t400Expenses   = num("expenses", 189, 201)
+	t400LateOp     = num("late_interest", 202, 214)
+	t400IOF        = num("iof", 215, 227)
+	t400Rebate     = num("rebate", 228, 240)
+	t400Discount   = num("discount", 241, 253)
+	t400Paid       = num("paid_amount", 254, 266)
+	t400Charges    = num("charges", 267, 279)
+	t400Credits    = num("other_credits", 280, 292)
+	t400CreditedAt = num("credit_date", 296, 301)
+	t400Reasons    = alpha("reasons", 319, 328)
+	return400      = []field{c400Type, d400DocType, d400Doc, d400Agency, d400Account,
+		d400AccountDigit, d400CompanyID, d400OurNumber, d400Occurrence, t400OccurredAt,
+		t400DocNumber, t400DueDate, t400Amount, t400Bank, t400Collector, t400Species, t400Fee,
+		t400Expenses, t400LateOp, t400IOF, t400Rebate, t400Discount, t400Paid, t400Charges,
+		t400Credits, t400CreditedAt, t400Reasons, c400Sequence}
+
+	trailer400  = []field{c400Type, c400Sequence}
+	literals400 = map[string]string{directionRemittance: "REMESSA", directionReturn: "RETORNO"}
+)
+
+// read400 checks the structure of a CNAB 400 file: a header, detail records
+// and a trailer, numbered in sequence. Each detail record is passed to
+// detail.
+func read400(lines []*line, direction string, layout []field, detail func(l *line)) Header {
+	for i, l := range lines {
+		l.expect(c400Sequence, fmt.Sprintf("%06d", i+1))
+	}
+
+	head := lines[0]
+	head.check(header400)
+	head.expect(c400Type, record400Header)
+	head.expect(h400Direction, direction)
+	head.expect(h400Literal, literals400[direction])
+	head.expect(h400Service, "01")
+
+	h := Header{
+		Format:   Format400,
+		BankCode: head.digits(h400Bank),
+		BankName: head.text(h400BankName),
+		Company: Company{
+			Name:      head.text(h400Company),
+			Agreement: head.text(h400Agreement),
+		},
+		Sequence: head.number(h400FileSeq),
+	}
+	if t, err := time.Parse("020106", head.digits(h400Date)); err == nil {
+		h.CreatedAt = t
+	} else {
+		head.errs.add(head.num, h400Date.name, ErrInvalidDate)
+	}
+
+	if len(lines) < 2 {
+		head.errs.add(head.num, "", fmt.Errorf("%w: missing trailer", ErrRecordOrder))
+		return h
+	}
+
+	for i, l := range lines[1 : len(lines)-1] {
+		if !l.expect(c400Type, record400Detail) {
+			continue
+		}
+		l.check(layout)
+		if i == 0 {
+			h.Company.Document = document(strings.TrimPrefix(l.raw(d400DocType), "0"), l.digits(d400Doc))
+			h.Company.Agency = strings.TrimLeft(l.digits(d400Agency), "0")
+			h.Company.Account = strings.TrimLeft(l.digits(d400Account), "0")
+			h.Company.AccountDigit = l.text(d400AccountDigit)
+		}
+		detail(l)
+	}
+
+	tail := lines[len(lines)-1]
+	if tail.expect(c400Type, record400Trailer) {
+		tail.check(trailer400)
+	}
+
+	return h
+}
+
+func read400Remittance(lines []*line, accountID string) *Remittance {
+	rem := &Remittance{}
+	rem.Header = read400(lines, directionRemittance, remittance400, func(l *line) {
+		title := Title{
+			Line:           l.num,
+			OurNumber:      l.text(d400OurNumber),
+			DocumentNumber: l.text(r400DocNumber),
+			CompanyID:      l.text(d400CompanyID),
+		}
+		title.Err = convert400(&title, l, accountID)
+		rem.Titles = append(rem.Titles, title)
+	})
+	return rem
+}
+
+// convert400 fills the invoice of a title from its detail record
+func convert400(title *Title, l *line, accountID string) error {
+	if occurrence := l.raw(d400Occurrence); occurrence != movementEntry {
+		return &LineError{Line: l.num, Field: d400Occurrence.name, Err: fmt.Errorf("%w: occurrence %s", ErrUnsupported, occurrence)}
+	}
+	invoiceType, ok := Species[l.raw(r400Species)]
+	if !ok {
+		return &LineError{Line: l.num, Field: r400Species.name, Err: fmt.Errorf("%w: species %s", ErrUnsupported, l.raw(r400Species))}
+	}
+
+	in := &title.Input
+	*in = types.PaymentInvoiceInput{
+		AccountID:      accountID,
+		Currency:       defaultCurrency,
+		Amount:         l.amount(r400Amount),
+		ExpirationDate: string(l.date(r400DueDate)),
+		InvoiceType:    invoiceType,
+	}
+
+	if doc := l.digits(r400PayerDoc); strings.Trim(doc, "0") != "" {
+		in.Payer.Document = document(strings.TrimPrefix(l.raw(r400PayerType), "0"), doc)
+	}
+	in.Payer.LegalName = l.text(r400PayerName)
+
+	interest, err := interestFor(l.raw(r400InterestCode), l.amount(r400Interest))
+	if err != nil {
+		return &LineError{Line: l.num, Field: r400InterestCode.name, Err: err}
+	}
+	in.Interest = interest
+
+	chargeType, value, ok, err := chargeFor(l.raw(r400FineCode), l.amount(r400Fine))
+	if err != nil {
+		return &LineError{Line: l.num, Field: r400FineCode.name, Err: err}
+	}
+	if ok {
+		in.Fine = &types.InvoiceFine{Type: chargeType, Value: value}
+	}
+
+	chargeType, value, ok, err = chargeFor(l.raw(r400DiscountCode), l.amount(r400Discount))
+	if err != nil {
+		return &LineError{Line: l.num, Field: r400DiscountCode.name, Err: err}
+	}
+	if ok {
+		in.Discounts = []types.InvoiceDiscount{{Type: chargeType, Value: value, LimitDate: l.date(r400DiscountDate)}}
+	}
+
+	if msg := l.text(r400Message2); msg != "" {
+		in.Instructions = []string{msg}
+	}
+
+	return nil
+}
+
+func read400Return(lines []*line) *Return {
+	ret := &Return{}
+	ret.Header = read400(lines, directionReturn, return400, func(l *line) {
+		ret.Items = append(ret.Items, ReturnItem{
+			Line:           l.num,
+			OurNumber:      l.text(d400OurNumber),
+			DocumentNumber: l.text(t400DocNumber),
+			CompanyID:      l.text(d400CompanyID),
+			Occurrence:     l.raw(d400Occurrence),
+			Reasons:        l.text(t400Reasons),
+			ExpirationDate: l.date(t400DueDate),
+			Amount:         l.amount(t400Amount),
+			PaidAmount:     l.amount(t400Paid),
+			Charges:        l.amount(t400Charges),
+			Discount:       l.amount(t400Discount),
+			OccurredAt:     l.date(t400OccurredAt),
+			CreditedAt:     l.date(t400CreditedAt),
+		})
+	})
+	return ret
+}
+
+// writer400 writes the records shared by remittance and return files
+type writer400 struct {
+	writer
+	h *Header
+}
+
+func newWriter400(h *Header) *writer400 {
+	return &writer400{writer: writer{size: int(Format400)}, h: h}
+}
+
+func (w *writer400) record(layout []field) *record {
+	r := w.writer.record(layout)
+	r.putInt(c400Sequence, r.line)
+	return r
+}
+
+func (w *writer400) header(direction string) {
+	r := w.record(header400)
+	r.put(c400Type, record400Header)
+	r.put(h400Direction, direction)
+	r.put(h400Literal, literals400[direction])
+	r.put(h400Service, "01")
+	r.put(h400ServiceName, "COBRANCA")
+	r.put(h400Agreement, w.h.Company.Agreement)
+	r.put(h400Company, w.h.Company.Name)
+	r.put(h400Bank, w.h.BankCode)
+	r.put(h400BankName, w.h.BankName)
+	r.put(h400Date, w.h.CreatedAt.Format("020106"))
+	r.putInt(h400FileSeq, w.h.Sequence)
+}
+
+func (w *writer400) detail(layout []field, occurrence string) *record {
+	c := w.h.Company
+	r := w.record(layout)
+	r.put(c400Type, record400Detail)
+	r.put(d400DocType, "0"+documentType(c.Document))
+	r.put(d400Doc, c.Document)
+	r.put(d400Agency, c.Agency)
+	r.put(d400Account, c.Account)
+	r.put(d400AccountDigit, c.AccountDigit)
+	r.put(d400Occurrence, occurrence)
+	return r
+}
+
+func (w *writer400) trailer() {
+	r := w.record(trailer400)
+	r.put(c400Type, record400Trailer)
+}
+
+func write400Remittance(out io.Writer, rem *Remittance) error {
+	w := newWriter400(&rem.Header)
+	w.header(directionRemittance)
+
+	for _, title := range rem.Titles {
+		in := title.Input
+
+		r := w.detail(remittance400, movementEntry)
+		r.put(d400CompanyID, title.CompanyID)
+		r.put(d400OurNumber, title.OurNumber)
+		r.put(r400DocNumber, title.DocumentNumber)
+		r.putDate(r400DueDate, types.Date(in.ExpirationDate))
+		r.putAmount(r400Amount, in.Amount)
+		r.put(r400Species, speciesOf(in.InvoiceType))
+		r.put(r400Accept, acceptNo)
+		r.putDate(r400IssueDate, types.NewDate(rem.CreatedAt))
+
+		code, value := interestCode(in.Interest)
+		r.put(r400InterestCode, code)
+		r.putAmount(r400Interest, value)
+
+		if in.Fine != nil {
+			code, value := chargeCode(in.Fine.Type, in.Fine.Value)
+			r.put(r400FineCode, code)
+			r.putAmount(r400Fine, value)
+		}
+
+		switch len(in.Discounts) {
+		case 0:
+		case 1:
+			d := in.Discounts[0]
+			code, value := chargeCode(d.Type, d.Value)
+			r.put(r400DiscountCode, code)
+			r.putDate(r400DiscountDate, d.LimitDate)
+			r.putAmount(r400Discount, value)
+		default:
+			w.errs.add(r.line, r400Discount.name, fmt.Errorf("%w: at most 1 discount", ErrOverflow))
+		}
+
+		if in.Payer.Document != "" {
+			r.put(r400PayerType, "0"+documentType(in.Payer.Document))
+			r.put(r400PayerDoc, in.Payer.Document)
+		}
+		r.put(r400PayerName, in.Payer.LegalName)
+
+		switch len(in.Instructions) {
+		case 0:
+		case 1:
+			r.put(r400Message2, in.Instructions[0])
+		default:
+			w.errs.add(r.line, r400Message2.name, fmt.Errorf("%w: at most 1 instruction", ErrOverflow))
+		}
+	}
+
+	w.trailer()
+	return w.flush(out)
+}
+
+func write400Return(out io.Writer, ret *Return) error {
+	w := newWriter400(&ret.Header)
+	w.header(directionReturn)
+
+	for _, item := range ret.Items {
+		r := w.detail(return400, item.Occurrence)
+		r.put(d400CompanyID, item.CompanyID)
+		r.put(d400OurNumber, item.OurNumber)
+		r.putDate(t400OccurredAt, item.occurredAt(&ret.Header))
+		r.put(t400DocNumber, item.DocumentNumber)
+		r.putDate(t400DueDate, item.ExpirationDate)
+		r.putAmount(t400Amount, item.Amount)
+		r.put(t400Bank, ret.BankCode)
+		r.putAmount(t400Discount, item.Discount)
+		r.putAmount(t400Paid, item.PaidAmount)
+		r.putAmount(t400Charges, item.Charges)
+		r.putDate(t400CreditedAt, item.CreditedAt)
+		r.put(t400Reasons, item.Reasons)
+	}
+
+	w.trailer()
+	return w.flush(out)
+}
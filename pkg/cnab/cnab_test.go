@@ -0,0 +1,308 @@
+package cnab
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/engine"
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+const testAccountID = "8cbeb3d2-750f-4b14-81a1-143ad715c273"
+
+func testRemittance(format Format) *Remittance {
+	now := time.Now()
+	due := types.NewDate(now.AddDate(0, 1, 0))
+	early, _ := due.AddDays(-10)
+	limit, _ := due.AddDays(30)
+
+	rem := &Remittance{
+		Header: Header{
+			Format:    format,
+			BankCode:  "341",
+			BankName:  "BANCO ITAU SA",
+			Sequence:  12,
+			CreatedAt: time.Date(now.Year(), now.Month(), now.Day(), 10, 30, 0, 0, time.UTC),
+			Company: Company{
+				Document:     "11222333000181",
+				Name:         "ACME LTDA",
+				Agreement:    "123456",
+				Agency:       "2545",
+				Account:      "2366",
+				AccountDigit: "1",
+			},
+		},
+		Titles: []Title{{
+			OurNumber:      "00000001",
+			DocumentNumber: "NF-1",
+			CompanyID:      "ORDER-1",
+			Input: types.PaymentInvoiceInput{
+				AccountID:      testAccountID,
+				Currency:       "BRL",
+				Amount:         15050,
+				ExpirationDate: string(due),
+				LimitDate:      string(limit),
+				InvoiceType:    types.InvoiceTypeBillOfExchange,
+				Payer:          types.PaymentInvoicePayerInput{Document: "52998224725", LegalName: "MARIA SILVA"},
+				InvoiceRules: types.InvoiceRules{
+					Fine:         &types.InvoiceFine{Type: types.ChargeTypePercent, Value: 2},
+					Interest:     &types.InvoiceInterest{Type: types.InterestTypeMonthlyPercent, Value: 1},
+					Discounts:    []types.InvoiceDiscount{{Type: types.ChargeTypeFixed, Value: 500, LimitDate: early}},
+					Instructions: []string{"REFERENTE AO PEDIDO 1"},
+				},
+			},
+		}, {
+			OurNumber:      "00000002",
+			DocumentNumber: "NF-2",
+			Input: types.PaymentInvoiceInput{
+				AccountID:      testAccountID,
+				Currency:       "BRL",
+				Amount:         2000,
+				ExpirationDate: string(due),
+				LimitDate:      string(due),
+				InvoiceType:    types.InvoiceTypeDeposit,
+			},
+		}},
+	}
+	for i := range rem.Titles {
+		rem.Titles[i].Line = 3 + 3*i
+	}
+	return rem
+}
+
+func TestRemittanceRoundTrip(t *testing.T) {
+	for _, format := range []Format{Format240, Format400} {
+		t.Run(fmt.Sprint(format), func(t *testing.T) {
+			want := testRemittance(format)
+
+			var buf bytes.Buffer
+			if err := WriteRemittance(&buf, want); err != nil {
+				t.Fatalf("WriteRemittance returned error: %v", err)
+			}
+			for i, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+				if len(line) != int(format) {
+					t.Fatalf("line %d has %d characters", i+1, len(line))
+				}
+			}
+
+			got, err := ReadRemittance(&buf, testAccountID)
+			if err != nil {
+				t.Fatalf("ReadRemittance returned error: %v", err)
+			}
+			if errs := got.Errors(); len(errs) > 0 {
+				t.Fatalf("ReadRemittance titles have errors: %v", errs)
+			}
+
+			if format == Format400 {
+				// CNAB 400 has no agreement digits nor time of day
+				want.CreatedAt = want.CreatedAt.Truncate(24 * time.Hour)
+			}
+			if !reflect.DeepEqual(got.Header, want.Header) {
+				t.Errorf("ReadRemittance header = %+v, want %+v", got.Header, want.Header)
+			}
+			if len(got.Titles) != len(want.Titles) {
+				t.Fatalf("ReadRemittance returned %d titles", len(got.Titles))
+			}
+			for i := range want.Titles {
+				w := want.Titles[i]
+				if err := w.Input.Validate(); err != nil {
+					t.Fatal(err)
+				}
+				if format == Format400 {
+					w.Input.LimitDate = ""
+					w.Input.Validate()
+					w.Line = i + 2
+				}
+				if !reflect.DeepEqual(got.Titles[i], w) {
+					t.Errorf("ReadRemittance title %d = %+v, want %+v", i, got.Titles[i], w)
+				}
+			}
+		})
+	}
+}
+
+func TestReadRemittanceLayoutErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteRemittance(&buf, testRemittance(Format240)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\r\n")
+	lines[2] = lines[2][:85] + "00000000000A5050" + lines[2][101:]
+	lines = append(lines[:4], lines[5:]...)
+
+	_, err := ReadRemittance(strings.NewReader(strings.Join(lines, "\n")), testAccountID)
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("ReadRemittance returned %v, want an ErrorList", err)
+	}
+
+	found := map[string]bool{}
+	for _, e := range errs {
+		found[fmt.Sprintf("%d %s", e.Line, e.Field)] = true
+	}
+	for _, want := range []string{"3 amount", "5 sequence", "8 record_count"} {
+		if !found[want] {
+			t.Errorf("ReadRemittance errors %v don't include %s", errs, want)
+		}
+	}
+	if !errors.Is(err, ErrNotNumeric) {
+		t.Errorf("ReadRemittance error %v isn't ErrNotNumeric", err)
+	}
+}
+
+type fakeIssuer struct {
+	keys []string
+}
+
+func (f *fakeIssuer) PaymentInvoice(input types.PaymentInvoiceInput, key string) (*types.PaymentInvoice, *engine.Response, error) {
+	f.keys = append(f.keys, key)
+	if input.Amount == 2000 {
+		return nil, nil, errors.New("rejected")
+	}
+	return &types.PaymentInvoice{
+		ID:             "inv-1",
+		OurNumber:      "99",
+		Amount:         input.Amount,
+		ExpirationDate: input.ExpirationDate,
+		Status:         types.PaymentInvoiceStatusRegistered,
+	}, nil, nil
+}
+
+func TestIssueAndConfirm(t *testing.T) {
+	rem := testRemittance(Format240)
+	issuer := &fakeIssuer{}
+	results := rem.Issue(issuer)
+
+	if want := []string{"cnab-341-11222333000181-12-00000001", "cnab-341-11222333000181-12-00000002"}; !reflect.DeepEqual(issuer.keys, want) {
+		t.Errorf("Issue used keys %v, want %v", issuer.keys, want)
+	}
+	if results[0].Err != nil || results[0].Invoice == nil || results[1].Err == nil {
+		t.Fatalf("Issue returned %+v", results)
+	}
+
+	ret := rem.Confirmations(results)
+	var buf bytes.Buffer
+	if err := WriteReturn(&buf, ret); err != nil {
+		t.Fatalf("WriteReturn returned error: %v", err)
+	}
+	got, err := ReadReturn(&buf)
+	if err != nil {
+		t.Fatalf("ReadReturn returned error: %v", err)
+	}
+
+	if len(got.Items) != 2 {
+		t.Fatalf("ReadReturn returned %d items", len(got.Items))
+	}
+	if item := got.Items[0]; item.Occurrence != OccurrenceRegistered || item.OurNumber != "99" || item.CompanyID != "ORDER-1" || item.PayerDocument != "52998224725" {
+		t.Errorf("ReadReturn item 0 = %+v", item)
+	}
+	if item := got.Items[1]; item.Occurrence != OccurrenceRejected || item.DocumentNumber != "NF-2" {
+		t.Errorf("ReadReturn item 1 = %+v", item)
+	}
+}
+
+func TestRemittanceOurNumbers(t *testing.T) {
+	rem := testRemittance(Format400)
+	rem.Titles = append(rem.Titles, rem.Titles[0], rem.Titles[0])
+	rem.Titles[0].OurNumber = "00000000"
+	rem.Titles[1].OurNumber = "00000000"
+	rem.Titles[3].OurNumber = "00000001"
+	rem.Titles[2].OurNumber = "00000001"
+
+	var buf bytes.Buffer
+	if err := WriteRemittance(&buf, rem); err != nil {
+		t.Fatalf("WriteRemittance returned error: %v", err)
+	}
+	got, err := ReadRemittance(&buf, testAccountID)
+	if err != nil {
+		t.Fatalf("ReadRemittance returned error: %v", err)
+	}
+
+	errs := got.Errors()
+	if len(errs) != 1 || errs[0].Line != 5 || errs[0].Field != "our_number" {
+		t.Fatalf("ReadRemittance errors = %v, want the repeated our number on line 5", errs)
+	}
+
+	issuer := &fakeIssuer{}
+	got.Issue(issuer)
+	if want := []string{"cnab-341-11222333000181-12-line-2", "cnab-341-11222333000181-12-line-3", "cnab-341-11222333000181-12-00000001"}; !reflect.DeepEqual(issuer.keys, want) {
+		t.Errorf("Issue used keys %v, want %v", issuer.keys, want)
+	}
+}
+
+func TestReturnStatusChanges(t *testing.T) {
+	invoice := &types.PaymentInvoice{
+		OurNumber:      "99",
+		Amount:         10000,
+		ExpirationDate: "2026-01-20",
+		LimitDate:      "2026-02-20",
+		SettledAt:      "2026-02-19T10:00:00Z",
+		InvoiceRules: types.InvoiceRules{
+			Fine:     &types.InvoiceFine{Type: types.ChargeTypePercent, Value: 2},
+			Interest: &types.InvoiceInterest{Type: types.InterestTypeMonthlyPercent, Value: 1},
+		},
+	}
+
+	var items []ReturnItem
+	for _, status := range []string{types.PaymentInvoiceStatusPaid, types.PaymentInvoiceStatusCancelled, types.PaymentInvoiceStatusExpired} {
+		invoice.Status = status
+		item, err := NewReturnItem(invoice, "NF-1")
+		if err != nil {
+			t.Fatalf("NewReturnItem returned error: %v", err)
+		}
+		items = append(items, item)
+	}
+
+	invoice.Status = types.PaymentInvoiceStatusCreated
+	if _, err := NewReturnItem(invoice, "NF-1"); !errors.Is(err, ErrNoOccurrence) {
+		t.Errorf("NewReturnItem returned %v, want ErrNoOccurrence", err)
+	}
+
+	for _, format := range []Format{Format240, Format400} {
+		ret := &Return{Header: testRemittance(format).Header, Items: items}
+		var buf bytes.Buffer
+		if err := WriteReturn(&buf, ret); err != nil {
+			t.Fatalf("WriteReturn returned error: %v", err)
+		}
+		got, err := ReadReturn(&buf)
+		if err != nil {
+			t.Fatalf("ReadReturn returned error: %v", err)
+		}
+
+		paid := got.Items[0]
+		if paid.Occurrence != OccurrencePaid || paid.PaidAmount != 10300 || paid.Charges != 300 || paid.OccurredAt != "2026-02-19" {
+			t.Errorf("%d: paid item = %+v", format, paid)
+		}
+		if c := got.Items[1]; c.Occurrence != OccurrenceWrittenOff || c.Reasons != ReasonCancelledOnline || c.OccurredAt != types.NewDate(ret.CreatedAt) {
+			t.Errorf("%d: cancelled item = %+v", format, c)
+		}
+		if e := got.Items[2]; e.Occurrence != OccurrenceWrittenOff || e.Reasons != ReasonExpired || e.OccurredAt != "2026-02-20" {
+			t.Errorf("%d: expired item = %+v", format, e)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package cnab
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/engine"
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+const defaultCurrency = "BRL"
+
+// Remittance is a file of titles sent by the company to be registered
+type Remittance struct {
+	Header
+	Titles []Title
+}
+
+// Title is a single title of a remittance converted to an invoice. Err is
+// set, as a *LineError, when the title could not be converted or failed
+// validation.
+type Title struct {
+	Line           int
+	OurNumber      string
+	DocumentNumber string
+	// CompanyID is the company's own reference, echoed back in return files
+	CompanyID string
+	Input     types.PaymentInvoiceInput
+	Err       error
+}
+
+// InvoiceIssuer creates invoices. It is satisfied by
+// engine.PaymentInvoiceService.
+type InvoiceIssuer interface {
+	PaymentInvoice(input types.PaymentInvoiceInput, idempotencyKey string) (*types.PaymentInvoice, *engine.Response, error)
+}
+
+// IssueResult is the outcome of issuing one title
+type IssueResult struct {
+	Title   *Title
+	Invoice *types.PaymentInvoice
+	Err     error
+}
+
+// ReadRemittance reads a CNAB 240 or 400 remittance file, telling the
+// formats apart by line length. Titles become invoices of accountID. Layout
+// errors make the whole file invalid and are returned as an ErrorList;
+// titles that are well formed but invalid have their Err set instead.
+func ReadRemittance(r io.Reader, accountID string) (*Remittance, error) {
+	if strings.TrimSpace(accountID) == "" {
+		return nil, errors.New("account_id can't be empty")
+	}
+
+	format, lines, errs, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var rem *Remittance
+	if format == Format240 {
+		rem = read240Remittance(lines, accountID)
+	} else {
+		rem = read400Remittance(lines, accountID)
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]int{}
+	for i := range rem.Titles {
+		title := &rem.Titles[i]
+		if title.Err == nil {
+			if err := title.Input.Validate(); err != nil {
+				title.Err = &LineError{Line: title.Line, Err: err}
+			}
+		}
+
+		// A repeated our number would share its idempotency key
+		ref := ourNumberRef(title.OurNumber)
+		if ref == "" {
+			continue
+		}
+		if first, ok := seen[ref]; ok {
+			if title.Err == nil {
+				title.Err = &LineError{Line: title.Line, Field: "our_number", Err: fmt.Errorf("%s repeats line %d", ref, first)}
+			}
+			continue
+		}
+		seen[ref] = title.Line
+	}
+
+	return rem, nil
+}
+
+// WriteRemittance writes rem in its format. Nothing is written when a
+// value doesn't fit the layout; the problems are returned as an ErrorList.
+func WriteRemittance(w io.Writer, rem *Remittance) error {
+	switch rem.Format {
+	case Format240:
+		return write240Remittance(w, rem)
+	case Format400:
+		return write400Remittance(w, rem)
+	}
+	return fmt.Errorf("%w: format %d", ErrUnsupported, rem.Format)
+}
+
+// ID identifies the remittance among all files of the company
+func (r *Remittance) ID() string {
+	return fmt.Sprintf("cnab-%s-%s-%d", r.BankCode, r.Company.Document, r.Sequence)
+}
+
+// Inputs returns the invoices of the titles without errors, in order
+func (r *Remittance) Inputs() []types.PaymentInvoiceInput {
+	var inputs []types.PaymentInvoiceInput
+	for _, title := range r.Titles {
+		if title.Err == nil {
+			inputs = append(inputs, title.Input)
+		}
+	}
+	return inputs
+}
+
+// Errors returns the errors of every title
+func (r *Remittance) Errors() ErrorList {
+	var errs ErrorList
+	for _, title := range r.Titles {
+		var lineErr *LineError
+		if errors.As(title.Err, &lineErr) {
+			errs = append(errs, lineErr)
+		}
+	}
+	return errs
+}
+
+// Issue creates an invoice for every title without errors, one at a time.
+// Idempotency keys derive from the remittance ID and the our number of the
+// title, or its line when the our number is blank or zero filled, so issuing
+// the same file again doesn't duplicate invoices.
+func (r *Remittance) Issue(issuer InvoiceIssuer) []IssueResult {
+	results := make([]IssueResult, len(r.Titles))
+	for i := range r.Titles {
+		title := &r.Titles[i]
+		results[i].Title = title
+		if title.Err != nil {
+			results[i].Err = title.Err
+			continue
+		}
+
+		ref := ourNumberRef(title.OurNumber)
+		if ref == "" {
+			ref = fmt.Sprintf("line-%d", title.Line)
+		}
+		invoice, _, err := issuer.PaymentInvoice(title.Input, r.ID()+"-"+ref)
+		results[i].Invoice = invoice
+		results[i].Err = err
+	}
+	return results
+}
+
+// Confirmations builds the return file answering the remittance, with an
+// entry confirmation for every invoice issued and a rejection for every
+// title that failed.
+func (r *Remittance) Confirmations(results []IssueResult) *Return {
+	ret := &Return{Header: r.Header}
+	ret.CreatedAt = time.Now()
+
+	for _, result := range results {
+		title := result.Title
+		item := ReturnItem{
+			OurNumber:      title.OurNumber,
+			DocumentNumber: title.DocumentNumber,
+			CompanyID:      title.CompanyID,
+			Occurrence:     OccurrenceRejected,
+			ExpirationDate: types.Date(title.Input.ExpirationDate),
+			Amount:         title.Input.Amount,
+			PayerDocument:  title.Input.Payer.Document,
+			PayerName:      title.Input.Payer.LegalName,
+		}
+		if result.Err == nil && result.Invoice != nil {
+			item.Occurrence = OccurrenceRegistered
+			if result.Invoice.OurNumber != "" {
+				item.OurNumber = result.Invoice.OurNumber
+			}
+		}
+		ret.Items = append(ret.Items, item)
+	}
+
+	return ret
+}
+
+// ourNumberRef returns the our number of a title, or "" when the company
+// left it blank or zero filled for the bank to assign
+func ourNumberRef(ourNumber string) string {
+	ourNumber = strings.TrimSpace(ourNumber)
+	if strings.Trim(ourNumber, "0") == "" {
+		return ""
+	}
+	return ourNumber
+}
+
+// interestFor converts a CNAB interest code: 1 is an amount per day, 2 a
+// monthly rate and 0 or 3 exempt
+func interestFor(code string, value float64) (*types.InvoiceInterest, error) {
+	switch code {
+	case "", "0", "3":
+		return nil, nil
+	case "1":
+		return &types.InvoiceInterest{Type: types.InterestTypeDailyAmount, Value: value}, nil
+	case "2":
+		return &types.InvoiceInterest{Type: types.InterestTypeMonthlyPercent, Value: value / 100}, nil
+	}
+	return nil, fmt.Errorf("%w: interest code %s", ErrUnsupported, code)
+}
+
+func interestCode(i *types.InvoiceInterest) (string, float64) {
+	if i == nil {
+		return "3", 0
+	}
+	if i.Type == types.InterestTypeMonthlyPercent {
+		return "2", i.Value * 100
+	}
+	return "1", i.Value
+}
+
+// chargeFor converts CNAB fine and discount codes: 1 is a fixed amount, 2 a
+// percentage and 0 none
+func chargeFor(code string, value float64) (string, float64, bool, error) {
+	switch code {
+	case "", "0":
+		return "", 0, false, nil
+	case "1":
+		return types.ChargeTypeFixed, value, true, nil
+	case "2":
+		return types.ChargeTypePercent, value / 100, true, nil
+	}
+	return "", 0, false, fmt.Errorf("%w: code %s", ErrUnsupported, code)
+}
+
+func chargeCode(chargeType string, value float64) (string, float64) {
+	if chargeType == types.ChargeTypePercent {
+		return "2", value * 100
+	}
+	return "1", value
+}
@@ -0,0 +1,161 @@
+package cnab
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// Occurrence codes of return files
+const (
+	OccurrenceRegistered = "02"
+	OccurrenceRejected   = "03"
+	OccurrencePaid       = "06"
+	OccurrenceWrittenOff = "09"
+)
+
+// Reasons of OccurrenceWrittenOff
+const (
+	ReasonCancelledOnline = "11"
+	ReasonExpired         = "13"
+)
+
+// ErrNoOccurrence is returned for invoices whose status isn't reported in
+// return files
+var ErrNoOccurrence = errors.New("invoice status has no return occurrence")
+
+// Return is a file reporting what happened to titles
+type Return struct {
+	Header
+	Items []ReturnItem
+}
+
+// ReturnItem reports an occurrence of a title. Amounts are in cents.
+type ReturnItem struct {
+	Line           int
+	OurNumber      string
+	DocumentNumber string
+	CompanyID      string
+	Occurrence     string
+	Reasons        string
+	ExpirationDate types.Date
+	Amount         float64
+	PaidAmount     float64
+	// Charges are the fine and interest paid
+	Charges  float64
+	Discount float64
+	// OccurredAt defaults to the date of the file when writing
+	OccurredAt    types.Date
+	CreditedAt    types.Date
+	PayerDocument string
+	PayerName     string
+}
+
+// NewReturnItem reports the status of invoice: paid, cancelled, expired or
+// registered. documentNumber is the number the company gave the title.
+func NewReturnItem(invoice *types.PaymentInvoice, documentNumber string) (ReturnItem, error) {
+	item := ReturnItem{
+		OurNumber:      invoice.OurNumber,
+		DocumentNumber: documentNumber,
+		ExpirationDate: types.Date(invoice.ExpirationDate),
+		Amount:         invoice.Amount,
+		PayerDocument:  invoice.Payer.Document,
+		PayerName:      invoice.Payer.LegalName,
+	}
+
+	switch invoice.Status {
+	case types.PaymentInvoiceStatusRegistered:
+		item.Occurrence = OccurrenceRegistered
+	case types.PaymentInvoiceStatusPaid:
+		item.Occurrence = OccurrencePaid
+		item.PaidAmount = invoice.PaidAmount
+		if settled, err := types.BankDate(invoice.SettledAt); err == nil {
+			item.OccurredAt = settled
+			item.CreditedAt = item.OccurredAt
+
+			due, err := invoice.InvoiceRules.AmountDue(invoice.Amount, item.ExpirationDate, item.OccurredAt)
+			if err == nil {
+				item.Charges = due.Fine + due.Interest
+				item.Discount = due.Discount
+				if item.PaidAmount == 0 {
+					item.PaidAmount = due.Total
+				}
+			}
+		}
+		if item.PaidAmount == 0 {
+			item.PaidAmount = invoice.Amount
+		}
+	case types.PaymentInvoiceStatusCancelled:
+		item.Occurrence = OccurrenceWrittenOff
+		item.Reasons = ReasonCancelledOnline
+	case types.PaymentInvoiceStatusExpired:
+		item.Occurrence = OccurrenceWrittenOff
+		item.Reasons = ReasonExpired
+		item.OccurredAt = types.Date(invoice.LimitDate)
+	default:
+		return item, fmt.Errorf("%w: %s", ErrNoOccurrence, invoice.Status)
+	}
+
+	return item, nil
+}
+
+// ReadReturn reads a CNAB 240 or 400 return file. Layout errors are
+// returned as an ErrorList.
+func ReadReturn(r io.Reader) (*Return, error) {
+	format, lines, errs, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret *Return
+	if format == Format240 {
+		ret = read240Return(lines)
+	} else {
+		ret = read400Return(lines)
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// WriteReturn writes ret in its format. Nothing is written when a value
+// doesn't fit the layout; the problems are returned as an ErrorList.
+func WriteReturn(w io.Writer, ret *Return) error {
+	switch ret.Format {
+	case Format240:
+		return write240Return(w, ret)
+	case Format400:
+		return write400Return(w, ret)
+	}
+	return fmt.Errorf("%w: format %d", ErrUnsupported, ret.Format)
+}
+
+func (i *ReturnItem) occurredAt(h *Header) types.Date {
+	if i.OccurredAt.IsZero() {
+		return types.NewDate(h.CreatedAt)
+	}
+	return i.OccurredAt
+}
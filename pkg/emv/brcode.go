@@ -0,0 +1,340 @@
+package emv
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+const (
+	idPayloadFormat       = "00"
+	idPointOfInitiation   = "01"
+	idMerchantCategory    = "52"
+	idTransactionCurrency = "53"
+	idTransactionAmount   = "54"
+	idCountryCode         = "58"
+	idMerchantName        = "59"
+	idMerchantCity        = "60"
+	idPostalCode          = "61"
+	idAdditionalData      = "62"
+	idCRC                 = "63"
+
+	// sub ids of the merchant account information template
+	idGUI         = "00"
+	idKey         = "01"
+	idDescription = "02"
+	idURL         = "25"
+
+	// sub id of the additional data field template
+	idReferenceLabel = "05"
+
+	// GUI identifies UPI merchant account information templates
+	GUI = "in.gov.bcb.upi"
+	// pixGUI is accepted when decoding payloads issued for the Brazilian scheme
+	pixGUI = "br.gov.bcb.pix"
+
+	initiationStatic  = "11"
+	initiationDynamic = "12"
+
+	defaultMerchantCategory = "0000"
+	defaultCountryCode      = "BR"
+	// NoReferenceLabel is the transaction id of static codes that carry none
+	NoReferenceLabel = "***"
+
+	maxMerchantName   = 25
+	maxMerchantCity   = 15
+	maxReferenceLabel = 25
+	maxFieldLength    = 99
+)
+
+// currencies maps ISO 4217 numeric codes to the alphabetic codes used by the API
+var currencies = map[string]string{
+	"986": "BRL",
+	"356": "INR",
+	"840": "USD",
+	"978": "EUR",
+}
+
+// Payload is a decoded EMV merchant presented QR code (BR Code)
+type Payload struct {
+	PointOfInitiation string
+	Key               string
+	Description       string
+	URL               string
+	MerchantCategory  string
+	Currency          string
+	// Amount is in cents, zero when the payer chooses it
+	Amount         float64
+	CountryCode    string
+	MerchantName   string
+	MerchantCity   string
+	PostalCode     string
+	ReferenceLabel string
+
+	Fields Fields
+}
+
+// IsDynamic reports whether the payload points to a location holding the
+// charge instead of carrying the key itself.
+func (p *Payload) IsDynamic() bool {
+	return p.URL != "" || p.PointOfInitiation == initiationDynamic
+}
+
+// Decode parses payload, verifying its CRC and mandatory fields.
+func Decode(payload string) (*Payload, error) {
+	payload = strings.TrimSpace(payload)
+	if err := checkCRC(payload); err != nil {
+		return nil, err
+	}
+
+	fields, err := ParseFields(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, _ := fields.Get(idPayloadFormat); v != "01" {
+		return nil, errors.New("payload format indicator must be 01")
+	}
+
+	for _, id := range []string{idMerchantCategory, idTransactionCurrency, idCountryCode, idMerchantName, idMerchantCity} {
+		if v, _ := fields.Get(id); v == "" {
+			return nil, fmt.Errorf("mandatory data object %s is missing", id)
+		}
+	}
+
+	p := &Payload{Fields: fields}
+	p.PointOfInitiation, _ = fields.Get(idPointOfInitiation)
+	p.MerchantCategory, _ = fields.Get(idMerchantCategory)
+	p.CountryCode, _ = fields.Get(idCountryCode)
+	p.MerchantName, _ = fields.Get(idMerchantName)
+	p.MerchantCity, _ = fields.Get(idMerchantCity)
+	p.PostalCode, _ = fields.Get(idPostalCode)
+
+	if numeric, ok := fields.Get(idTransactionCurrency); ok {
+		p.Currency = currencies[numeric]
+		if p.Currency == "" {
+			p.Currency = numeric
+		}
+	}
+
+	if amount, ok := fields.Get(idTransactionAmount); ok {
+		if p.Amount, err = parseAmount(amount); err != nil {
+			return nil, err
+		}
+	}
+
+	account, err := merchantAccount(fields)
+	if err != nil {
+		return nil, err
+	}
+	p.Key, _ = account.Get(idKey)
+	p.Description, _ = account.Get(idDescription)
+	p.URL, _ = account.Get(idURL)
+	if p.Key == "" && p.URL == "" {
+		return nil, errors.New("merchant account information has neither key nor url")
+	}
+
+	if additional, ok := fields.Get(idAdditionalData); ok {
+		sub, err := ParseFields(additional)
+		if err != nil {
+			return nil, fmt.Errorf("additional data field: %w", err)
+		}
+		p.ReferenceLabel, _ = sub.Get(idReferenceLabel)
+	}
+
+	return p, nil
+}
+
+// merchantAccount finds the merchant account information template with a
+// known GUI among the EMV (26-51) and unreserved (80-99) templates.
+func merchantAccount(fields Fields) (Fields, error) {
+	for _, field := range fields {
+		id, _ := strconv.Atoi(field.ID)
+		if !(id >= 26 && id <= 51) && !(id >= 80 && id <= 99) {
+			continue
+		}
+
+		sub, err := ParseFields(field.Value)
+		if err != nil {
+			continue
+		}
+
+		if gui, _ := sub.Get(idGUI); strings.EqualFold(gui, GUI) || strings.EqualFold(gui, pixGUI) {
+			return sub, nil
+		}
+	}
+
+	return nil, errors.New("no UPI merchant account information found")
+}
+
+// QRCode converts the payload to the representation returned by
+// UpiService.GetQRCodeData. Dynamic payloads only carry what is in the QR
+// code; the charge itself must be fetched from its URL.
+func (p *Payload) QRCode() types.QRCode {
+	txnID := p.ReferenceLabel
+	if txnID == NoReferenceLabel {
+		txnID = ""
+	}
+
+	if p.IsDynamic() {
+		return types.QRCode{
+			Type: types.QRCodeTypeDynamic,
+			Dynamic: types.QRCodeDynamic{
+				Key:      p.Key,
+				TxnID:    txnID,
+				Currency: p.Currency,
+				Amount:   p.Amount,
+			},
+		}
+	}
+
+	return types.QRCode{
+		Type: types.QRCodeTypeStatic,
+		Static: types.QRCodeStatic{
+			Key:      p.Key,
+			TxnID:    txnID,
+			Currency: p.Currency,
+			Amount:   p.Amount,
+		},
+	}
+}
+
+// StaticInput holds the data of a static QR code
+type StaticInput struct {
+	Key string
+	// Amount in cents, zero lets the payer choose
+	Amount         float64
+	MerchantName   string
+	MerchantCity   string
+	PostalCode     string
+	TransactionID  string
+	AdditionalData []types.QRCodeAdditionalData
+}
+
+// EncodeStatic builds a static payload for input, ready to be rendered as a
+// QR code. Additional data is shown to the payer as the description.
+func EncodeStatic(input StaticInput) (string, error) {
+	key := strings.TrimSpace(input.Key)
+	if key == "" {
+		return "", errors.New("key can't be empty")
+	}
+
+	name := strings.TrimSpace(input.MerchantName)
+	if name == "" || len([]rune(name)) > maxMerchantName {
+		return "", fmt.Errorf("merchant name must have between 1 and %d characters", maxMerchantName)
+	}
+
+	city := strings.TrimSpace(input.MerchantCity)
+	if city == "" || len([]rune(city)) > maxMerchantCity {
+		return "", fmt.Errorf("merchant city must have between 1 and %d characters", maxMerchantCity)
+	}
+
+	txnID := strings.TrimSpace(input.TransactionID)
+	if txnID == "" {
+		txnID = NoReferenceLabel
+	} else if len(txnID) > maxReferenceLabel || !alphanumeric(txnID) {
+		return "", fmt.Errorf("transaction_id must be alphanumeric with up to %d characters", maxReferenceLabel)
+	}
+
+	if input.Amount < 0 {
+		return "", errors.New("amount can't be negative")
+	}
+
+	account := Fields{{ID: idGUI, Value: GUI}, {ID: idKey, Value: key}}
+	if description := describe(input.AdditionalData); description != "" {
+		account = append(account, Field{ID: idDescription, Value: description})
+	}
+	if len([]rune(account.String())) > maxFieldLength {
+		return "", errors.New("key and additional data don't fit in the merchant account information")
+	}
+
+	fields := Fields{
+		{ID: idPayloadFormat, Value: "01"},
+		{ID: "26", Value: account.String()},
+		{ID: idMerchantCategory, Value: defaultMerchantCategory},
+		{ID: idTransactionCurrency, Value: "986"},
+	}
+	if input.Amount > 0 {
+		fields = append(fields, Field{ID: idTransactionAmount, Value: formatAmount(input.Amount)})
+	}
+	fields = append(fields,
+		Field{ID: idCountryCode, Value: defaultCountryCode},
+		Field{ID: idMerchantName, Value: name},
+		Field{ID: idMerchantCity, Value: city},
+	)
+	if postalCode := strings.TrimSpace(input.PostalCode); postalCode != "" {
+		fields = append(fields, Field{ID: idPostalCode, Value: postalCode})
+	}
+	fields = append(fields, Field{ID: idAdditionalData, Value: Fields{{ID: idReferenceLabel, Value: txnID}}.String()})
+
+	return appendCRC(fields.String()), nil
+}
+
+func describe(data []types.QRCodeAdditionalData) string {
+	var parts []string
+	for _, d := range data {
+		name, value := strings.TrimSpace(d.Name), strings.TrimSpace(d.Value)
+		switch {
+		case name != "" && value != "":
+			parts = append(parts, name+": "+value)
+		case value != "":
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func alphanumeric(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9') && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAmount converts the decimal amount of field 54 to cents
+func parseAmount(s string) (float64, error) {
+	amount, ok := new(big.Rat).SetString(s)
+	if !ok || amount.Sign() < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	amount.Mul(amount, big.NewRat(100, 1))
+	if !amount.IsInt() {
+		return 0, fmt.Errorf("amount %q has more than 2 decimal places", s)
+	}
+
+	f, _ := amount.Float64()
+	return f, nil
+}
+
+// formatAmount renders cents as the decimal amount of field 54
+func formatAmount(cents float64) string {
+	c := int64(cents + 0.5)
+	return fmt.Sprintf("%d.%02d", c/100, c%100)
+}
@@ -0,0 +1,109 @@
+package emv
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestDecode(t *testing.T) {
+	payload := "00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-4266554400005204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***63041D3D"
+
+	p, err := Decode(payload)
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+
+	if p.Key != "123e4567-e12b-12d1-a456-426655440000" || p.MerchantName != "Fulano de Tal" ||
+		p.MerchantCity != "BRASILIA" || p.Currency != "BRL" || p.Amount != 0 || p.IsDynamic() {
+		t.Errorf("Decode returned %+v", p)
+	}
+
+	qr := p.QRCode()
+	if qr.Type != types.QRCodeTypeStatic || qr.Static.Key != p.Key || qr.Static.TxnID != "" {
+		t.Errorf("Payload.QRCode returned %+v", qr)
+	}
+
+	_, err = Decode(payload[:len(payload)-4] + "1D3E")
+	if !errors.Is(err, ErrInvalidCRC) {
+		t.Errorf("Decode returned error %v, expected %v", err, ErrInvalidCRC)
+	}
+}
+
+func TestEncodeStatic(t *testing.T) {
+	input := StaticInput{
+		Key:           "c1@bhojpur.net",
+		Amount:        1050,
+		MerchantName:  "Bhojpur Store",
+		MerchantCity:  "SAO PAULO",
+		TransactionID: "ORDER123",
+		AdditionalData: []types.QRCodeAdditionalData{
+			{Name: "Order", Value: "123"},
+		},
+	}
+
+	payload, err := EncodeStatic(input)
+	if err != nil {
+		t.Fatalf("EncodeStatic returned error: %v", err)
+	}
+
+	p, err := Decode(payload)
+	if err != nil {
+		t.Fatalf("Decode(EncodeStatic()) returned error: %v", err)
+	}
+
+	if p.Key != input.Key || p.Amount != 1050 || p.ReferenceLabel != "ORDER123" || p.Description != "Order: 123" {
+		t.Errorf("Decode(EncodeStatic()) returned %+v", p)
+	}
+
+	if amount, _ := p.Fields.Get("54"); amount != "10.50" {
+		t.Errorf("EncodeStatic amount field = %q, expected 10.50", amount)
+	}
+
+	if _, err := EncodeStatic(StaticInput{Key: "k", MerchantName: "Name", MerchantCity: "City", TransactionID: "not valid"}); err == nil {
+		t.Errorf("EncodeStatic accepted a non alphanumeric transaction id")
+	}
+}
+
+func TestDecodeCRCLookingLikeTag(t *testing.T) {
+	// The CRC of this payload is 6304, the same digits as the tag before it
+	payload := "00020126360014in.gov.bcb.upi0114c1@bhojpur.net5204000053039865802BR5913Bhojpur Store6009SAO PAULO62100506T5159263046304"
+
+	p, err := Decode(payload)
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	if p.ReferenceLabel != "T51592" {
+		t.Errorf("Decode returned reference label %q, expected T51592", p.ReferenceLabel)
+	}
+}
+
+func TestDecodeMandatoryFields(t *testing.T) {
+	// Merchant city (60) left out
+	payload := appendCRC("00020126360014in.gov.bcb.upi0114c1@bhojpur.net5204000053039865802BR5913Bhojpur Store")
+
+	if _, err := Decode(payload); err == nil {
+		t.Error("Decode expected error for a payload without merchant city")
+	}
+}
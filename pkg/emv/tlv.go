@@ -0,0 +1,131 @@
+package emv
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Field is a single ID, length, value data object of an EMV payload
+type Field struct {
+	ID    string
+	Value string
+}
+
+// Fields is an ordered list of data objects
+type Fields []Field
+
+// Get returns the value of the first field with id
+func (f Fields) Get(id string) (string, bool) {
+	for _, field := range f {
+		if field.ID == id {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// String encodes the fields as ID, two digit length and value. Lengths are
+// counted in characters.
+func (f Fields) String() string {
+	var b strings.Builder
+	for _, field := range f {
+		fmt.Fprintf(&b, "%s%02d%s", field.ID, len([]rune(field.Value)), field.Value)
+	}
+	return b.String()
+}
+
+// ParseFields splits s into data objects. It fails on truncated objects or
+// non numeric ids and lengths.
+func ParseFields(s string) (Fields, error) {
+	r := []rune(s)
+
+	var fields Fields
+	for i := 0; i < len(r); {
+		if len(r)-i < 4 {
+			return nil, fmt.Errorf("truncated data object at position %d", i)
+		}
+
+		id := string(r[i : i+2])
+		if _, err := strconv.Atoi(id); err != nil {
+			return nil, fmt.Errorf("invalid id %q at position %d", id, i)
+		}
+
+		length, err := strconv.Atoi(string(r[i+2 : i+4]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid length for id %s at position %d", id, i)
+		}
+
+		i += 4
+		if len(r)-i < length {
+			return nil, fmt.Errorf("data object %s is truncated", id)
+		}
+
+		fields = append(fields, Field{ID: id, Value: string(r[i : i+length])})
+		i += length
+	}
+
+	return fields, nil
+}
+
+// CRC16 computes the CRC-16/CCITT-FALSE checksum (polynomial 0x1021, initial
+// value 0xFFFF) used by EMV merchant presented QR codes.
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+var ErrInvalidCRC = errors.New("invalid crc")
+
+// checkCRC verifies the trailing 6304 data object of payload
+func checkCRC(payload string) error {
+	// The crc value may itself read 6304, so only the tag position counts
+	i := len(payload) - 8
+	if i < 0 || payload[i:i+4] != idCRC+"04" {
+		return errors.New("crc data object must be the last one")
+	}
+
+	expected := fmt.Sprintf("%04X", CRC16([]byte(payload[:i+4])))
+	if !strings.EqualFold(payload[i+4:], expected) {
+		return fmt.Errorf("%w: got %s, expected %s", ErrInvalidCRC, payload[i+4:], expected)
+	}
+
+	return nil
+}
+
+// appendCRC terminates payload with its 6304 data object
+func appendCRC(payload string) string {
+	payload += idCRC + "04"
+	return payload + fmt.Sprintf("%04X", CRC16([]byte(payload)))
+}
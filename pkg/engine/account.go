@@ -98,12 +98,40 @@ func (s *AccountService) GetBalance(id string) (*types.Balance, *Response, error
 
 //Get Account Statement
 func (s *AccountService) GetStatement(id string) ([]types.Statement, *Response, error) {
+	entries, _, resp, err := s.statementPage(id, "")
+	return entries, resp, err
+}
+
+// statementAll follows the cursor of a statement until the last page
+func (s *AccountService) statementAll(id string) ([]types.Statement, *Response, error) {
+	var all []types.Statement
+	after := ""
+	for {
+		entries, next, resp, err := s.statementPage(id, after)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, entries...)
+
+		if next == "" || next == after || len(entries) == 0 {
+			return all, resp, nil
+		}
+		after = next
+	}
+}
 
+func (s *AccountService) statementPage(id, after string) ([]types.Statement, string, *Response, error) {
 	path := fmt.Sprintf("/v1/accounts/%s/statement", id)
 
 	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", nil, err
+	}
+
+	if after != "" {
+		q := req.URL.Query()
+		q.Add("after", after)
+		req.URL.RawQuery = q.Encode()
 	}
 
 	var dataResp struct {
@@ -113,10 +141,15 @@ func (s *AccountService) GetStatement(id string) ([]types.Statement, *Response,
 
 	resp, err := s.client.Do(req, &dataResp)
 	if err != nil {
-		return nil, resp, err
+		return nil, "", resp, err
 	}
 
-	return dataResp.Data, resp, err
+	next := ""
+	if dataResp.Cursor.After != nil {
+		next = *dataResp.Cursor.After
+	}
+
+	return dataResp.Data, next, resp, err
 }
 
 // Get Statement Entry
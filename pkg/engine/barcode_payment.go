@@ -0,0 +1,387 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/boleto"
+	"github.com/bhojpur/bank/pkg/calendar"
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+var ErrNotCancellable = errors.New("payment can't be cancelled in its current status")
+
+// ErrPastCutOff is returned when a slip that is still due would be paid late
+// because the payment settles after the cut-off, on the next business day.
+var ErrPastCutOff = errors.New("payment settles after the slip's due date")
+
+// BarcodePaymentService handles communication with Bhojpur Bank API
+type BarcodePaymentService struct {
+	client *Client
+}
+
+// Details is a service used to retrieve the payee, amount, due date and
+// charges registered for a barcode or writable line
+func (s *BarcodePaymentService) Details(accountID, code string) (*types.BarcodeDetails, *Response, error) {
+	slip, err := boleto.Parse(code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path := fmt.Sprintf("/v1/barcode_payments/details/%s", slip.Barcode)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var details types.BarcodeDetails
+	resp, err := s.client.Do(req, &details)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &details, resp, err
+}
+
+// DryRun simulates a bill payment, returning it with the fee that would be
+// charged
+func (s *BarcodePaymentService) DryRun(input types.BarcodePaymentInput) (*types.BarcodePayment, *Response, error) {
+	return s.pay(input, "", "/v1/dry_run/barcode_payments")
+}
+
+// Pay pays a barcode or writable line, now or on input.ScheduledTo. A bank
+// slip that would still be on time is refused with ErrPastCutOff when the
+// bill payment cut-off moves its settlement past the due date.
+func (s *BarcodePaymentService) Pay(input types.BarcodePaymentInput, idempotencyKey string) (*types.BarcodePayment, *Response, error) {
+	if slip, err := boleto.Parse(input.Barcode); err == nil {
+		now := time.Now()
+		if due, ok := slip.DueDate(now); ok {
+			if err := s.checkCutOff(input.ScheduledTo, due, now); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return s.pay(input, idempotencyKey, "/v1/barcode_payments")
+}
+
+// checkCutOff refuses a payment requested on or before the due date that
+// the calendar settles after it
+func (s *BarcodePaymentService) checkCutOff(scheduledTo, due types.Date, now time.Time) error {
+	cal := s.client.calendar
+	due = cal.DueDate(due)
+
+	requested := scheduledTo
+	if today := types.NewDate(now.In(cal.Location())); requested.IsZero() || requested.Before(today) {
+		requested = today
+	}
+
+	effective, delayed := cal.Scheduled(calendar.OperationBarcodePayment, scheduledTo, now)
+	if delayed && !due.Before(requested) && due.Before(effective) {
+		return fmt.Errorf("%w: due %s, settles %s", ErrPastCutOff, due, effective)
+	}
+	return nil
+}
+
+// ScheduleForDueDate fetches the details of the slip and schedules its
+// payment for the due date, or pays it now when a payment made now settles
+// on the due date or the slip has none. A due date on a weekend or holiday
+// moves to the next business day, as the slip can still be paid then without
+// charges. A slip due today is refused with ErrPastCutOff after the bill
+// payment cut-off. The amount defaults to the amount due.
+func (s *BarcodePaymentService) ScheduleForDueDate(input types.BarcodePaymentInput, idempotencyKey string) (*types.BarcodePayment, *Response, error) {
+	details, resp, err := s.Details(input.AccountID, input.Barcode)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	cal := s.client.calendar
+	now := time.Now()
+	today := types.NewDate(now.In(cal.Location()))
+	dueDate := details.DueDate
+	if !dueDate.IsZero() {
+		dueDate = cal.DueDate(dueDate)
+	}
+	if !dueDate.IsZero() && dueDate.Before(today) {
+		return nil, resp, fmt.Errorf("slip was due on %s", details.DueDate)
+	}
+
+	settlement := cal.Settlement(calendar.OperationBarcodePayment, now)
+	if !dueDate.IsZero() && dueDate.Before(settlement) {
+		return nil, resp, fmt.Errorf("%w: due %s, settles %s", ErrPastCutOff, dueDate, settlement)
+	}
+
+	input.ScheduledTo = ""
+	if settlement.Before(dueDate) {
+		input.ScheduledTo = dueDate
+	}
+
+	if input.Amount == 0 {
+		input.Amount = details.OriginalAmount - details.DiscountAmount
+		if input.ScheduledTo.IsZero() {
+			input.Amount = details.Amount
+		}
+	}
+
+	return s.Pay(input, idempotencyKey)
+}
+
+func (s *BarcodePaymentService) pay(input types.BarcodePaymentInput, idempotencyKey, path string) (*types.BarcodePayment, *Response, error) {
+	if err := input.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	slip, err := boleto.Parse(input.Barcode)
+	if err != nil {
+		return nil, nil, err
+	}
+	input.Barcode = slip.Barcode
+
+	if input.Amount == 0 {
+		input.Amount = slip.Amount
+	}
+	if input.Amount <= 0 {
+		return nil, nil, errors.New("amount is required when the barcode has none")
+	}
+
+	if input.Currency == "" {
+		input.Currency = "BRL"
+	}
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var payment types.BarcodePayment
+	resp, err := s.client.Do(req, &payment)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &payment, resp, err
+}
+
+// Get is a service used to retrieve a bill payment
+func (s *BarcodePaymentService) Get(id string) (*types.BarcodePayment, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/barcode_payments/%s", id)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var payment types.BarcodePayment
+	resp, err := s.client.Do(req, &payment)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &payment, resp, err
+}
+
+// List returns the bill payments of an account
+func (s *BarcodePaymentService) List(accountID string) ([]types.BarcodePayment, *Response, error) {
+	if strings.TrimSpace(accountID) == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+
+	payments, _, resp, err := s.listPage(accountID, "")
+	return payments, resp, err
+}
+
+// listAll follows the cursor of the bill payment list until the last page
+func (s *BarcodePaymentService) listAll(accountID string) ([]types.BarcodePayment, *Response, error) {
+	if strings.TrimSpace(accountID) == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+
+	var all []types.BarcodePayment
+	after := ""
+	for {
+		payments, next, resp, err := s.listPage(accountID, after)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, payments...)
+
+		if next == "" || next == after || len(payments) == 0 {
+			return all, resp, nil
+		}
+		after = next
+	}
+}
+
+func (s *BarcodePaymentService) listPage(accountID, after string) ([]types.BarcodePayment, string, *Response, error) {
+	path := fmt.Sprintf("/v1/barcode_payments/?account_id=%s", accountID)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if after != "" {
+		q := req.URL.Query()
+		q.Add("after", after)
+		req.URL.RawQuery = q.Encode()
+	}
+
+	var dataResp struct {
+		Cursor types.Cursor           `json:"cursor"`
+		Data   []types.BarcodePayment `json:"data"`
+	}
+
+	resp, err := s.client.Do(req, &dataResp)
+	if err != nil {
+		return nil, "", resp, err
+	}
+
+	next := ""
+	if dataResp.Cursor.After != nil {
+		next = *dataResp.Cursor.After
+	}
+
+	return dataResp.Data, next, resp, err
+}
+
+// Cancel cancels a bill payment that was not processed yet. The status is
+// checked first so a payment already sent is reported with
+// ErrNotCancellable.
+func (s *BarcodePaymentService) Cancel(id string) (*Response, error) {
+	payment, resp, err := s.Get(id)
+	if err != nil {
+		return resp, err
+	}
+
+	if !types.BarcodePaymentStatus(payment.Status).Cancellable() {
+		return resp, fmt.Errorf("%w: %s", ErrNotCancellable, payment.Status)
+	}
+
+	path := fmt.Sprintf("/v1/barcode_payments/%s/cancel", id)
+
+	req, err := s.client.NewAPIRequest(http.MethodDelete, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.client.Do(req, nil)
+}
+
+// BarcodePaymentMatch pairs a settled bill payment with its statement entry
+type BarcodePaymentMatch struct {
+	Payment types.BarcodePayment
+	Entry   types.Statement
+	// AmountDiffers is set when the statement debited another amount
+	AmountDiffers bool
+}
+
+// BarcodePaymentReconciliation is the result of Reconcile
+type BarcodePaymentReconciliation struct {
+	Matched []BarcodePaymentMatch
+	// Missing holds settled payments without a statement entry
+	Missing []types.BarcodePayment
+	// Unmatched holds bill payment entries of the statement without a payment
+	Unmatched []types.Statement
+}
+
+// Reconcile matches the settled bill payments of an account with the
+// barcode_payment entries of its statement, by operation id or barcode. Both
+// lists are read to their last page.
+func (s *BarcodePaymentService) Reconcile(accountID string) (*BarcodePaymentReconciliation, *Response, error) {
+	payments, resp, err := s.listAll(accountID)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	statement, resp, err := s.client.Account.statementAll(accountID)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var entries []types.Statement
+	for _, e := range statement {
+		if e.Operation == types.StatementOperationBarcodePayment {
+			entries = append(entries, e)
+		}
+	}
+
+	used := make([]bool, len(entries))
+	result := &BarcodePaymentReconciliation{}
+
+	for _, p := range payments {
+		if types.BarcodePaymentStatus(p.Status) != types.BarcodePaymentStatusSettled {
+			continue
+		}
+
+		found := -1
+		for i, e := range entries {
+			if used[i] {
+				continue
+			}
+			if e.OperationID == p.ID || (e.OperationID == "" && e.Barcode != "" && e.Barcode == p.Barcode) {
+				found = i
+				break
+			}
+		}
+
+		if found < 0 {
+			result.Missing = append(result.Missing, p)
+			continue
+		}
+
+		used[found] = true
+		e := entries[found]
+		result.Matched = append(result.Matched, BarcodePaymentMatch{
+			Payment:       p,
+			Entry:         e,
+			AmountDiffers: math.Abs(e.Amount) != p.Amount,
+		})
+	}
+
+	for i, e := range entries {
+		if !used[i] {
+			result.Unmatched = append(result.Unmatched, e)
+		}
+	}
+
+	return result, resp, nil
+}
@@ -0,0 +1,206 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+const testWritableLine = "00190.50095 40144.816069 06809.350314 3 37370000000100"
+const testBarcode = "00193373700000001000500940144816060680935031"
+
+func TestBarcodePaymentDryRun(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/dry_run/barcode_payments", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+
+		var input types.BarcodePaymentInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		if input.Barcode != testBarcode || input.Amount != 100 {
+			t.Errorf("DryRun sent %+v, expected the barcode and amount of the slip", input)
+		}
+		fmt.Fprintf(w, `{"barcode": %q, "amount": 100, "fee": 250, "status": "CREATED"}`, input.Barcode)
+	})
+
+	payment, _, err := client.BarcodePayment.DryRun(types.BarcodePaymentInput{AccountID: "acc", Barcode: testWritableLine})
+	if err != nil {
+		t.Fatalf("barcodePayment.DryRun returned error: %v", err)
+	}
+
+	if payment.Fee != 250 {
+		t.Errorf("barcodePayment.DryRun returned fee %v, expected 250", payment.Fee)
+	}
+}
+
+func TestBarcodePaymentCancelSettled(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/barcode_payments/bp1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "bp1", "status": "SETTLED"}`)
+	})
+
+	if _, err := client.BarcodePayment.Cancel("bp1"); !errors.Is(err, ErrNotCancellable) {
+		t.Errorf("barcodePayment.Cancel returned error %v, expected %v", err, ErrNotCancellable)
+	}
+}
+
+func TestBarcodePaymentReconcile(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/barcode_payments/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [
+			{"id": "bp1", "amount": 100, "status": "SETTLED"},
+			{"id": "bp2", "amount": 200, "status": "SETTLED"},
+			{"id": "bp3", "amount": 300, "status": "SCHEDULED"}
+		]}`)
+	})
+	mux.HandleFunc("/v1/accounts/acc/statement", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [
+			{"id": "e1", "operation": "barcode_payment", "operation_id": "bp1", "amount": -100},
+			{"id": "e2", "operation": "barcode_payment", "operation_id": "bp9", "amount": -900},
+			{"id": "e3", "operation": "internal_transfer", "operation_id": "tr1", "amount": -50}
+		]}`)
+	})
+
+	result, _, err := client.BarcodePayment.Reconcile("acc")
+	if err != nil {
+		t.Fatalf("barcodePayment.Reconcile returned error: %v", err)
+	}
+
+	if len(result.Matched) != 1 || result.Matched[0].Entry.ID != "e1" || result.Matched[0].AmountDiffers {
+		t.Errorf("Reconcile matched %+v, expected bp1 with e1", result.Matched)
+	}
+	if len(result.Missing) != 1 || result.Missing[0].ID != "bp2" {
+		t.Errorf("Reconcile missing %+v, expected bp2", result.Missing)
+	}
+	if len(result.Unmatched) != 1 || result.Unmatched[0].ID != "e2" {
+		t.Errorf("Reconcile unmatched %+v, expected e2", result.Unmatched)
+	}
+}
+
+func TestBarcodePaymentScheduleForDueDateOnWeekend(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// The next saturday, which can still be paid on the following business day
+	today := time.Now().In(client.Calendar().Location())
+	saturday := types.NewDate(today.AddDate(0, 0, int(time.Saturday-today.Weekday())+7))
+	want := client.Calendar().DueDate(saturday)
+
+	mux.HandleFunc("/v1/barcode_payments/details/"+testBarcode, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"barcode": %q, "due_date": %q, "original_amount": 100, "amount": 100}`, testBarcode, saturday)
+	})
+	mux.HandleFunc("/v1/barcode_payments", func(w http.ResponseWriter, r *http.Request) {
+		var input types.BarcodePaymentInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		if input.ScheduledTo != want {
+			t.Errorf("ScheduleForDueDate scheduled to %s, expected %s", input.ScheduledTo, want)
+		}
+		fmt.Fprintf(w, `{"barcode": %q, "amount": 100, "scheduled_to": %q, "status": "SCHEDULED"}`, input.Barcode, input.ScheduledTo)
+	})
+
+	if _, _, err := client.BarcodePayment.ScheduleForDueDate(types.BarcodePaymentInput{AccountID: "acc", Barcode: testWritableLine}, "key"); err != nil {
+		t.Fatalf("barcodePayment.ScheduleForDueDate returned error: %v", err)
+	}
+}
+
+func TestBarcodePaymentCutOff(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Tuesday, before and after the 20:00 cut-off
+	before := time.Date(2026, 3, 10, 19, 0, 0, 0, types.BankLocation)
+	after := time.Date(2026, 3, 10, 20, 30, 0, 0, types.BankLocation)
+
+	checks := []struct {
+		name        string
+		scheduledTo types.Date
+		due         types.Date
+		now         time.Time
+		late        bool
+	}{
+		{"due today before the cut-off", "", "2026-03-10", before, false},
+		{"due today after the cut-off", "", "2026-03-10", after, true},
+		{"scheduled to today after the cut-off", "2026-03-10", "2026-03-10", after, true},
+		{"due tomorrow after the cut-off", "", "2026-03-11", after, false},
+		{"already overdue", "", "2026-03-09", after, false},
+		{"due on saturday", "2026-03-14", "2026-03-14", after, false},
+	}
+	for _, c := range checks {
+		err := client.BarcodePayment.checkCutOff(c.scheduledTo, c.due, c.now)
+		if errors.Is(err, ErrPastCutOff) != c.late {
+			t.Errorf("%s: checkCutOff returned %v, expected late %v", c.name, err, c.late)
+		}
+	}
+}
+
+func TestBarcodePaymentReconcilePages(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/barcode_payments/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("after") == "" {
+			fmt.Fprint(w, `{"cursor": {"after": "p2"}, "data": [{"id": "bp1", "amount": 100, "status": "SETTLED"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"cursor": {}, "data": [{"id": "bp2", "amount": 200, "status": "SETTLED"}]}`)
+	})
+	mux.HandleFunc("/v1/accounts/acc/statement", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("after") {
+		case "":
+			fmt.Fprint(w, `{"cursor": {"after": "s2"}, "data": [
+				{"id": "e2", "operation": "barcode_payment", "operation_id": "bp2", "amount": -200}
+			]}`)
+		case "s2":
+			fmt.Fprint(w, `{"cursor": {}, "data": [
+				{"id": "e1", "operation": "barcode_payment", "operation_id": "bp1", "amount": -100}
+			]}`)
+		default:
+			t.Errorf("GetStatement sent after=%s", r.URL.Query().Get("after"))
+		}
+	})
+
+	result, _, err := client.BarcodePayment.Reconcile("acc")
+	if err != nil {
+		t.Fatalf("barcodePayment.Reconcile returned error: %v", err)
+	}
+
+	if len(result.Matched) != 2 || len(result.Missing) != 0 || len(result.Unmatched) != 0 {
+		t.Errorf("Reconcile returned %+v, expected bp1 and bp2 matched across pages", result)
+	}
+}
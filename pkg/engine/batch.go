@@ -0,0 +1,257 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const batchKeySize = 40
+
+// ErrBatchLineSkipped is reported for lines left unprocessed because the batch
+// context was cancelled.
+var ErrBatchLineSkipped = errors.New("line not processed")
+
+// BatchCheckpoint records the lines of a batch that completed successfully,
+// so a batch interrupted by a crash can be resumed without repeating them.
+type BatchCheckpoint interface {
+	// Load returns the stored result of key, if any
+	Load(key string) (json.RawMessage, bool)
+	// Save stores the result of key
+	Save(key string, result json.RawMessage) error
+}
+
+// MemoryCheckpoint is a BatchCheckpoint kept in memory, useful for tests and
+// for resuming within the same process.
+type MemoryCheckpoint struct {
+	m       sync.Mutex
+	results map[string]json.RawMessage
+}
+
+func NewMemoryCheckpoint() *MemoryCheckpoint {
+	return &MemoryCheckpoint{results: make(map[string]json.RawMessage)}
+}
+
+func (c *MemoryCheckpoint) Load(key string) (json.RawMessage, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	result, ok := c.results[key]
+	return result, ok
+}
+
+func (c *MemoryCheckpoint) Save(key string, result json.RawMessage) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.results[key] = result
+	return nil
+}
+
+// FileCheckpoint is a BatchCheckpoint persisted as an append only JSON lines
+// file. Each Save is flushed to disk before returning.
+type FileCheckpoint struct {
+	MemoryCheckpoint
+	f *os.File
+}
+
+type checkpointEntry struct {
+	Key    string          `json:"key"`
+	Result json.RawMessage `json:"result"`
+}
+
+// OpenFileCheckpoint opens or creates the checkpoint file at path and loads
+// the results already recorded in it. A truncated last line, as left by a
+// crash in the middle of a write, is cut off so the next Save starts on a
+// line of its own.
+func OpenFileCheckpoint(path string) (*FileCheckpoint, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &FileCheckpoint{MemoryCheckpoint: *NewMemoryCheckpoint(), f: f}
+
+	// complete is the size of the file up to its last complete line
+	var complete int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		complete += int64(len(line))
+
+		var entry checkpointEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		c.results[entry.Key] = entry.Result
+	}
+
+	if err := f.Truncate(complete); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *FileCheckpoint) Save(key string, result json.RawMessage) error {
+	line, err := json.Marshal(checkpointEntry{Key: key, Result: result})
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if _, err := c.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := c.f.Sync(); err != nil {
+		return err
+	}
+	c.results[key] = result
+
+	return nil
+}
+
+func (c *FileCheckpoint) Close() error {
+	return c.f.Close()
+}
+
+// batchKey derives a deterministic idempotency key for a batch line. The line
+// content is part of the key, so a corrected line is sent as a new operation.
+func batchKey(batchID string, line int, input interface{}) (string, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00", batchID, line)
+	h.Write(data)
+
+	return hex.EncodeToString(h.Sum(nil))[:batchKeySize], nil
+}
+
+// rateLimiter spaces calls evenly so no more than rate calls start per second.
+type rateLimiter struct {
+	m        sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// Wait blocks until the next call is allowed. A nil limiter never blocks.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.m.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.m.Unlock()
+
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// runBatch calls fn for every index in [0, n) from at most concurrency
+// goroutines, respecting limiter. It stops dispatching when ctx is done and
+// returns ctx.Err() in that case.
+func runBatch(ctx context.Context, n, concurrency int, limiter *rateLimiter, fn func(i int)) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	var err error
+dispatch:
+	for i := 0; i < n; i++ {
+		if err = limiter.Wait(ctx); err != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break dispatch
+		case indexes <- i:
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return err
+}
+
+// errString keeps the message of err for reports, which are serialised.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
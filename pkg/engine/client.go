@@ -33,11 +33,13 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 
+	"github.com/bhojpur/bank/pkg/calendar"
 	"github.com/bhojpur/bank/pkg/types"
 )
 
@@ -77,6 +79,10 @@ type Client struct {
 
 	token oauth2.Token
 
+	keyLookupTTL time.Duration
+
+	calendar *calendar.Calendar
+
 	//Services used for comunicating with API
 	Institution    *InstitutionService
 	Account        *AccountService
@@ -85,6 +91,7 @@ type Client struct {
 	Upi            *UpiService
 	PaymentLink    *PaymentLinkService
 	Topups         *TopupsService
+	BarcodePayment *BarcodePaymentService
 }
 
 func NewClient(opts ...ClientOpt) (*Client, error) {
@@ -104,6 +111,10 @@ func NewClient(opts ...ClientOpt) (*Client, error) {
 
 	c.ApplyOpts(opts...)
 
+	if c.calendar == nil {
+		c.calendar = calendar.New()
+	}
+
 	if len(c.privateKeyData) > 0 {
 		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(c.privateKeyData)
 		if err != nil {
@@ -122,9 +133,10 @@ func NewClient(opts ...ClientOpt) (*Client, error) {
 	c.Institution = &InstitutionService{client: &c}
 	c.PaymentLink = &PaymentLinkService{client: &c}
 	c.PaymentInvoice = &PaymentInvoiceService{client: &c}
-	c.Upi = &UpiService{client: &c}
+	c.Upi = &UpiService{client: &c, keys: newKeyLookupCache(c.keyLookupTTL)}
 	c.Topups = &TopupsService{client: &c}
 	c.Transfer = &TransferService{client: &c}
+	c.BarcodePayment = &BarcodePaymentService{client: &c}
 
 	// Set log
 	log := logrus.New().WithFields(logrus.Fields{
@@ -208,6 +220,20 @@ func EnableDebug() ClientOpt {
 
 }
 
+// WithCalendar sets the business-day calendar used to predict settlement
+// dates, such as one with the local holidays of the account. Defaults to
+// calendar.New().
+func WithCalendar(cal *calendar.Calendar) ClientOpt {
+	return func(c *Client) {
+		c.calendar = cal
+	}
+}
+
+// Calendar returns the business-day calendar of the client
+func (c *Client) Calendar() *calendar.Calendar {
+	return c.calendar
+}
+
 func (c *Client) ApplyOpts(opts ...ClientOpt) {
 	if opts == nil {
 		return
@@ -67,6 +67,7 @@ func testClientServices(t *testing.T, c *Client) {
 		"Upi",
 		"Topups",
 		"Transfer",
+		"BarcodePayment",
 	}
 
 	cp := reflect.ValueOf(c)
@@ -0,0 +1,509 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bhojpur/bank/pkg/types"
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
+// defaultInstitutionTTL refreshes the directory once a day, as participants
+// change rarely
+const defaultInstitutionTTL = 24 * time.Hour
+
+// defaultInstitutionRetry is how long a failed refresh is not retried
+const defaultInstitutionRetry = 5 * time.Minute
+
+var ErrInstitutionNotFound = errors.New("institution not found")
+
+// InstitutionDirectoryOptions configures an InstitutionDirectory. With a
+// SnapshotPath the directory is saved after each refresh and loaded from
+// there when the API can't be reached. After a failed refresh the API is not
+// tried again for RetryInterval, or the TTL when shorter.
+type InstitutionDirectoryOptions struct {
+	TTL           time.Duration
+	RetryInterval time.Duration
+	SnapshotPath  string
+}
+
+// InstitutionSnapshot is the participant list at a point in time. STR holds
+// the ISPB codes of the STR participants.
+type InstitutionSnapshot struct {
+	FetchedAt    time.Time           `json:"fetched_at"`
+	Institutions []types.Institution `json:"institutions"`
+	STR          []string            `json:"str"`
+}
+
+// InstitutionChange is an institution whose data changed between snapshots
+type InstitutionChange struct {
+	Before types.Institution `json:"before"`
+	After  types.Institution `json:"after"`
+}
+
+// InstitutionDiff lists what changed between two snapshots, by ISPB code
+type InstitutionDiff struct {
+	Added   []types.Institution `json:"added"`
+	Removed []types.Institution `json:"removed"`
+	Changed []InstitutionChange `json:"changed"`
+}
+
+// Empty reports whether the snapshots were equal
+func (d *InstitutionDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// InstitutionDirectory is a cached copy of the institution list that answers
+// lookups and searches locally. It is safe for concurrent use.
+type InstitutionDirectory struct {
+	service InstitutionService
+	ttl     time.Duration
+	retry   time.Duration
+	path    string
+	now     func() time.Time
+
+	mu       sync.Mutex
+	snapshot *InstitutionSnapshot
+	byISPB   map[string]int
+	byCode   map[string]int
+	str      map[string]bool
+
+	// failedAt is when failedErr ended the last refresh
+	failedAt  time.Time
+	failedErr error
+}
+
+// Directory returns a cached institution directory. The list is fetched on
+// first use and again once it is older than the TTL.
+func (s InstitutionService) Directory(opts *InstitutionDirectoryOptions) *InstitutionDirectory {
+	d := &InstitutionDirectory{service: s, ttl: defaultInstitutionTTL, retry: defaultInstitutionRetry, now: time.Now}
+	if opts != nil {
+		if opts.TTL > 0 {
+			d.ttl = opts.TTL
+		}
+		if opts.RetryInterval > 0 {
+			d.retry = opts.RetryInterval
+		}
+		d.path = opts.SnapshotPath
+	}
+	if d.retry > d.ttl {
+		d.retry = d.ttl
+	}
+	return d
+}
+
+// Snapshot returns a copy of the snapshot in use, refreshing it when stale
+func (d *InstitutionDirectory) Snapshot() (*InstitutionSnapshot, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.ensure(); err != nil {
+		return nil, err
+	}
+
+	snapshot := *d.snapshot
+	snapshot.Institutions = append([]types.Institution(nil), d.snapshot.Institutions...)
+	snapshot.STR = append([]string(nil), d.snapshot.STR...)
+	return &snapshot, nil
+}
+
+// Refresh fetches the list from the API regardless of the TTL and returns
+// what changed since the previous snapshot.
+func (d *InstitutionDirectory) Refresh() (*InstitutionDiff, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.snapshot == nil && d.path != "" {
+		if snapshot, err := LoadInstitutionSnapshot(d.path); err == nil {
+			d.use(snapshot)
+		}
+	}
+
+	return d.refresh()
+}
+
+// ByISPB returns the institution with an ISPB code
+func (d *InstitutionDirectory) ByISPB(ispb string) (*types.Institution, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.ensure(); err != nil {
+		return nil, err
+	}
+
+	i, ok := d.byISPB[ispbKey(ispb)]
+	if !ok {
+		return nil, fmt.Errorf("%w: ispb %s", ErrInstitutionNotFound, ispb)
+	}
+	institution := d.snapshot.Institutions[i]
+	return &institution, nil
+}
+
+// ByCode returns the institution with a compe code, with or without the
+// leading zeros
+func (d *InstitutionDirectory) ByCode(code string) (*types.Institution, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.ensure(); err != nil {
+		return nil, err
+	}
+
+	i, ok := d.byCode[codeKey(code)]
+	if !ok {
+		return nil, fmt.Errorf("%w: code %s", ErrInstitutionNotFound, code)
+	}
+	institution := d.snapshot.Institutions[i]
+	return &institution, nil
+}
+
+// List returns the institutions of a context ordered by name
+func (d *InstitutionDirectory) List(context InstitutionContext) ([]types.Institution, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.ensure(); err != nil {
+		return nil, err
+	}
+
+	var institutions []types.Institution
+	for _, institution := range d.snapshot.Institutions {
+		if d.in(institution, context) {
+			institutions = append(institutions, institution)
+		}
+	}
+	sort.SliceStable(institutions, func(i, j int) bool {
+		return institutions[i].Name < institutions[j].Name
+	})
+	return institutions, nil
+}
+
+// Search returns up to limit institutions of a context matching query, best
+// matches first. Digits match the start of ISPB and compe codes; words match
+// the name and short name ignoring case and accents, tolerating a typo in
+// words of 4 letters or more. A limit <= 0 returns every match.
+func (d *InstitutionDirectory) Search(query string, context InstitutionContext, limit int) ([]types.Institution, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.ensure(); err != nil {
+		return nil, err
+	}
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	type match struct {
+		institution types.Institution
+		score       int
+	}
+	var matches []match
+	for _, institution := range d.snapshot.Institutions {
+		if !d.in(institution, context) {
+			continue
+		}
+		if score := searchScore(institution, terms); score > 0 {
+			matches = append(matches, match{institution, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].institution.Name < matches[j].institution.Name
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	institutions := make([]types.Institution, 0, len(matches))
+	for _, m := range matches {
+		institutions = append(institutions, m.institution)
+	}
+	return institutions, nil
+}
+
+// ensure makes a snapshot available, loading it from disk or the API. A
+// stale snapshot is kept when the refresh fails, so the directory keeps
+// working offline, and the API is left alone until the retry interval ends.
+func (d *InstitutionDirectory) ensure() error {
+	if d.snapshot == nil && d.path != "" {
+		if snapshot, err := LoadInstitutionSnapshot(d.path); err == nil {
+			d.use(snapshot)
+		}
+	}
+
+	if d.snapshot != nil && d.now().Sub(d.snapshot.FetchedAt) < d.ttl {
+		return nil
+	}
+
+	if d.failedErr != nil && d.now().Sub(d.failedAt) < d.retry {
+		if d.snapshot != nil {
+			return nil
+		}
+		return d.failedErr
+	}
+
+	_, err := d.refresh()
+	if err != nil && d.snapshot != nil {
+		return nil
+	}
+	return err
+}
+
+func (d *InstitutionDirectory) refresh() (*InstitutionDiff, error) {
+	all, _, err := d.service.List(AllInstitutions)
+	if err != nil {
+		d.failedAt, d.failedErr = d.now(), err
+		return nil, err
+	}
+
+	str, _, err := d.service.List(STRParticipants)
+	if err != nil {
+		d.failedAt, d.failedErr = d.now(), err
+		return nil, err
+	}
+	d.failedErr = nil
+
+	snapshot := &InstitutionSnapshot{FetchedAt: d.now().UTC(), Institutions: all}
+	for _, institution := range str {
+		snapshot.STR = append(snapshot.STR, institution.ISPBCode)
+	}
+
+	diff := DiffInstitutions(d.snapshot, snapshot)
+	d.use(snapshot)
+
+	if d.path != "" {
+		if err := snapshot.Save(d.path); err != nil {
+			return diff, err
+		}
+	}
+
+	return diff, nil
+}
+
+func (d *InstitutionDirectory) use(snapshot *InstitutionSnapshot) {
+	d.snapshot = snapshot
+	d.byISPB = make(map[string]int, len(snapshot.Institutions))
+	d.byCode = make(map[string]int, len(snapshot.Institutions))
+	for i, institution := range snapshot.Institutions {
+		d.byISPB[ispbKey(institution.ISPBCode)] = i
+		if institution.NumberCode != "" {
+			d.byCode[codeKey(institution.NumberCode)] = i
+		}
+	}
+	d.str = make(map[string]bool, len(snapshot.STR))
+	for _, ispb := range snapshot.STR {
+		d.str[ispbKey(ispb)] = true
+	}
+}
+
+func (d *InstitutionDirectory) in(institution types.Institution, context InstitutionContext) bool {
+	switch context {
+	case SPIParticipants:
+		return institution.SPIParticipant
+	case STRParticipants:
+		return d.str[ispbKey(institution.ISPBCode)]
+	}
+	return true
+}
+
+// LoadInstitutionSnapshot reads a snapshot saved by Save
+func LoadInstitutionSnapshot(path string) (*InstitutionSnapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot InstitutionSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("institution snapshot %s: %w", path, err)
+	}
+	return &snapshot, nil
+}
+
+// Save writes the snapshot to path, replacing it atomically
+func (s *InstitutionSnapshot) Save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// DiffInstitutions compares two snapshots. A nil before counts as empty.
+func DiffInstitutions(before, after *InstitutionSnapshot) *InstitutionDiff {
+	diff := &InstitutionDiff{}
+
+	old := make(map[string]types.Institution)
+	if before != nil {
+		for _, institution := range before.Institutions {
+			old[ispbKey(institution.ISPBCode)] = institution
+		}
+	}
+
+	seen := make(map[string]bool)
+	if after != nil {
+		for _, institution := range after.Institutions {
+			key := ispbKey(institution.ISPBCode)
+			seen[key] = true
+
+			previous, ok := old[key]
+			switch {
+			case !ok:
+				diff.Added = append(diff.Added, institution)
+			case previous != institution:
+				diff.Changed = append(diff.Changed, InstitutionChange{Before: previous, After: institution})
+			}
+		}
+	}
+
+	if before != nil {
+		for _, institution := range before.Institutions {
+			if !seen[ispbKey(institution.ISPBCode)] {
+				diff.Removed = append(diff.Removed, institution)
+			}
+		}
+	}
+
+	return diff
+}
+
+// ispbKey pads ISPB codes to their 8 digits
+func ispbKey(ispb string) string {
+	ispb = strings.TrimSpace(ispb)
+	if len(ispb) < 8 {
+		ispb = strings.Repeat("0", 8-len(ispb)) + ispb
+	}
+	return ispb
+}
+
+// codeKey drops the leading zeros of compe codes
+func codeKey(code string) string {
+	code = strings.TrimLeft(strings.TrimSpace(code), "0")
+	if code == "" {
+		return "0"
+	}
+	return code
+}
+
+// searchTerms lowercases s, drops accents and splits it into words
+func searchTerms(s string) []string {
+	s = validation.FoldAccents(s)
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchScore rates how well institution matches every term, 0 meaning it
+// doesn't match at all
+func searchScore(institution types.Institution, terms []string) int {
+	words := searchTerms(institution.Name + " " + institution.ShortName)
+
+	score := 0
+	for _, term := range terms {
+		best := 0
+		if validation.IsDigits(term) {
+			switch {
+			case codeKey(term) == codeKey(institution.NumberCode) && institution.NumberCode != "":
+				best = 4
+			case strings.HasPrefix(institution.ISPBCode, term):
+				best = 3
+			}
+		}
+		for _, word := range words {
+			s := 0
+			switch {
+			case word == term:
+				s = 3
+			case strings.HasPrefix(word, term):
+				s = 2
+			case len(term) >= 4 && levenshtein(word, term) <= 1:
+				s = 1
+			}
+			if s > best {
+				best = s
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		score += best
+	}
+	return score
+}
+
+// levenshtein is the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,219 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const institutionsJSON = `[
+	{"ispb_code": "00000000", "number_code": "001", "name": "Banco do Brasil S.A.", "short_name": "BCO DO BRASIL S.A.", "spi_participant": true},
+	{"ispb_code": "60746948", "number_code": "237", "name": "Banco Bradesco S.A.", "short_name": "BCO BRADESCO S.A.", "spi_participant": true},
+	{"ispb_code": "60701190", "number_code": "341", "name": "Itaú Unibanco S.A.", "short_name": "ITAÚ UNIBANCO S.A.", "spi_participant": true},
+	{"ispb_code": "13140088", "number_code": "", "name": "Acesso Soluções de Pagamento S.A.", "short_name": "ACESSO", "spi_participant": true},
+	{"ispb_code": "33479023", "number_code": "756", "name": "Banco Cooperativo Sicoob S.A.", "short_name": "BANCOOB", "spi_participant": false}
+]`
+
+func TestInstitutionDirectory(t *testing.T) {
+	setup()
+	defer teardown()
+
+	calls := 0
+	mux.HandleFunc("/v1/institutions", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		calls++
+		if r.URL.Query().Get("context") == string(STRParticipants) {
+			fmt.Fprint(w, `[{"ispb_code": "00000000"}, {"ispb_code": "60746948"}, {"ispb_code": "33479023"}]`)
+			return
+		}
+		fmt.Fprint(w, institutionsJSON)
+	})
+
+	directory := client.Institution.Directory(&InstitutionDirectoryOptions{TTL: time.Hour})
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	directory.now = func() time.Time { return now }
+
+	institution, err := directory.ByCode("1")
+	if err != nil {
+		t.Fatalf("directory.ByCode returned error: %v", err)
+	}
+	if institution.ISPBCode != "00000000" {
+		t.Errorf("directory.ByCode returned %+v, expected Banco do Brasil", institution)
+	}
+
+	if institution, err := directory.ByISPB("60701190"); err != nil || institution.NumberCode != "341" {
+		t.Errorf("directory.ByISPB returned %+v, %v, expected Itaú", institution, err)
+	}
+	if _, err := directory.ByISPB("99999999"); !errors.Is(err, ErrInstitutionNotFound) {
+		t.Errorf("directory.ByISPB returned error %v, expected %v", err, ErrInstitutionNotFound)
+	}
+
+	searches := []struct {
+		query   string
+		context InstitutionContext
+		want    []string
+	}{
+		{"itau", AllInstitutions, []string{"60701190"}},
+		{"bradesko", AllInstitutions, []string{"60746948"}},
+		{"banco", AllInstitutions, []string{"60746948", "33479023", "00000000"}},
+		{"banco", SPIParticipants, []string{"60746948", "00000000"}},
+		{"banco", STRParticipants, []string{"60746948", "33479023", "00000000"}},
+		{"acesso", STRParticipants, nil},
+		{"756", AllInstitutions, []string{"33479023"}},
+		{"banco brasil", AllInstitutions, []string{"00000000"}},
+	}
+	for _, s := range searches {
+		institutions, err := directory.Search(s.query, s.context, 0)
+		if err != nil {
+			t.Fatalf("directory.Search returned error: %v", err)
+		}
+		var got []string
+		for _, institution := range institutions {
+			got = append(got, institution.ISPBCode)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(s.want) {
+			t.Errorf("directory.Search(%q, %s) = %v, expected %v", s.query, s.context, got, s.want)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("directory fetched the list %d times, expected once per context", calls)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := directory.List(SPIParticipants); err != nil {
+		t.Fatalf("directory.List returned error: %v", err)
+	}
+	if calls != 4 {
+		t.Errorf("directory fetched the list %d times after the TTL, expected a refresh", calls)
+	}
+}
+
+func TestInstitutionDirectorySnapshot(t *testing.T) {
+	setup()
+	defer teardown()
+
+	path := filepath.Join(t.TempDir(), "institutions.json")
+	list := institutionsJSON
+	mux.HandleFunc("/v1/institutions", func(w http.ResponseWriter, r *http.Request) {
+		if list == "" {
+			http.Error(w, `{"message": "unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, list)
+	})
+
+	directory := client.Institution.Directory(&InstitutionDirectoryOptions{SnapshotPath: path})
+	diff, err := directory.Refresh()
+	if err != nil {
+		t.Fatalf("directory.Refresh returned error: %v", err)
+	}
+	if len(diff.Added) != 5 {
+		t.Errorf("directory.Refresh added %d institutions, expected 5", len(diff.Added))
+	}
+
+	snapshot, err := directory.Snapshot()
+	if err != nil {
+		t.Fatalf("directory.Snapshot returned error: %v", err)
+	}
+	code := snapshot.Institutions[0].NumberCode
+	snapshot.Institutions[0].NumberCode = "999"
+	if again, _ := directory.Snapshot(); again.Institutions[0].NumberCode != code {
+		t.Error("directory.Snapshot returned the list in use instead of a copy")
+	}
+
+	list = `[
+		{"ispb_code": "00000000", "number_code": "001", "name": "Banco do Brasil S.A.", "short_name": "BCO DO BRASIL S.A.", "spi_participant": true},
+		{"ispb_code": "60746948", "number_code": "237", "name": "Banco Bradesco S.A.", "short_name": "BCO BRADESCO S.A.", "spi_participant": true},
+		{"ispb_code": "60701190", "number_code": "341", "name": "Itaú Unibanco S.A.", "short_name": "ITAÚ UNIBANCO S.A.", "spi_participant": true},
+		{"ispb_code": "33479023", "number_code": "756", "name": "Banco Cooperativo Sicoob S.A.", "short_name": "SICOOB", "spi_participant": true},
+		{"ispb_code": "18236120", "number_code": "260", "name": "Nu Pagamentos S.A.", "short_name": "NU PAGAMENTOS", "spi_participant": true}
+	]`
+	diff, err = client.Institution.Directory(&InstitutionDirectoryOptions{SnapshotPath: path}).Refresh()
+	if err != nil {
+		t.Fatalf("directory.Refresh returned error: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].ISPBCode != "18236120" ||
+		len(diff.Removed) != 1 || diff.Removed[0].ISPBCode != "13140088" ||
+		len(diff.Changed) != 1 || diff.Changed[0].After.ShortName != "SICOOB" {
+		t.Errorf("directory.Refresh returned diff %+v", diff)
+	}
+
+	// Offline, a stale snapshot on disk is still served
+	list = ""
+	offline := client.Institution.Directory(&InstitutionDirectoryOptions{SnapshotPath: path, TTL: time.Nanosecond})
+	if institution, err := offline.ByCode("260"); err != nil || institution.ISPBCode != "18236120" {
+		t.Errorf("directory.ByCode returned %+v, %v offline, expected the snapshot", institution, err)
+	}
+
+	if _, err := client.Institution.Directory(nil).ByCode("260"); err == nil {
+		t.Error("directory.ByCode expected error without API or snapshot")
+	}
+}
+
+func TestInstitutionDirectoryRetryInterval(t *testing.T) {
+	setup()
+	defer teardown()
+
+	calls := 0
+	down := false
+	mux.HandleFunc("/v1/institutions", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if down {
+			http.Error(w, `{"message": "unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, institutionsJSON)
+	})
+
+	directory := client.Institution.Directory(&InstitutionDirectoryOptions{TTL: time.Hour, RetryInterval: time.Minute})
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	directory.now = func() time.Time { return now }
+
+	if _, err := directory.ByCode("341"); err != nil {
+		t.Fatalf("directory.ByCode returned error: %v", err)
+	}
+
+	down = true
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 3; i++ {
+		if institution, err := directory.ByCode("341"); err != nil || institution.ISPBCode != "60701190" {
+			t.Errorf("directory.ByCode returned %+v, %v with the API down, expected the stale snapshot", institution, err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("directory fetched the list %d times, expected a single failed refresh", calls)
+	}
+
+	down = false
+	now = now.Add(time.Minute)
+	if _, err := directory.ByCode("341"); err != nil {
+		t.Fatalf("directory.ByCode returned error: %v", err)
+	}
+	if calls != 5 {
+		t.Errorf("directory fetched the list %d times, expected a refresh after the retry interval", calls)
+	}
+}
@@ -0,0 +1,399 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// InvoiceBatchFormat is the encoding of an invoice batch file
+type InvoiceBatchFormat string
+
+const (
+	InvoiceBatchCSV   InvoiceBatchFormat = "csv"
+	InvoiceBatchJSONL InvoiceBatchFormat = "jsonl"
+
+	instructionSeparator = "|"
+)
+
+// InvoiceBatchRow is one invoice of a batch. Key identifies the row across
+// runs, so rows may be reordered or fixed without issuing twice; when empty
+// the row content is used instead. Line is the line of the row in the file
+// it was read from and is used in reports.
+type InvoiceBatchRow struct {
+	Key  string `json:"key,omitempty"`
+	Line int    `json:"-"`
+	types.PaymentInvoiceInput
+}
+
+// invoiceColumns sets each CSV column on a row
+var invoiceColumns = map[string]func(row *InvoiceBatchRow, v string) error{
+	"key":              func(row *InvoiceBatchRow, v string) error { row.Key = v; return nil },
+	"account_id":       func(row *InvoiceBatchRow, v string) error { row.AccountID = v; return nil },
+	"currency":         func(row *InvoiceBatchRow, v string) error { row.Currency = v; return nil },
+	"amount":           func(row *InvoiceBatchRow, v string) error { return parseCSVFloat(v, &row.Amount) },
+	"expiration_date":  func(row *InvoiceBatchRow, v string) error { row.ExpirationDate = v; return nil },
+	"limit_date":       func(row *InvoiceBatchRow, v string) error { row.LimitDate = v; return nil },
+	"invoice_type":     func(row *InvoiceBatchRow, v string) error { row.InvoiceType = v; return nil },
+	"payer_document":   func(row *InvoiceBatchRow, v string) error { row.Payer.Document = v; return nil },
+	"payer_legal_name": func(row *InvoiceBatchRow, v string) error { row.Payer.LegalName = v; return nil },
+	"payer_trade_name": func(row *InvoiceBatchRow, v string) error { row.Payer.TradeName = v; return nil },
+	"fine_type": func(row *InvoiceBatchRow, v string) error {
+		row.fine().Type = v
+		return nil
+	},
+	"fine_value": func(row *InvoiceBatchRow, v string) error { return parseCSVFloat(v, &row.fine().Value) },
+	"interest_type": func(row *InvoiceBatchRow, v string) error {
+		row.interest().Type = v
+		return nil
+	},
+	"interest_value": func(row *InvoiceBatchRow, v string) error { return parseCSVFloat(v, &row.interest().Value) },
+	"discount_type": func(row *InvoiceBatchRow, v string) error {
+		row.discount().Type = v
+		return nil
+	},
+	"discount_value": func(row *InvoiceBatchRow, v string) error { return parseCSVFloat(v, &row.discount().Value) },
+	"discount_limit_date": func(row *InvoiceBatchRow, v string) error {
+		row.discount().LimitDate = types.Date(v)
+		return nil
+	},
+	"instructions": func(row *InvoiceBatchRow, v string) error {
+		row.Instructions = strings.Split(v, instructionSeparator)
+		return nil
+	},
+}
+
+var requiredInvoiceColumns = []string{"amount", "expiration_date", "invoice_type"}
+
+func (row *InvoiceBatchRow) fine() *types.InvoiceFine {
+	if row.Fine == nil {
+		row.Fine = &types.InvoiceFine{}
+	}
+	return row.Fine
+}
+
+func (row *InvoiceBatchRow) interest() *types.InvoiceInterest {
+	if row.Interest == nil {
+		row.Interest = &types.InvoiceInterest{}
+	}
+	return row.Interest
+}
+
+func (row *InvoiceBatchRow) discount() *types.InvoiceDiscount {
+	if len(row.Discounts) == 0 {
+		row.Discounts = []types.InvoiceDiscount{{}}
+	}
+	return &row.Discounts[0]
+}
+
+func parseCSVFloat(v string, dst *float64) error {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	*dst = f
+	return nil
+}
+
+// ReadInvoiceBatch reads the rows of a batch file. CSV files must have a
+// header naming their columns, which match the JSON fields of
+// PaymentInvoiceInput with payer, fine, interest and a single discount
+// flattened, such as payer_document or fine_value. Instructions are
+// separated by "|". JSONL files have one InvoiceBatchRow per line. Amounts
+// are in cents and empty cells are ignored.
+func ReadInvoiceBatch(r io.Reader, format InvoiceBatchFormat) ([]InvoiceBatchRow, error) {
+	switch format {
+	case InvoiceBatchCSV:
+		return readInvoiceCSV(r)
+	case InvoiceBatchJSONL:
+		return readInvoiceJSONL(r)
+	}
+	return nil, fmt.Errorf("unknown batch format %q", format)
+}
+
+func readInvoiceCSV(r io.Reader) ([]InvoiceBatchRow, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	present := make(map[string]bool)
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		if _, ok := invoiceColumns[header[i]]; !ok {
+			return nil, fmt.Errorf("header: unknown column %q", column)
+		}
+		present[header[i]] = true
+	}
+	for _, column := range requiredInvoiceColumns {
+		if !present[column] {
+			return nil, fmt.Errorf("header: missing column %q", column)
+		}
+	}
+
+	var rows []InvoiceBatchRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := InvoiceBatchRow{Line: line}
+		for i, v := range record {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if err := invoiceColumns[header[i]](&row, v); err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", line, header[i], err)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func readInvoiceJSONL(r io.Reader) ([]InvoiceBatchRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var rows []InvoiceBatchRow
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+		row := InvoiceBatchRow{Line: line}
+		if err := json.Unmarshal([]byte(data), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// InvoiceBatchOptions configures PaymentInvoiceService.InvoiceBatch
+type InvoiceBatchOptions struct {
+	// BatchID identifies the batch. Running the same rows again with the same
+	// BatchID reuses the idempotency keys, so nothing is issued twice.
+	BatchID string
+	// AccountID is used for rows without an account_id
+	AccountID string
+	// Concurrency is the number of invoices in flight, defaults to 1
+	Concurrency int
+	// RatePerSecond caps how many invoices start per second, 0 means unlimited
+	RatePerSecond float64
+	// Checkpoint, when set, records issued rows so they are skipped on resume
+	Checkpoint BatchCheckpoint
+}
+
+// InvoiceBatchResult is the outcome of a single batch row
+type InvoiceBatchResult struct {
+	Line           int                   `json:"line"`
+	Key            string                `json:"key,omitempty"`
+	IdempotencyKey string                `json:"idempotency_key"`
+	Invoice        *types.PaymentInvoice `json:"invoice,omitempty"`
+	Error          string                `json:"error,omitempty"`
+	Resumed        bool                  `json:"resumed,omitempty"`
+
+	Err error `json:"-"`
+}
+
+// InvoiceBatchReport holds one result per row, in input order
+type InvoiceBatchReport struct {
+	BatchID string               `json:"batch_id"`
+	Results []InvoiceBatchResult `json:"results"`
+}
+
+// Succeeded returns how many rows were issued
+func (r *InvoiceBatchReport) Succeeded() int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed returns how many rows completed with an error
+func (r *InvoiceBatchReport) Failed() int {
+	return len(r.Results) - r.Succeeded()
+}
+
+// WriteCSV writes the report with one row per line
+func (r *InvoiceBatchReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"line", "key", "idempotency_key", "invoice_id", "status", "barcode", "writable_line", "error"})
+	if err != nil {
+		return err
+	}
+
+	for _, result := range r.Results {
+		var id, status, barcode, line string
+		if result.Invoice != nil {
+			id = result.Invoice.ID
+			status = result.Invoice.Status
+			barcode = result.Invoice.Barcode
+			line = result.Invoice.WritableLine
+		}
+		err := cw.Write([]string{strconv.Itoa(result.Line), result.Key, result.IdempotencyKey, id, status, barcode, line, result.Error})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSONL writes the report with one result per line
+func (r *InvoiceBatchReport) WriteJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, result := range r.Results {
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvoiceBatch issues rows as a batch of invoices. Every row is validated up
+// front and gets an idempotency key derived from the batch id and its key.
+// Row failures are reported per row; the returned error is only set when the
+// batch itself could not run to completion.
+func (s *PaymentInvoiceService) InvoiceBatch(ctx context.Context, rows []InvoiceBatchRow, opts InvoiceBatchOptions) (*InvoiceBatchReport, error) {
+	if strings.TrimSpace(opts.BatchID) == "" {
+		return nil, errors.New("batch_id can't be empty")
+	}
+
+	report := &InvoiceBatchReport{
+		BatchID: opts.BatchID,
+		Results: make([]InvoiceBatchResult, len(rows)),
+	}
+
+	inputs := make([]types.PaymentInvoiceInput, len(rows))
+	seen := make(map[string]int)
+
+	var pending []int
+	for i, row := range rows {
+		result := &report.Results[i]
+		result.Line = row.Line
+		if result.Line == 0 {
+			result.Line = i + 1
+		}
+		result.Key = row.Key
+
+		inputs[i] = row.PaymentInvoiceInput
+		if inputs[i].AccountID == "" {
+			inputs[i].AccountID = opts.AccountID
+		}
+
+		var keyed interface{} = inputs[i]
+		if row.Key != "" {
+			keyed = row.Key
+		}
+		key, err := batchKey(opts.BatchID, 0, keyed)
+		if err != nil {
+			return nil, err
+		}
+		result.IdempotencyKey = key
+
+		if line, ok := seen[key]; ok {
+			result.setErr(fmt.Errorf("duplicate of line %d", line))
+			continue
+		}
+		seen[key] = result.Line
+
+		if err := inputs[i].Validate(); err != nil {
+			result.setErr(err)
+			continue
+		}
+
+		result.setErr(ErrBatchLineSkipped)
+		pending = append(pending, i)
+	}
+
+	limiter := newRateLimiter(opts.RatePerSecond)
+
+	err := runBatch(ctx, len(pending), opts.Concurrency, limiter, func(p int) {
+		i := pending[p]
+		result := &report.Results[i]
+
+		if opts.Checkpoint != nil {
+			if data, ok := opts.Checkpoint.Load(result.IdempotencyKey); ok {
+				var invoice types.PaymentInvoice
+				if err := json.Unmarshal(data, &invoice); err == nil {
+					result.Invoice = &invoice
+					result.Resumed = true
+					result.setErr(nil)
+					return
+				}
+			}
+		}
+
+		invoice, _, err := s.PaymentInvoice(inputs[i], result.IdempotencyKey)
+		if err != nil {
+			result.setErr(err)
+			return
+		}
+		result.Invoice = invoice
+		result.setErr(nil)
+
+		if opts.Checkpoint != nil {
+			data, err := json.Marshal(invoice)
+			if err == nil {
+				err = opts.Checkpoint.Save(result.IdempotencyKey, data)
+			}
+			if err != nil {
+				result.setErr(fmt.Errorf("invoice %s issued but not checkpointed: %w", invoice.ID, err))
+			}
+		}
+	})
+
+	return report, err
+}
+
+func (r *InvoiceBatchResult) setErr(err error) {
+	r.Err = err
+	r.Error = errString(err)
+}
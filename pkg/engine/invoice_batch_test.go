@@ -0,0 +1,149 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestReadInvoiceBatch(t *testing.T) {
+	csvData := "key,amount,expiration_date,invoice_type,payer_document,payer_legal_name,fine_type,fine_value,instructions\n" +
+		"a,2500,2030-01-10,bill_of_exchange,529.982.247-25,Maria,percent,2,line one|line two\n"
+	rows, err := ReadInvoiceBatch(strings.NewReader(csvData), InvoiceBatchCSV)
+	if err != nil {
+		t.Fatalf("ReadInvoiceBatch returned error: %v", err)
+	}
+
+	jsonData := `{"key":"a","amount":2500,"expiration_date":"2030-01-10","invoice_type":"bill_of_exchange",` +
+		`"payer":{"document":"529.982.247-25","legal_name":"Maria"},"fine":{"type":"percent","value":2},"instructions":["line one","line two"]}` + "\n"
+	want, err := ReadInvoiceBatch(strings.NewReader(jsonData), InvoiceBatchJSONL)
+	if err != nil {
+		t.Fatalf("ReadInvoiceBatch returned error: %v", err)
+	}
+
+	if len(rows) != 1 || len(want) != 1 || rows[0].Line != 2 || want[0].Line != 1 {
+		t.Fatalf("ReadInvoiceBatch csv = %+v, jsonl = %+v, expected a row on lines 2 and 1", rows, want)
+	}
+	want[0].Line = rows[0].Line
+	if !reflect.DeepEqual(rows, want) || rows[0].Fine.Value != 2 {
+		t.Errorf("ReadInvoiceBatch csv = %+v, jsonl = %+v", rows, want)
+	}
+
+	_, err = ReadInvoiceBatch(strings.NewReader("amount,due\n"), InvoiceBatchCSV)
+	if err == nil || !strings.Contains(err.Error(), `unknown column "due"`) {
+		t.Errorf("ReadInvoiceBatch returned %v for an unknown column", err)
+	}
+
+	_, err = ReadInvoiceBatch(strings.NewReader("amount,expiration_date,invoice_type\nabc,2030-01-10,deposit\n"), InvoiceBatchCSV)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2: amount") {
+		t.Errorf("ReadInvoiceBatch returned %v for an invalid amount", err)
+	}
+}
+
+func TestInvoiceBatch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls int32
+	keys := make(chan string, 10)
+	mux.HandleFunc("/v1/barcode_payment_invoices", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		keys <- r.Header.Get("x-bhojpur-idempotency-key")
+		n := atomic.AddInt32(&calls, 1)
+		fmt.Fprintf(w, `{"id": "inv%d", "status": "CREATED", "barcode": "123", "writable_line": "456"}`, n)
+	})
+
+	due := types.NewDate(time.Now().AddDate(0, 0, 10))
+	csvData := "key,amount,expiration_date,invoice_type\n" +
+		"a,2500," + string(due) + ",deposit\n" +
+		"b,10," + string(due) + ",deposit\n" +
+		"c,3000," + string(due) + ",proposal\n" +
+		"a,2500," + string(due) + ",deposit\n"
+	rows, err := ReadInvoiceBatch(strings.NewReader(csvData), InvoiceBatchCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// proposals need a payer
+	rows[2].Payer = types.PaymentInvoicePayerInput{Document: "52998224725", LegalName: "Maria"}
+
+	path := filepath.Join(t.TempDir(), "invoices.jsonl")
+	checkpoint, err := OpenFileCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+
+	opts := InvoiceBatchOptions{BatchID: "billing-2022-05", AccountID: "acc", Concurrency: 2, Checkpoint: checkpoint}
+	report, err := client.PaymentInvoice.InvoiceBatch(context.Background(), rows, opts)
+	if err != nil {
+		t.Fatalf("paymentInvoice.InvoiceBatch returned error: %v", err)
+	}
+
+	if report.Succeeded() != 2 || report.Failed() != 2 || calls != 2 {
+		t.Fatalf("paymentInvoice.InvoiceBatch succeeded %d, failed %d with %d calls", report.Succeeded(), report.Failed(), calls)
+	}
+	if report.Results[3].Line != 5 || report.Results[3].Error != "duplicate of line 2" {
+		t.Errorf("paymentInvoice.InvoiceBatch line 4 error = %q", report.Results[3].Error)
+	}
+	if got := <-keys; got != report.Results[0].IdempotencyKey && got != report.Results[2].IdempotencyKey {
+		t.Errorf("paymentInvoice.InvoiceBatch sent idempotency key %q", got)
+	}
+
+	// Reordering the rows and resuming must not issue again
+	reopened, err := OpenFileCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	opts.Checkpoint = reopened
+	resumed, err := client.PaymentInvoice.InvoiceBatch(context.Background(), []InvoiceBatchRow{rows[2], rows[0]}, opts)
+	if err != nil {
+		t.Fatalf("paymentInvoice.InvoiceBatch returned error: %v", err)
+	}
+	if calls != 2 || !resumed.Results[0].Resumed || resumed.Results[1].Invoice.ID != report.Results[0].Invoice.ID {
+		t.Errorf("paymentInvoice.InvoiceBatch resumed = %+v with %d calls", resumed.Results, calls)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV returned error: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 || records[1][1] != "a" || records[1][5] != "123" || records[1][6] != "456" || records[2][7] == "" {
+		t.Errorf("WriteCSV wrote %v", records)
+	}
+}
@@ -25,7 +25,9 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/bhojpur/bank/pkg/calendar"
 	"github.com/bhojpur/bank/pkg/types"
 )
 
@@ -34,10 +36,13 @@ type PaymentInvoiceService struct {
 	client *Client
 }
 
-// PaymentInvoice make a bar code payment invoice
+// PaymentInvoice make a bar code payment invoice. It is checked against the
+// client calendar: issued after the invoice cut-off or on a holiday, it is
+// registered on the next business day and must still be due then.
 func (s *PaymentInvoiceService) PaymentInvoice(input types.PaymentInvoiceInput, idempotencyKey string) (*types.PaymentInvoice, *Response, error) {
 	path := "/v1/barcode_payment_invoices"
-	if err := input.Validate(); err != nil {
+	registered := s.client.calendar.Settlement(calendar.OperationInvoice, time.Now())
+	if err := input.ValidateOn(s.client.calendar, registered); err != nil {
 		return nil, nil, err
 	}
 
@@ -126,3 +131,9 @@ func (s *PaymentInvoiceService) Cancel(paymentInvoiceID string) (*Response, erro
 
 	return resp, nil
 }
+
+// VerifySettlement checks the amount paid for a settled invoice against its
+// rules, with the due dates of the client calendar.
+func (s *PaymentInvoiceService) VerifySettlement(invoice *types.PaymentInvoice) error {
+	return invoice.VerifySettlementOn(s.client.calendar)
+}
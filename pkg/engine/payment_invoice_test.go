@@ -0,0 +1,72 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestPaymentInvoiceDueOnWeekend(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// A saturday expiration is payable without charges until the next
+	// business day, which the limit date must cover
+	today := time.Now().In(client.Calendar().Location())
+	saturday := types.NewDate(today.AddDate(0, 0, int(time.Saturday-today.Weekday())+7))
+	want := client.Calendar().DueDate(saturday)
+
+	mux.HandleFunc("/v1/barcode_payment_invoices", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+
+		var input types.PaymentInvoiceInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		if input.LimitDate != string(want) {
+			t.Errorf("paymentInvoice.PaymentInvoice sent limit_date %s, expected %s", input.LimitDate, want)
+		}
+		fmt.Fprint(w, `{"id": "inv1", "status": "CREATED"}`)
+	})
+
+	input := types.PaymentInvoiceInput{
+		AccountID:      "acc",
+		Amount:         10000,
+		ExpirationDate: string(saturday),
+		InvoiceType:    types.InvoiceTypeBillOfExchange,
+		Payer:          types.PaymentInvoicePayerInput{Document: "52998224725", LegalName: "Maria"},
+	}
+	if _, _, err := client.PaymentInvoice.PaymentInvoice(input, "key"); err != nil {
+		t.Fatalf("paymentInvoice.PaymentInvoice returned error: %v", err)
+	}
+
+	input.ExpirationDate = string(types.NewDate(today.AddDate(0, 0, -1)))
+	if _, _, err := client.PaymentInvoice.PaymentInvoice(input, "key"); err == nil {
+		t.Error("paymentInvoice.PaymentInvoice accepted an invoice that expired yesterday")
+	}
+}
@@ -21,18 +21,44 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/bhojpur/bank/pkg/types"
 )
 
+var (
+	ErrCheckoutNotFound      = errors.New("checkout not found in order")
+	ErrCheckoutNotRefundable = errors.New("checkout is not paid")
+)
+
 type PaymentLinkService struct {
 	client *Client
 }
 
+// PaymentLinkFilter narrows ListOrders. Dates are inclusive and zero fields
+// are not sent.
+type PaymentLinkFilter struct {
+	Status     types.PaymentLinkStatus
+	CustomerID string
+	Code       string
+	From       types.Date
+	To         types.Date
+	// After is the cursor returned by the previous page
+	After string
+	Limit int
+}
+
+// PaymentLinkPage is a page of orders. Next is empty on the last page.
+type PaymentLinkPage struct {
+	Data []types.PaymentLink
+	Next string
+}
+
 func (s *PaymentLinkService) Get(accountID, orderID string) (types.PaymentLink, *Response, error) {
 	accountID = strings.TrimSpace(accountID)
 	orderID = strings.TrimSpace(orderID)
@@ -64,6 +90,9 @@ func (s *PaymentLinkService) Get(accountID, orderID string) (types.PaymentLink,
 
 func (s *PaymentLinkService) Create(input types.PaymentLinkInput) (types.PaymentLink, *Response, error) {
 	path := "/v1/payment_links/orders"
+	if err := input.Validate(); err != nil {
+		return types.PaymentLink{}, nil, err
+	}
 
 	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
 	if err != nil {
@@ -107,3 +136,261 @@ func (s *PaymentLinkService) Cancel(orderID string, input types.PaymentLinkCance
 
 	return paymentLink, resp, nil
 }
+
+// ListOrders returns a page of the payment link orders of an account
+func (s *PaymentLinkService) ListOrders(accountID string, filter PaymentLinkFilter) (*PaymentLinkPage, *Response, error) {
+	accountID = strings.TrimSpace(accountID)
+	if accountID == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return nil, nil, errors.New("to can't be before from")
+	}
+
+	path := fmt.Sprintf("/v1/payment_links/%s/orders", accountID)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q := req.URL.Query()
+	if filter.Status != "" {
+		q.Add("status", string(filter.Status))
+	}
+	if filter.CustomerID != "" {
+		q.Add("customer_id", filter.CustomerID)
+	}
+	if filter.Code != "" {
+		q.Add("code", filter.Code)
+	}
+	if !filter.From.IsZero() {
+		q.Add("from", filter.From.String())
+	}
+	if !filter.To.IsZero() {
+		q.Add("to", filter.To.String())
+	}
+	if filter.After != "" {
+		q.Add("after", filter.After)
+	}
+	if filter.Limit > 0 {
+		q.Add("limit", strconv.Itoa(filter.Limit))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	var dataResp struct {
+		Cursor types.Cursor        `json:"cursor"`
+		Data   []types.PaymentLink `json:"data"`
+	}
+
+	resp, err := s.client.Do(req, &dataResp)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	page := &PaymentLinkPage{Data: dataResp.Data}
+	if dataResp.Cursor.After != nil {
+		page.Next = *dataResp.Cursor.After
+	}
+
+	return page, resp, nil
+}
+
+// ListAllOrders follows the cursor of ListOrders until the last page or
+// until ctx is done, returning what was fetched so far on error.
+func (s *PaymentLinkService) ListAllOrders(ctx context.Context, accountID string, filter PaymentLinkFilter) ([]types.PaymentLink, *Response, error) {
+	var all []types.PaymentLink
+	for {
+		if err := ctx.Err(); err != nil {
+			return all, nil, err
+		}
+
+		page, resp, err := s.ListOrders(accountID, filter)
+		if err != nil {
+			return all, resp, err
+		}
+		all = append(all, page.Data...)
+
+		if page.Next == "" || page.Next == filter.After || len(page.Data) == 0 {
+			return all, resp, nil
+		}
+		filter.After = page.Next
+	}
+}
+
+// GetCheckout returns a checkout of an order
+func (s *PaymentLinkService) GetCheckout(accountID, orderID, checkoutID string) (*types.PaymentLinkCheckout, *Response, error) {
+	if strings.TrimSpace(checkoutID) == "" {
+		return nil, nil, errors.New("checkout_id can't be empty")
+	}
+
+	order, resp, err := s.Get(accountID, orderID)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	for i := range order.Checkouts {
+		if order.Checkouts[i].ID == checkoutID {
+			return &order.Checkouts[i], resp, nil
+		}
+	}
+
+	return nil, resp, fmt.Errorf("%w: %s", ErrCheckoutNotFound, checkoutID)
+}
+
+// WaitCheckout polls a checkout until the customer pays it or it closes.
+// The last fetched checkout is returned even when ctx expires first.
+func (s *PaymentLinkService) WaitCheckout(ctx context.Context, accountID, orderID, checkoutID string, opts *WaitOptions) (*types.PaymentLinkCheckout, *Response, error) {
+	var last *types.PaymentLinkCheckout
+	resp, err := poll(ctx, opts, func() (bool, *Response, error) {
+		checkout, resp, err := s.GetCheckout(accountID, orderID, checkoutID)
+		if err != nil {
+			return false, resp, err
+		}
+
+		status := types.PaymentLinkCheckoutStatus(checkout.Status)
+		if last != nil && !types.PaymentLinkCheckoutStatus(last.Status).CanTransitionTo(status) {
+			return false, resp, fmt.Errorf("%w: %s -> %s", ErrUnexpectedTransition, last.Status, checkout.Status)
+		}
+		last = checkout
+
+		return status.IsSettled(), resp, nil
+	})
+
+	return last, resp, err
+}
+
+// Refund returns all or part of a paid checkout. A zero amount refunds
+// whatever was not refunded yet. A refund over the limit, or of a checkout
+// already refunded, is still sent with an idempotency key, as it may retry
+// the refund that reached the limit, and the API decides.
+func (s *PaymentLinkService) Refund(orderID, checkoutID string, input types.PaymentLinkRefundInput, idempotencyKey string) (*types.PaymentLinkRefund, *Response, error) {
+	checkout, resp, err := s.GetCheckout(input.AccountID, orderID, checkoutID)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var limitErr error
+	if status := types.PaymentLinkCheckoutStatus(checkout.Status); !status.IsRefundable() {
+		limitErr = fmt.Errorf("%w: %s", ErrCheckoutNotRefundable, checkout.Status)
+		if idempotencyKey == "" || status != types.PaymentLinkCheckoutStatusRefunded {
+			return nil, resp, limitErr
+		}
+	}
+
+	// Refunds still in flight are not part of refunded_amount yet
+	refunds, resp, err := s.ListRefunds(input.AccountID, orderID, checkoutID)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	refunded := checkout.RefundedAmount
+	issued := 0.0
+	for _, r := range refunds {
+		if r.Status != string(types.PaymentLinkRefundStatusFailed) {
+			issued += r.Amount
+		}
+	}
+	if issued > refunded {
+		refunded = issued
+	}
+
+	paid := checkout.PaidAmount
+	if paid == 0 {
+		paid = checkout.Amount
+	}
+	if err := input.Validate(paid, refunded); err != nil {
+		if idempotencyKey == "" || !errors.Is(err, types.ErrRefundExceedsAmount) {
+			return nil, nil, err
+		}
+		if limitErr == nil {
+			limitErr = err
+		}
+	}
+
+	path := fmt.Sprintf("/v1/payment_links/%s/orders/%s/checkouts/%s/refunds", input.AccountID, orderID, checkoutID)
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var refund types.PaymentLinkRefund
+	resp, err = s.client.Do(req, &refund)
+	if err != nil {
+		// A rejected retry is reported with the local reason
+		if limitErr != nil {
+			return nil, resp, limitErr
+		}
+		return nil, resp, err
+	}
+
+	return &refund, resp, nil
+}
+
+// ListRefunds returns the refunds of a checkout, following the cursor until
+// the last page
+func (s *PaymentLinkService) ListRefunds(accountID, orderID, checkoutID string) ([]types.PaymentLinkRefund, *Response, error) {
+	accountID = strings.TrimSpace(accountID)
+	if accountID == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+	if strings.TrimSpace(orderID) == "" {
+		return nil, nil, errors.New("order_id can't be empty")
+	}
+	if strings.TrimSpace(checkoutID) == "" {
+		return nil, nil, errors.New("checkout_id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/payment_links/%s/orders/%s/checkouts/%s/refunds", accountID, orderID, checkoutID)
+
+	var all []types.PaymentLinkRefund
+	after := ""
+	for {
+		refunds, next, resp, err := s.listRefundsPage(path, after)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, refunds...)
+
+		if next == "" || next == after || len(refunds) == 0 {
+			return all, resp, nil
+		}
+		after = next
+	}
+}
+
+func (s *PaymentLinkService) listRefundsPage(path, after string) ([]types.PaymentLinkRefund, string, *Response, error) {
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if after != "" {
+		q := req.URL.Query()
+		q.Add("after", after)
+		req.URL.RawQuery = q.Encode()
+	}
+
+	var dataResp struct {
+		Cursor types.Cursor              `json:"cursor"`
+		Data   []types.PaymentLinkRefund `json:"data"`
+	}
+
+	resp, err := s.client.Do(req, &dataResp)
+	if err != nil {
+		return nil, "", resp, err
+	}
+
+	next := ""
+	if dataResp.Cursor.After != nil {
+		next = *dataResp.Cursor.After
+	}
+
+	return dataResp.Data, next, resp, nil
+}
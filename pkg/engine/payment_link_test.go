@@ -0,0 +1,287 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestPaymentLinkCreateValidates(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/payment_links/orders", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("paymentLink.Create sent an invalid order")
+	})
+
+	input := types.PaymentLinkInput{
+		AccountID: "acc123",
+		Items:     []types.PaymentLinkItemInput{{Currency: "BRL", Amount: 1000, Description: "Shirt", Quantity: 2}},
+		Customer:  types.PaymentLinkCustomerInput{Name: "Maria", Email: "maria@example.com"},
+		Payments: []types.PaymentLinkPaymentInput{{
+			Currency:      "BRL",
+			Amount:        1500,
+			PaymentMethod: types.PaymentLinkMethodCheckout,
+			Checkout:      types.PaymentLinkCheckoutInput{AcceptedPaymentMethods: []string{types.PaymentLinkMethodUpi}},
+		}},
+	}
+
+	if _, _, err := client.PaymentLink.Create(input); err == nil {
+		t.Error("paymentLink.Create expected error for payments not matching items")
+	}
+
+	input.Payments[0].Amount = 2000
+	input.Payments[0].Checkout.AcceptedMultiPaymentMethods = []string{types.PaymentLinkMethodCreditCard}
+	if _, _, err := client.PaymentLink.Create(input); err == nil {
+		t.Error("paymentLink.Create expected error for multi payment method not accepted")
+	}
+}
+
+func TestPaymentLinkListAllOrders(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/payment_links/acc123/orders", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		q := r.URL.Query()
+		if q.Get("status") != "paid" || q.Get("from") != "2022-01-01" || q.Get("customer_id") != "cus1" {
+			t.Errorf("paymentLink.ListOrders sent query %v", q)
+		}
+
+		switch q.Get("after") {
+		case "":
+			fmt.Fprint(w, `{"cursor": {"after": "c1"}, "data": [{"id": "or1"}, {"id": "or2"}]}`)
+		case "c1":
+			fmt.Fprint(w, `{"cursor": {}, "data": [{"id": "or3"}]}`)
+		default:
+			t.Errorf("paymentLink.ListOrders sent unexpected cursor %q", q.Get("after"))
+		}
+	})
+
+	filter := PaymentLinkFilter{
+		Status:     types.PaymentLinkStatusPaid,
+		CustomerID: "cus1",
+		From:       types.NewDate(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	orders, _, err := client.PaymentLink.ListAllOrders(context.Background(), "acc123", filter)
+	if err != nil {
+		t.Fatalf("paymentLink.ListAllOrders returned error: %v", err)
+	}
+
+	if len(orders) != 3 || orders[2].ID != "or3" {
+		t.Errorf("paymentLink.ListAllOrders returned %+v, expected 3 orders", orders)
+	}
+
+	filter.To = types.NewDate(time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC))
+	if _, _, err := client.PaymentLink.ListOrders("acc123", filter); err == nil {
+		t.Error("paymentLink.ListOrders expected error for to before from")
+	}
+}
+
+func TestPaymentLinkRefund(t *testing.T) {
+	setup()
+	defer teardown()
+
+	status := "partially_refunded"
+	pending := []string{`{"id": "rf2", "amount": 300, "status": "pending"}`, `{"id": "rf3", "amount": 100, "status": "failed"}`}
+	byKey := map[string]string{}
+	posts := 0
+
+	mux.HandleFunc("/v1/payment_links/acc123/orders/or1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id": "or1", "checkouts": [
+			{"id": "ch1", "amount": 1000, "paid_amount": 1000, "refunded_amount": 200, "status": %q,
+				"metadata": {"sku": "A1", "quantity": 2}},
+			{"id": "ch2", "amount": 500, "status": "open"}
+		]}`, status)
+	})
+	mux.HandleFunc("/v1/payment_links/acc123/orders/or1/checkouts/ch1/refunds", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if r.URL.Query().Get("after") == "" {
+				fmt.Fprint(w, `{"cursor": {"after": "rf1"}, "data": [{"id": "rf1", "amount": 200, "status": "refunded"}]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"cursor": {}, "data": [%s]}`, strings.Join(pending, ","))
+			return
+		}
+
+		posts++
+		key := r.Header.Get("x-bhojpur-idempotency-key")
+		if refund, ok := byKey[key]; ok {
+			fmt.Fprint(w, refund)
+			return
+		}
+
+		var input types.PaymentLinkRefundInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		remaining := 500.0
+		if status == "refunded" {
+			remaining = 0
+		}
+		if input.Amount == 0 {
+			input.Amount = remaining
+		}
+		if remaining == 0 || input.Amount > remaining {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"type": "REFUND_EXCEEDS_AMOUNT"}`)
+			return
+		}
+
+		refund := fmt.Sprintf(`{"id": "rf4", "checkout_id": "ch1", "amount": %v, "status": "pending"}`, input.Amount)
+		pending = append(pending, refund)
+		byKey[key] = refund
+		status = "refunded"
+		fmt.Fprint(w, refund)
+	})
+
+	checkout, _, err := client.PaymentLink.GetCheckout("acc123", "or1", "ch1")
+	if err != nil {
+		t.Fatalf("paymentLink.GetCheckout returned error: %v", err)
+	}
+	if checkout.Metadata["sku"] != "A1" || checkout.Metadata["quantity"] != 2.0 {
+		t.Errorf("paymentLink.GetCheckout returned metadata %v", checkout.Metadata)
+	}
+
+	_, _, err = client.PaymentLink.Refund("or1", "ch1", types.PaymentLinkRefundInput{AccountID: "acc123", Amount: 600}, "")
+	if !errors.Is(err, types.ErrRefundExceedsAmount) {
+		t.Errorf("paymentLink.Refund returned error %v, expected %v", err, types.ErrRefundExceedsAmount)
+	}
+	if posts != 0 {
+		t.Errorf("paymentLink.Refund sent a refund over the limit without an idempotency key")
+	}
+
+	_, _, err = client.PaymentLink.Refund("or1", "ch1", types.PaymentLinkRefundInput{AccountID: "acc123", Amount: 600}, "over")
+	if !errors.Is(err, types.ErrRefundExceedsAmount) {
+		t.Errorf("paymentLink.Refund returned error %v, expected %v", err, types.ErrRefundExceedsAmount)
+	}
+
+	refund, _, err := client.PaymentLink.Refund("or1", "ch1", types.PaymentLinkRefundInput{AccountID: "acc123"}, "key")
+	if err != nil {
+		t.Fatalf("paymentLink.Refund returned error: %v", err)
+	}
+	if refund.Amount != 500 {
+		t.Errorf("paymentLink.Refund refunded %v, expected the remaining 500", refund.Amount)
+	}
+
+	// The response was lost: the checkout is now refunded, but the retry
+	// must still return the refund rather than fail locally
+	retry, _, err := client.PaymentLink.Refund("or1", "ch1", types.PaymentLinkRefundInput{AccountID: "acc123"}, "key")
+	if err != nil {
+		t.Fatalf("paymentLink.Refund retry returned error: %v", err)
+	}
+	if retry.ID != refund.ID || retry.Amount != refund.Amount {
+		t.Errorf("paymentLink.Refund retry returned %+v, expected %+v", retry, refund)
+	}
+
+	_, _, err = client.PaymentLink.Refund("or1", "ch1", types.PaymentLinkRefundInput{AccountID: "acc123"}, "again")
+	if !errors.Is(err, ErrCheckoutNotRefundable) {
+		t.Errorf("paymentLink.Refund returned error %v, expected %v", err, ErrCheckoutNotRefundable)
+	}
+
+	_, _, err = client.PaymentLink.Refund("or1", "ch2", types.PaymentLinkRefundInput{AccountID: "acc123"}, "key")
+	if !errors.Is(err, ErrCheckoutNotRefundable) {
+		t.Errorf("paymentLink.Refund returned error %v, expected %v", err, ErrCheckoutNotRefundable)
+	}
+
+	_, _, err = client.PaymentLink.Refund("or1", "ch9", types.PaymentLinkRefundInput{AccountID: "acc123"}, "key")
+	if !errors.Is(err, ErrCheckoutNotFound) {
+		t.Errorf("paymentLink.Refund returned error %v, expected %v", err, ErrCheckoutNotFound)
+	}
+}
+
+func TestPaymentLinkWaitCheckout(t *testing.T) {
+	setup()
+	defer teardown()
+
+	statuses := []string{"open", "open", "paid"}
+	calls := 0
+	mux.HandleFunc("/v1/payment_links/acc123/orders/or1", func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[calls]
+		if calls < len(statuses)-1 {
+			calls++
+		}
+		fmt.Fprintf(w, `{"id": "or1", "checkouts": [{"id": "ch1", "status": %q}]}`, status)
+	})
+
+	checkout, _, err := client.PaymentLink.WaitCheckout(context.Background(), "acc123", "or1", "ch1", &WaitOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("paymentLink.WaitCheckout returned error: %v", err)
+	}
+
+	if checkout.Status != "paid" {
+		t.Errorf("paymentLink.WaitCheckout returned status %q, expected paid", checkout.Status)
+	}
+}
+
+func TestPaymentLinkCreateWithInstallmentPlan(t *testing.T) {
+	setup()
+	defer teardown()
+
+	config := types.InstallmentConfig{MaxInstallments: 12, InterestFree: 3, MonthlyRate: 1.99, MinInstallment: 10000}
+	plan, err := config.Plan(100000)
+	if err != nil {
+		t.Fatalf("InstallmentConfig.Plan returned error: %v", err)
+	}
+
+	mux.HandleFunc("/v1/payment_links/orders", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+
+		var input types.PaymentLinkInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		if got := input.Payments[0].Checkout.CreditCard.Installments; !reflect.DeepEqual(got, plan.PaymentLink()) {
+			t.Errorf("paymentLink.Create sent installments %+v", got)
+		}
+		fmt.Fprint(w, `{"id": "or1"}`)
+	})
+
+	input := types.PaymentLinkInput{
+		AccountID: "acc123",
+		Items:     []types.PaymentLinkItemInput{{Currency: "BRL", Amount: 100000, Description: "Notebook", Quantity: 1}},
+		Customer:  types.PaymentLinkCustomerInput{Name: "Maria"},
+		Payments: []types.PaymentLinkPaymentInput{{
+			Currency:      "BRL",
+			Amount:        100000,
+			PaymentMethod: types.PaymentLinkMethodCheckout,
+			Checkout: types.PaymentLinkCheckoutInput{
+				AcceptedPaymentMethods: []string{types.PaymentLinkMethodCreditCard},
+				CreditCard:             types.PaymentLinkCreditCardInput{Installments: plan.PaymentLink()},
+			},
+		}},
+	}
+	if _, _, err := client.PaymentLink.Create(input); err != nil {
+		t.Errorf("paymentLink.Create returned error: %v", err)
+	}
+}
@@ -21,12 +21,19 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/bhojpur/bank/pkg/types"
 )
 
+// ErrTopupValueUnavailable is returned when a purchase asks for a value that
+// is not in the catalogue of the provider or carrier.
+var ErrTopupValueUnavailable = errors.New("value not available in catalogue")
+
 // TopupsService handles communication with Bhojpur Bank API
 type TopupsService struct {
 	client *Client
@@ -67,3 +74,172 @@ func (s *TopupsService) GetValuesFromGameProvider(id int) (*types.Products, *Res
 
 	return &products, resp, err
 }
+
+// ListCarriers list all mobile carriers
+func (s *TopupsService) ListCarriers() (*types.Carriers, *Response, error) {
+	const path = "/v1/topups/mobile/carriers"
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var carriers types.Carriers
+	resp, err := s.client.Do(req, &carriers)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &carriers, resp, err
+}
+
+// GetValuesFromCarrier list all recharge values from a mobile carrier
+func (s *TopupsService) GetValuesFromCarrier(id int) (*types.Products, *Response, error) {
+	path := fmt.Sprintf("/v1/topups/mobile/values/%v", id)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var products types.Products
+	resp, err := s.client.Do(req, &products)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &products, resp, err
+}
+
+// BuyGameCredits buys credits of a game provider. The value must be in the
+// catalogue of the provider. Purchases can't be undone, so the idempotency
+// key is required.
+func (s *TopupsService) BuyGameCredits(input types.GameTopupInput, idempotencyKey string) (*types.Topup, *Response, error) {
+	if err := input.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	products, resp, err := s.GetValuesFromGameProvider(input.ProviderID)
+	if err != nil {
+		return nil, resp, err
+	}
+	if !products.Has(input.Value) {
+		return nil, resp, fmt.Errorf("%w: %d from provider %d", ErrTopupValueUnavailable, input.Value, input.ProviderID)
+	}
+
+	return s.buy("/v1/topups/games", input, idempotencyKey)
+}
+
+// RechargeMobile recharges a prepaid mobile phone. The value must be in the
+// catalogue of the carrier. Purchases can't be undone, so the idempotency
+// key is required.
+func (s *TopupsService) RechargeMobile(input types.MobileRechargeInput, idempotencyKey string) (*types.Topup, *Response, error) {
+	if err := input.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	products, resp, err := s.GetValuesFromCarrier(input.CarrierID)
+	if err != nil {
+		return nil, resp, err
+	}
+	if !products.Has(input.Value) {
+		return nil, resp, fmt.Errorf("%w: %d from carrier %d", ErrTopupValueUnavailable, input.Value, input.CarrierID)
+	}
+
+	return s.buy("/v1/topups/mobile", input, idempotencyKey)
+}
+
+func (s *TopupsService) buy(path string, input interface{}, idempotencyKey string) (*types.Topup, *Response, error) {
+	if strings.TrimSpace(idempotencyKey) == "" {
+		return nil, nil, errors.New("idempotency key can't be empty")
+	}
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var topup types.Topup
+	resp, err := s.client.Do(req, &topup)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &topup, resp, err
+}
+
+// Get returns a top-up purchase
+func (s *TopupsService) Get(id string) (*types.Topup, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/topups/%s", id)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var topup types.Topup
+	resp, err := s.client.Do(req, &topup)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &topup, resp, err
+}
+
+// GetReceipt returns the receipt of a confirmed top-up, with the voucher of
+// game credits
+func (s *TopupsService) GetReceipt(id string) (*types.TopupReceipt, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/topups/%s/receipt", id)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var receipt types.TopupReceipt
+	resp, err := s.client.Do(req, &receipt)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &receipt, resp, err
+}
+
+// Wait polls a top-up until the operator confirms or rejects it. The last
+// fetched top-up is returned even when ctx expires first.
+func (s *TopupsService) Wait(ctx context.Context, id string, opts *WaitOptions) (*types.Topup, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	var last *types.Topup
+	resp, err := poll(ctx, opts, func() (bool, *Response, error) {
+		topup, resp, err := s.Get(id)
+		if err != nil {
+			return false, resp, err
+		}
+
+		status := types.TopupStatus(topup.Status)
+		if last != nil && !types.TopupStatus(last.Status).CanTransitionTo(status) {
+			return false, resp, fmt.Errorf("%w: %s -> %s", ErrUnexpectedTransition, last.Status, status)
+		}
+		last = topup
+
+		return status.IsTerminal(), resp, nil
+	})
+
+	return last, resp, err
+}
@@ -0,0 +1,162 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestTopupsRechargeMobile(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/topups/mobile/values/3", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"product": [{"value": 1500}, {"value": 3000}]}`)
+	})
+	mux.HandleFunc("/v1/topups/mobile", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		if key := r.Header.Get("x-bhojpur-idempotency-key"); key != "order-1" {
+			t.Errorf("topups.RechargeMobile sent idempotency key %q", key)
+		}
+
+		var input types.MobileRechargeInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		fmt.Fprintf(w, `{"id": "tp1", "kind": "mobile", "value": %d, "phone": {"area_code": %q, "number": %q}, "status": "CREATED"}`,
+			input.Value, input.Phone.AreaCode, input.Phone.Number)
+	})
+
+	phone, err := types.ParseMobilePhone("+55 (11) 98765-4321")
+	if err != nil {
+		t.Fatalf("ParseMobilePhone returned error: %v", err)
+	}
+
+	input := types.MobileRechargeInput{AccountID: "acc123", CarrierID: 3, Phone: phone, Value: 2000}
+	if _, _, err := client.Topups.RechargeMobile(input, "order-1"); !errors.Is(err, ErrTopupValueUnavailable) {
+		t.Errorf("topups.RechargeMobile returned error %v, expected %v", err, ErrTopupValueUnavailable)
+	}
+
+	input.Value = 3000
+	if _, _, err := client.Topups.RechargeMobile(input, ""); err == nil {
+		t.Error("topups.RechargeMobile expected error for missing idempotency key")
+	}
+
+	topup, _, err := client.Topups.RechargeMobile(input, "order-1")
+	if err != nil {
+		t.Fatalf("topups.RechargeMobile returned error: %v", err)
+	}
+
+	want := &types.Topup{ID: "tp1", Kind: types.TopupKindMobile, Value: 3000, Phone: &phone, Status: "CREATED"}
+	if topup.ID != want.ID || topup.Value != want.Value || *topup.Phone != *want.Phone {
+		t.Errorf("topups.RechargeMobile returned %+v, expected %+v", topup, want)
+	}
+}
+
+func TestParseMobilePhone(t *testing.T) {
+	valid := map[string]string{
+		"11987654321":       "(11) 98765-4321",
+		"+55 21 99999-0000": "(21) 99999-0000",
+		"(85) 9 8888-7777":  "(85) 98888-7777",
+		"5561912345678":     "(61) 91234-5678",
+	}
+	for in, want := range valid {
+		phone, err := types.ParseMobilePhone(in)
+		if err != nil {
+			t.Errorf("ParseMobilePhone(%q) returned error: %v", in, err)
+			continue
+		}
+		if phone.String() != want {
+			t.Errorf("ParseMobilePhone(%q) = %s, expected %s", in, phone, want)
+		}
+	}
+
+	for _, in := range []string{"1198765432", "10987654321", "11887654321", "+1 415 555 0100"} {
+		if _, err := types.ParseMobilePhone(in); err == nil {
+			t.Errorf("ParseMobilePhone(%q) expected error", in)
+		}
+	}
+}
+
+func TestTopupsWaitAndReceipt(t *testing.T) {
+	setup()
+	defer teardown()
+
+	statuses := []string{"CREATED", "PROCESSING", "CONFIRMED"}
+	calls := 0
+	mux.HandleFunc("/v1/topups/tp1", func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[calls]
+		if calls < len(statuses)-1 {
+			calls++
+		}
+		fmt.Fprintf(w, `{"id": "tp1", "kind": "game", "status": %q}`, status)
+	})
+	mux.HandleFunc("/v1/topups/tp1/receipt", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"topup_id": "tp1", "authentication_code": "A1B2", "voucher": "1234-5678", "value": 5000}`)
+	})
+
+	topup, _, err := client.Topups.Wait(context.Background(), "tp1", &WaitOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("topups.Wait returned error: %v", err)
+	}
+	if topup.Status != string(types.TopupStatusConfirmed) {
+		t.Errorf("topups.Wait returned status %q, expected CONFIRMED", topup.Status)
+	}
+
+	receipt, _, err := client.Topups.GetReceipt("tp1")
+	if err != nil {
+		t.Fatalf("topups.GetReceipt returned error: %v", err)
+	}
+	if receipt.Voucher != "1234-5678" {
+		t.Errorf("topups.GetReceipt returned voucher %q, expected 1234-5678", receipt.Voucher)
+	}
+}
+
+func TestTopupsWaitUnexpectedTransition(t *testing.T) {
+	setup()
+	defer teardown()
+
+	statuses := []string{"PROCESSING", "CREATED"}
+	calls := 0
+	mux.HandleFunc("/v1/topups/tp1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id": "tp1", "status": %q}`, statuses[calls])
+		calls++
+	})
+
+	topup, _, err := client.Topups.Wait(context.Background(), "tp1", &WaitOptions{Interval: time.Millisecond})
+	if !errors.Is(err, ErrUnexpectedTransition) {
+		t.Errorf("topups.Wait returned error %v, expected %v", err, ErrUnexpectedTransition)
+	}
+	if topup == nil || topup.Status != "PROCESSING" {
+		t.Errorf("topups.Wait returned %+v, expected the last valid status", topup)
+	}
+}
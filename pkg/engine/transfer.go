@@ -21,6 +21,7 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -47,35 +48,11 @@ func (s *TransferService) Transfer(input types.TransferInput, idempotencyKey str
 }
 
 func (s *TransferService) transfer(input types.TransferInput, idempotencyKey, path string) (*types.Transfer, *Response, error) {
-	var externalTransfer bool
-
-	if input.Amount == 0 {
-		return nil, nil, errors.New("amount can't be 0")
-	}
-	if input.AccountID == "" {
-		return nil, nil, errors.New("account_id can't be empty")
-	}
-	if input.Target.Account.AccountCode == "" {
-		return nil, nil, errors.New("account_code can't be empty")
-	}
-
-	if input.Target.Account.InstitutionCode != "" {
-		if input.Target.Account.BranchCode == "" {
-			return nil, nil, errors.New("branch_code can't be empty")
-		}
-		if input.Target.Entity.Name == "" {
-			return nil, nil, errors.New("entity name can't be empty")
-		}
-		if input.Target.Entity.Document == "" {
-			return nil, nil, errors.New("entity document can't be empty")
-		}
-		if input.Target.Entity.DocumentType == "" {
-			return nil, nil, errors.New("entity document type can't be empty")
-		}
-		externalTransfer = true
+	if err := input.Validate(); err != nil {
+		return nil, nil, err
 	}
 
-	if externalTransfer {
+	if input.IsExternal() {
 		path = fmt.Sprintf("%s/external_transfers", path)
 	} else {
 		path = fmt.Sprintf("%s/internal_transfers", path)
@@ -113,9 +90,38 @@ func (s *TransferService) ListExternal(accountID string) ([]types.Transfer, *Res
 }
 
 func (s *TransferService) list(path string) ([]types.Transfer, *Response, error) {
+	transfers, _, resp, err := s.listPage(path, "")
+	return transfers, resp, err
+}
+
+// listAll follows the cursor of a transfer list until the last page
+func (s *TransferService) listAll(path string) ([]types.Transfer, *Response, error) {
+	var all []types.Transfer
+	after := ""
+	for {
+		transfers, next, resp, err := s.listPage(path, after)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, transfers...)
+
+		if next == "" || next == after || len(transfers) == 0 {
+			return all, resp, nil
+		}
+		after = next
+	}
+}
+
+func (s *TransferService) listPage(path, after string) ([]types.Transfer, string, *Response, error) {
 	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", nil, err
+	}
+
+	if after != "" {
+		q := req.URL.Query()
+		q.Add("after", after)
+		req.URL.RawQuery = q.Encode()
 	}
 
 	var dataResp struct {
@@ -125,10 +131,15 @@ func (s *TransferService) list(path string) ([]types.Transfer, *Response, error)
 
 	resp, err := s.client.Do(req, &dataResp)
 	if err != nil {
-		return nil, resp, err
+		return nil, "", resp, err
 	}
 
-	return dataResp.Data, resp, err
+	next := ""
+	if dataResp.Cursor.After != nil {
+		next = *dataResp.Cursor.After
+	}
+
+	return dataResp.Data, next, resp, err
 }
 
 // GetInternal returns an internal transfer
@@ -158,6 +169,38 @@ func (s *TransferService) get(path string) (*types.Transfer, *Response, error) {
 	return &transfer, resp, err
 }
 
+// Wait polls an internal transfer, or an external one when opts.External is
+// set, until it reaches a terminal status. The last fetched transfer is
+// returned even when ctx expires first.
+func (s *TransferService) Wait(ctx context.Context, transferID string, opts *WaitOptions) (*types.Transfer, *Response, error) {
+	if transferID == "" {
+		return nil, nil, errors.New("transfer_id can't be empty")
+	}
+
+	get := s.GetInternal
+	if opts != nil && opts.External {
+		get = s.GetExternal
+	}
+
+	var last *types.Transfer
+	resp, err := poll(ctx, opts, func() (bool, *Response, error) {
+		transfer, resp, err := get(transferID)
+		if err != nil {
+			return false, resp, err
+		}
+
+		status := types.TransferStatus(transfer.Status)
+		if last != nil && !types.TransferStatus(last.Status).CanTransitionTo(status) {
+			return false, resp, fmt.Errorf("%w: %s -> %s", ErrUnexpectedTransition, last.Status, status)
+		}
+		last = transfer
+
+		return status.IsTerminal(), resp, nil
+	})
+
+	return last, resp, err
+}
+
 // CancelInternal cancels a scheduled internal transference
 func (s *TransferService) CancelInternal(transferID string) (*Response, error) {
 	path := fmt.Sprintf("/v1/internal_transfers/%s/cancel", transferID)
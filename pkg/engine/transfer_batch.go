@@ -0,0 +1,221 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// ErrBatchDryRunFailed is returned when at least one line of a batch failed
+// its dry run, in which case no transfer is executed.
+var ErrBatchDryRunFailed = errors.New("batch dry run failed")
+
+// TransferBatchOptions configures TransferService.TransferBatch
+type TransferBatchOptions struct {
+	// BatchID identifies the batch. Running the same inputs again with the same
+	// BatchID reuses the idempotency keys, so nothing is transferred twice.
+	BatchID string
+	// DryRun simulates every line first and aborts if any of them fails
+	DryRun bool
+	// Concurrency is the number of transfers in flight, defaults to 1
+	Concurrency int
+	// RatePerSecond caps how many transfers start per second, 0 means unlimited
+	RatePerSecond float64
+	// Checkpoint, when set, records finished lines so they are skipped on resume
+	Checkpoint BatchCheckpoint
+}
+
+// TransferBatchResult is the outcome of a single batch line
+type TransferBatchResult struct {
+	Line           int             `json:"line"`
+	IdempotencyKey string          `json:"idempotency_key"`
+	Transfer       *types.Transfer `json:"transfer,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Resumed        bool            `json:"resumed,omitempty"`
+
+	Err error `json:"-"`
+}
+
+// TransferBatchReport holds one result per input line, in input order
+type TransferBatchReport struct {
+	BatchID string                `json:"batch_id"`
+	DryRun  bool                  `json:"dry_run"`
+	Results []TransferBatchResult `json:"results"`
+}
+
+// Succeeded returns how many lines completed without error
+func (r *TransferBatchReport) Succeeded() int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed returns how many lines completed with an error
+func (r *TransferBatchReport) Failed() int {
+	return len(r.Results) - r.Succeeded()
+}
+
+// WriteCSV writes the report with one row per line
+func (r *TransferBatchReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"line", "idempotency_key", "transfer_id", "status", "amount", "error"})
+	if err != nil {
+		return err
+	}
+
+	for _, result := range r.Results {
+		var id, status, amount string
+		if result.Transfer != nil {
+			id = result.Transfer.ID
+			status = result.Transfer.Status
+			amount = strconv.FormatFloat(result.Transfer.Amount, 'f', -1, 64)
+		}
+		err := cw.Write([]string{strconv.Itoa(result.Line), result.IdempotencyKey, id, status, amount, result.Error})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// TransferBatch executes inputs as a batch of transfers. Every line is
+// validated up front and gets an idempotency key derived from the batch id and
+// its content. Line failures are reported per line; the returned error is
+// only set when the batch itself could not run to completion.
+func (s *TransferService) TransferBatch(ctx context.Context, inputs []types.TransferInput, opts TransferBatchOptions) (*TransferBatchReport, error) {
+	if strings.TrimSpace(opts.BatchID) == "" {
+		return nil, errors.New("batch_id can't be empty")
+	}
+
+	report := &TransferBatchReport{
+		BatchID: opts.BatchID,
+		Results: make([]TransferBatchResult, len(inputs)),
+	}
+
+	lines := make([]types.TransferInput, len(inputs))
+	copy(lines, inputs)
+
+	var pending []int
+	for i := range lines {
+		result := &report.Results[i]
+		result.Line = i + 1
+
+		key, err := batchKey(opts.BatchID, result.Line, lines[i])
+		if err != nil {
+			return nil, err
+		}
+		result.IdempotencyKey = key
+
+		if err := lines[i].Validate(); err != nil {
+			result.setErr(err)
+			continue
+		}
+
+		result.setErr(ErrBatchLineSkipped)
+		pending = append(pending, i)
+	}
+
+	limiter := newRateLimiter(opts.RatePerSecond)
+
+	if opts.DryRun {
+		err := runBatch(ctx, len(pending), opts.Concurrency, limiter, func(p int) {
+			i := pending[p]
+			result := &report.Results[i]
+			if opts.Checkpoint != nil {
+				if _, ok := opts.Checkpoint.Load(result.IdempotencyKey); ok {
+					result.setErr(nil)
+					return
+				}
+			}
+
+			transfer, _, err := s.DryRunTransfer(lines[i], "dry-run-"+result.IdempotencyKey)
+			result.Transfer = transfer
+			result.setErr(err)
+		})
+		if err != nil {
+			report.DryRun = true
+			return report, err
+		}
+
+		if report.Failed() > 0 {
+			report.DryRun = true
+			return report, ErrBatchDryRunFailed
+		}
+	}
+
+	err := runBatch(ctx, len(pending), opts.Concurrency, limiter, func(p int) {
+		i := pending[p]
+		result := &report.Results[i]
+		result.Transfer = nil
+
+		if opts.Checkpoint != nil {
+			if data, ok := opts.Checkpoint.Load(result.IdempotencyKey); ok {
+				var transfer types.Transfer
+				if err := json.Unmarshal(data, &transfer); err == nil {
+					result.Transfer = &transfer
+					result.Resumed = true
+					result.setErr(nil)
+					return
+				}
+			}
+		}
+
+		transfer, _, err := s.Transfer(lines[i], result.IdempotencyKey)
+		if err != nil {
+			result.setErr(err)
+			return
+		}
+		result.Transfer = transfer
+		result.setErr(nil)
+
+		if opts.Checkpoint != nil {
+			data, err := json.Marshal(transfer)
+			if err == nil {
+				err = opts.Checkpoint.Save(result.IdempotencyKey, data)
+			}
+			if err != nil {
+				result.setErr(fmt.Errorf("transfer %s done but not checkpointed: %w", transfer.ID, err))
+			}
+		}
+	})
+
+	return report, err
+}
+
+func (r *TransferBatchResult) setErr(err error) {
+	r.Err = err
+	r.Error = errString(err)
+}
@@ -0,0 +1,149 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestTransferBatch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls int32
+	mux.HandleFunc("/v1/internal_transfers", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		n := atomic.AddInt32(&calls, 1)
+		fmt.Fprintf(w, `{"id": "t%d", "status": "CREATED", "amount": 100}`, n)
+	})
+
+	inputs := []types.TransferInput{
+		{AccountID: "acc", Amount: 100, Target: types.Target{Account: types.TransferAccount{AccountCode: "334201"}}},
+		{AccountID: "acc", Amount: 0, Target: types.Target{Account: types.TransferAccount{AccountCode: "334201"}}},
+		{AccountID: "acc", Amount: 100, Target: types.Target{Account: types.TransferAccount{AccountCode: "334202"}}},
+	}
+
+	path := filepath.Join(t.TempDir(), "batch.jsonl")
+	checkpoint, err := OpenFileCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+
+	opts := TransferBatchOptions{BatchID: "payroll-2022-05", Concurrency: 2, Checkpoint: checkpoint}
+	report, err := client.Transfer.TransferBatch(context.Background(), inputs, opts)
+	if err != nil {
+		t.Fatalf("transfer.TransferBatch returned error: %v", err)
+	}
+
+	if report.Succeeded() != 2 || report.Failed() != 1 || calls != 2 {
+		t.Fatalf("transfer.TransferBatch succeeded %d, failed %d with %d calls", report.Succeeded(), report.Failed(), calls)
+	}
+	if report.Results[1].Error != "amount can't be 0" {
+		t.Errorf("transfer.TransferBatch line 2 error = %q", report.Results[1].Error)
+	}
+
+	// Resuming the same batch must not transfer again
+	reopened, err := OpenFileCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	opts.Checkpoint = reopened
+	resumed, err := client.Transfer.TransferBatch(context.Background(), inputs, opts)
+	if err != nil {
+		t.Fatalf("transfer.TransferBatch returned error: %v", err)
+	}
+	if calls != 2 || !resumed.Results[0].Resumed || resumed.Results[0].Transfer.ID != report.Results[0].Transfer.ID {
+		t.Errorf("transfer.TransferBatch resumed %+v after %d calls", resumed.Results[0], calls)
+	}
+	if resumed.Results[0].IdempotencyKey != report.Results[0].IdempotencyKey {
+		t.Errorf("transfer.TransferBatch idempotency keys are not deterministic")
+	}
+}
+
+func TestTransferBatchDryRunFailure(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/dry_run/internal_transfers", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"type": "srn:error:insufficient_balance"}`)
+	})
+	mux.HandleFunc("/v1/internal_transfers", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("transfer executed after failed dry run")
+	})
+
+	inputs := []types.TransferInput{
+		{AccountID: "acc", Amount: 100, Target: types.Target{Account: types.TransferAccount{AccountCode: "334201"}}},
+	}
+
+	report, err := client.Transfer.TransferBatch(context.Background(), inputs, TransferBatchOptions{BatchID: "b1", DryRun: true})
+	if !errors.Is(err, ErrBatchDryRunFailed) {
+		t.Errorf("transfer.TransferBatch returned error %v, expected %v", err, ErrBatchDryRunFailed)
+	}
+	if !report.DryRun || report.Failed() != 1 {
+		t.Errorf("transfer.TransferBatch returned %+v", report)
+	}
+}
+
+func TestFileCheckpointTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	// A crash in the middle of the second write
+	if err := os.WriteFile(path, []byte(`{"key":"a","result":{"id":"t1"}}`+"\n"+`{"key":"b","res`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"c", "d"} {
+		checkpoint, err := OpenFileCheckpoint(path)
+		if err != nil {
+			t.Fatalf("OpenFileCheckpoint returned error: %v", err)
+		}
+		if _, ok := checkpoint.Load("b"); ok {
+			t.Error("checkpoint loaded the torn line")
+		}
+		if err := checkpoint.Save(key, []byte(`{"id":"`+key+`"}`)); err != nil {
+			t.Fatalf("checkpoint.Save returned error: %v", err)
+		}
+		checkpoint.Close()
+	}
+
+	checkpoint, err := OpenFileCheckpoint(path)
+	if err != nil {
+		t.Fatalf("OpenFileCheckpoint returned error: %v", err)
+	}
+	defer checkpoint.Close()
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := checkpoint.Load(key); !ok {
+			t.Errorf("checkpoint lost %q after resuming twice", key)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/calendar"
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// ErrScheduleDelayed is returned by Schedule when the API would move the
+// transfer to the next business day and the caller did not allow it.
+var ErrScheduleDelayed = errors.New("scheduled transfer delayed to next business day")
+
+// SchedulePrediction is the settlement date a transfer is expected to get
+// from the business-day calendar, before it is submitted.
+type SchedulePrediction struct {
+	Requested types.Date
+	Effective types.Date
+	Delayed   bool
+}
+
+// ScheduledTransfer is a transfer waiting for its execution date
+type ScheduledTransfer struct {
+	types.Transfer
+	External bool
+}
+
+// ScheduledTransferFilter narrows ListScheduled. Zero values match everything.
+type ScheduledTransferFilter struct {
+	From         types.Date
+	To           types.Date
+	InternalOnly bool
+	ExternalOnly bool
+}
+
+// PreviewSchedule dry-runs a scheduled transfer. The returned transfer tells
+// whether it would be delayed to the next business day and its effective date.
+func (s *TransferService) PreviewSchedule(input types.TransferInput) (*types.Transfer, *Response, error) {
+	if input.ScheduledTo.IsZero() {
+		return nil, nil, errors.New("scheduled_to can't be empty")
+	}
+	return s.DryRunTransfer(input, "")
+}
+
+// PredictSchedule predicts locally when a transfer submitted at now settles.
+// External transfers follow the STR business days and cut-off, internal ones
+// settle on the requested date.
+func (s *TransferService) PredictSchedule(input types.TransferInput, now time.Time) SchedulePrediction {
+	op := calendar.OperationInternalTransfer
+	if input.IsExternal() {
+		op = calendar.OperationExternalTransfer
+	}
+
+	effective, delayed := s.client.calendar.Scheduled(op, input.ScheduledTo, now)
+	return SchedulePrediction{Requested: input.ScheduledTo, Effective: effective, Delayed: delayed}
+}
+
+// Schedule submits a scheduled transfer after previewing it. When the API
+// would delay it to the next business day and allowDelay is false, nothing is
+// submitted and the preview is returned along with ErrScheduleDelayed. The
+// preview decides; the calendar only explains the delay in the error.
+func (s *TransferService) Schedule(input types.TransferInput, idempotencyKey string, allowDelay bool) (*types.Transfer, *Response, error) {
+	preview, resp, err := s.PreviewSchedule(input)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	if preview.DelayedToNextBusinessDay && !allowDelay {
+		err := fmt.Errorf("%w: effective date %s", ErrScheduleDelayed, preview.ScheduledToEffective)
+		if reason := s.delayReason(input, time.Now()); reason != "" {
+			err = fmt.Errorf("%w (%s)", err, reason)
+		}
+		return preview, resp, err
+	}
+
+	return s.Transfer(input, idempotencyKey)
+}
+
+// delayReason tells from the calendar why a transfer submitted at now is
+// delayed, or returns "" when the calendar doesn't predict the delay
+func (s *TransferService) delayReason(input types.TransferInput, now time.Time) string {
+	prediction := s.PredictSchedule(input, now)
+	if !prediction.Delayed {
+		return ""
+	}
+
+	cal := s.client.calendar
+	day := prediction.Requested
+	if today := types.NewDate(now.In(cal.Location())); day.IsZero() || !today.Before(day) {
+		day = today
+	}
+
+	if name, ok := cal.Holiday(day); ok {
+		return fmt.Sprintf("%s is %s", day, name)
+	}
+	if !cal.IsBusinessDay(day) {
+		return fmt.Sprintf("%s is not a business day", day)
+	}
+	cutOff, _ := cal.CutOffOf(calendar.OperationExternalTransfer)
+	return fmt.Sprintf("submitted after the %s cut-off", cutOff)
+}
+
+// ListScheduled returns the internal and external transfers of an account
+// that are still waiting for their execution date, following every page.
+func (s *TransferService) ListScheduled(accountID string, filter ScheduledTransferFilter) ([]ScheduledTransfer, *Response, error) {
+	if strings.TrimSpace(accountID) == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+
+	var scheduled []ScheduledTransfer
+	var resp *Response
+
+	lists := []struct {
+		external bool
+		resource string
+	}{
+		{false, "internal_transfers"},
+		{true, "external_transfers"},
+	}
+
+	for _, l := range lists {
+		if (l.external && filter.InternalOnly) || (!l.external && filter.ExternalOnly) {
+			continue
+		}
+
+		var transfers []types.Transfer
+		var err error
+		transfers, resp, err = s.listAll(fmt.Sprintf("/v1/%s?account_id=%s", l.resource, accountID))
+		if err != nil {
+			return nil, resp, err
+		}
+
+		for _, t := range transfers {
+			if filter.matches(t) {
+				scheduled = append(scheduled, ScheduledTransfer{Transfer: t, External: l.external})
+			}
+		}
+	}
+
+	return scheduled, resp, nil
+}
+
+func (f ScheduledTransferFilter) matches(t types.Transfer) bool {
+	if types.TransferStatus(t.Status) != types.TransferStatusScheduled {
+		return false
+	}
+
+	date := types.Date(t.ScheduledTo)
+	if len(date) > len(types.DateLayout) {
+		date = date[:len(types.DateLayout)]
+	}
+	if !f.From.IsZero() && date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && f.To.Before(date) {
+		return false
+	}
+
+	return true
+}
+
+// Reschedule moves a scheduled transfer to a new date. The API has no update
+// operation, so the new transfer is previewed, the original is cancelled and
+// the new one is submitted with idempotencyKey.
+func (s *TransferService) Reschedule(transferID string, external bool, scheduledTo types.Date, idempotencyKey string) (*types.Transfer, *Response, error) {
+	get, cancel := s.GetInternal, s.CancelInternal
+	if external {
+		get, cancel = s.GetExternal, s.CancelExternal
+	}
+
+	original, resp, err := get(transferID)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	if types.TransferStatus(original.Status) != types.TransferStatusScheduled {
+		return nil, resp, fmt.Errorf("transfer %s is %s, only scheduled transfers can be rescheduled", transferID, original.Status)
+	}
+
+	input := types.TransferInput{
+		AccountID:   original.AccountID,
+		Currency:    original.Currency,
+		Amount:      original.Amount,
+		Description: original.Description,
+		ScheduledTo: scheduledTo,
+		Target:      original.Target,
+	}
+	if !external {
+		input.Target.Account = types.TransferAccount{AccountCode: original.Target.Account.AccountCode}
+	}
+
+	if _, resp, err := s.PreviewSchedule(input); err != nil {
+		return nil, resp, err
+	}
+
+	if resp, err := cancel(transferID); err != nil {
+		return nil, resp, err
+	}
+
+	transfer, resp, err := s.Transfer(input, idempotencyKey)
+	if err != nil {
+		return nil, resp, fmt.Errorf("transfer %s was cancelled but its replacement failed: %w", transferID, err)
+	}
+
+	return transfer, resp, nil
+}
@@ -0,0 +1,330 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestTransferWait(t *testing.T) {
+	setup()
+	defer teardown()
+
+	statuses := []string{"CREATED", "APPROVED", "FINISHED"}
+	calls := 0
+	mux.HandleFunc("/v1/internal_transfers/abc123", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+
+		status := statuses[calls]
+		if calls < len(statuses)-1 {
+			calls++
+		}
+		fmt.Fprintf(w, `{"id": "abc123", "status": %q}`, status)
+	})
+
+	transfer, _, err := client.Transfer.Wait(context.Background(), "abc123", &WaitOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("transfer.Wait returned error: %v", err)
+	}
+
+	if transfer.Status != "FINISHED" {
+		t.Errorf("transfer.Wait returned status %s, expected FINISHED", transfer.Status)
+	}
+}
+
+func TestTransferWaitUnexpectedTransition(t *testing.T) {
+	setup()
+	defer teardown()
+
+	statuses := []string{"SCHEDULED", "CREATED"}
+	calls := 0
+	mux.HandleFunc("/v1/external_transfers/abc123", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id": "abc123", "status": %q}`, statuses[calls])
+		calls++
+	})
+
+	transfer, _, err := client.Transfer.Wait(context.Background(), "abc123", &WaitOptions{External: true, Interval: time.Millisecond})
+	if !errors.Is(err, ErrUnexpectedTransition) {
+		t.Errorf("transfer.Wait returned error %v, expected %v", err, ErrUnexpectedTransition)
+	}
+
+	if transfer == nil || transfer.Status != "SCHEDULED" {
+		t.Errorf("transfer.Wait returned %+v, expected last valid transfer", transfer)
+	}
+}
+
+func TestUpiWaitOutboundContextDone(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi/outbound_upi_payments/abc123", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "abc123", "status": "MONEY_RESERVED"}`)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	upi, _, err := client.Upi.WaitOutbound(ctx, "abc123", &WaitOptions{Interval: time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("upi.WaitOutbound returned error %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	if upi == nil || upi.Status != "MONEY_RESERVED" {
+		t.Errorf("upi.WaitOutbound returned %+v, expected last fetched payment", upi)
+	}
+}
+
+func TestTransferScheduleDelayedByCalendar(t *testing.T) {
+	setup()
+	defer teardown()
+
+	today := time.Now().In(client.Calendar().Location())
+	saturday := types.NewDate(today.AddDate(0, 0, int(time.Saturday-today.Weekday())+7))
+	effective := client.Calendar().Following(saturday)
+
+	previews := 0
+	mux.HandleFunc("/v1/dry_run/external_transfers", func(w http.ResponseWriter, r *http.Request) {
+		previews++
+		fmt.Fprintf(w, `{"id": "dry", "delayed_to_next_business_day": true, "scheduled_to_effective": %q}`, effective)
+	})
+
+	input := types.TransferInput{
+		AccountID:   "acc123",
+		Amount:      1000,
+		ScheduledTo: saturday,
+		Target: types.Target{
+			Account: types.TransferAccount{InstitutionCode: "001", BranchCode: "7032", AccountCode: "1234"},
+			Entity:  types.Entity{Name: "Maria", Document: "52998224725", DocumentType: "cpf"},
+		},
+	}
+
+	prediction := client.Transfer.PredictSchedule(input, time.Now())
+	if !prediction.Delayed || prediction.Effective != effective {
+		t.Errorf("transfer.PredictSchedule returned %+v, expected a delay to the next business day", prediction)
+	}
+
+	// The API still decides, the calendar only explains the delay
+	preview, _, err := client.Transfer.Schedule(input, "key", false)
+	if !errors.Is(err, ErrScheduleDelayed) {
+		t.Errorf("transfer.Schedule returned error %v, expected %v", err, ErrScheduleDelayed)
+	}
+	if previews != 1 || preview == nil || preview.ID != "dry" {
+		t.Errorf("transfer.Schedule returned preview %+v after %d previews, expected the API preview", preview, previews)
+	}
+	if err != nil && !strings.Contains(err.Error(), string(saturday)) {
+		t.Errorf("transfer.Schedule error %q doesn't explain the delay", err)
+	}
+
+	input.Target = types.Target{}
+	if prediction := client.Transfer.PredictSchedule(input, time.Now()); prediction.Delayed {
+		t.Errorf("transfer.PredictSchedule returned %+v for an internal transfer, expected no delay", prediction)
+	}
+}
+
+func TestDateValidateWithin(t *testing.T) {
+	// 23:30 in Brasilia is already the next day in UTC
+	today := time.Date(2024, 11, 19, 23, 30, 0, 0, types.BankLocation)
+
+	dates := []struct {
+		date  types.Date
+		valid bool
+	}{
+		{"2024-11-19", true},
+		{"2024-11-18", false},
+		{"2024-11-29", true},
+		{"2024-11-30", false},
+		{"2024-02-30", false},
+		{"19/11/2024", false},
+	}
+	for _, d := range dates {
+		err := d.date.ValidateWithin(today, 10)
+		if (err == nil) != d.valid {
+			t.Errorf("Date(%s).ValidateWithin returned %v, expected valid %v", d.date, err, d.valid)
+		}
+	}
+}
+
+func TestScheduledTransferFilterMatches(t *testing.T) {
+	filter := ScheduledTransferFilter{From: "2024-11-10", To: "2024-11-20"}
+
+	transfers := []struct {
+		transfer types.Transfer
+		want     bool
+	}{
+		{types.Transfer{Status: "SCHEDULED", ScheduledTo: "2024-11-10"}, true},
+		{types.Transfer{Status: "SCHEDULED", ScheduledTo: "2024-11-20T00:00:00Z"}, true},
+		{types.Transfer{Status: "SCHEDULED", ScheduledTo: "2024-11-21"}, false},
+		{types.Transfer{Status: "SCHEDULED", ScheduledTo: "2024-11-09"}, false},
+		{types.Transfer{Status: "FINISHED", ScheduledTo: "2024-11-15"}, false},
+	}
+	for _, tr := range transfers {
+		if got := filter.matches(tr.transfer); got != tr.want {
+			t.Errorf("matches(%s %s) = %v, expected %v", tr.transfer.Status, tr.transfer.ScheduledTo, got, tr.want)
+		}
+	}
+}
+
+func TestTransferListScheduled(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/internal_transfers", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.URL.Query().Get("account_id") != "acc123" {
+			t.Errorf("transfer.ListScheduled sent query %v", r.URL.Query())
+		}
+
+		switch r.URL.Query().Get("after") {
+		case "":
+			fmt.Fprint(w, `{"cursor": {"after": "c1"}, "data": [
+				{"id": "it1", "status": "SCHEDULED", "scheduled_to": "2024-11-20"},
+				{"id": "it2", "status": "FINISHED", "scheduled_to": "2024-11-10"}
+			]}`)
+		case "c1":
+			fmt.Fprint(w, `{"cursor": {}, "data": [{"id": "it3", "status": "SCHEDULED", "scheduled_to": "2024-11-25"}]}`)
+		default:
+			t.Errorf("transfer.ListScheduled sent unexpected cursor %q", r.URL.Query().Get("after"))
+		}
+	})
+	mux.HandleFunc("/v1/external_transfers", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"cursor": {}, "data": [{"id": "et1", "status": "SCHEDULED", "scheduled_to": "2024-12-01"}]}`)
+	})
+
+	scheduled, _, err := client.Transfer.ListScheduled("acc123", ScheduledTransferFilter{})
+	if err != nil {
+		t.Fatalf("transfer.ListScheduled returned error: %v", err)
+	}
+
+	var got []string
+	for _, s := range scheduled {
+		got = append(got, fmt.Sprintf("%s:%v", s.ID, s.External))
+	}
+	if want := "[it1:false it3:false et1:true]"; fmt.Sprint(got) != want {
+		t.Errorf("transfer.ListScheduled returned %v, expected %s", got, want)
+	}
+
+	scheduled, _, err = client.Transfer.ListScheduled("acc123", ScheduledTransferFilter{ExternalOnly: true})
+	if err != nil {
+		t.Fatalf("transfer.ListScheduled returned error: %v", err)
+	}
+	if len(scheduled) != 1 || !scheduled[0].External {
+		t.Errorf("transfer.ListScheduled returned %+v, expected only external transfers", scheduled)
+	}
+}
+
+func TestTransferSchedule(t *testing.T) {
+	setup()
+	defer teardown()
+
+	delayed := true
+	submitted := 0
+	mux.HandleFunc("/v1/dry_run/internal_transfers", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		fmt.Fprintf(w, `{"id": "dry", "delayed_to_next_business_day": %v, "scheduled_to_effective": "2030-01-07"}`, delayed)
+	})
+	mux.HandleFunc("/v1/internal_transfers", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		submitted++
+		fmt.Fprint(w, `{"id": "it1", "status": "SCHEDULED"}`)
+	})
+
+	input := types.TransferInput{
+		AccountID:   "acc123",
+		Amount:      1000,
+		ScheduledTo: types.NewDate(types.BankNow().AddDate(0, 0, 5)),
+		Target:      types.Target{Account: types.TransferAccount{AccountCode: "1234"}},
+	}
+
+	preview, _, err := client.Transfer.Schedule(input, "key", false)
+	if !errors.Is(err, ErrScheduleDelayed) {
+		t.Errorf("transfer.Schedule returned error %v, expected %v", err, ErrScheduleDelayed)
+	}
+	if preview == nil || preview.ID != "dry" || submitted != 0 {
+		t.Errorf("transfer.Schedule returned %+v and submitted %d transfers, expected only the preview", preview, submitted)
+	}
+
+	transfer, _, err := client.Transfer.Schedule(input, "key", true)
+	if err != nil {
+		t.Fatalf("transfer.Schedule returned error: %v", err)
+	}
+	if transfer.ID != "it1" || submitted != 1 {
+		t.Errorf("transfer.Schedule returned %+v, expected the submitted transfer", transfer)
+	}
+
+	input.ScheduledTo = ""
+	if _, _, err := client.Transfer.Schedule(input, "key", true); err == nil {
+		t.Error("transfer.Schedule expected error without scheduled_to")
+	}
+}
+
+func TestTransferReschedule(t *testing.T) {
+	setup()
+	defer teardown()
+
+	scheduledTo := types.NewDate(types.BankNow().AddDate(0, 0, 10))
+	var calls []string
+	mux.HandleFunc("/v1/internal_transfers/it1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		calls = append(calls, "get")
+		fmt.Fprint(w, `{"id": "it1", "account_id": "acc123", "amount": 1000, "status": "SCHEDULED",
+			"target": {"account": {"account_code": "1234", "branch_code": "0001"}}}`)
+	})
+	mux.HandleFunc("/v1/dry_run/internal_transfers", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "preview")
+		fmt.Fprint(w, `{"id": "dry"}`)
+	})
+	mux.HandleFunc("/v1/internal_transfers/it1/cancel", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodDelete)
+		calls = append(calls, "cancel")
+	})
+	mux.HandleFunc("/v1/internal_transfers", func(w http.ResponseWriter, r *http.Request) {
+		var input types.TransferInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		if input.ScheduledTo != scheduledTo || input.Target.Account.BranchCode != "" {
+			t.Errorf("transfer.Reschedule submitted %+v", input)
+		}
+		calls = append(calls, "transfer")
+		fmt.Fprintf(w, `{"id": "it2", "status": "SCHEDULED", "scheduled_to": %q}`, input.ScheduledTo)
+	})
+
+	transfer, _, err := client.Transfer.Reschedule("it1", false, scheduledTo, "key")
+	if err != nil {
+		t.Fatalf("transfer.Reschedule returned error: %v", err)
+	}
+	if transfer.ID != "it2" {
+		t.Errorf("transfer.Reschedule returned %+v, expected the new transfer", transfer)
+	}
+	if want := "[get preview cancel transfer]"; fmt.Sprint(calls) != want {
+		t.Errorf("transfer.Reschedule made calls %v, expected %s", calls, want)
+	}
+}
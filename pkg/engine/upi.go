@@ -21,15 +21,22 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/bhojpur/bank/pkg/types"
 )
 
+// ErrRevisionConflict is returned when a dynamic qrcode changed since the
+// revision given to an update or cancel
+var ErrRevisionConflict = errors.New("dynamic qrcode revision conflict")
+
 // UpiService handles communication with Bhojpur Bank API
 type UpiService struct {
 	client *Client
+	keys   *keyLookupCache
 }
 
 // GetOutboundUpi is a service used to retrieve information details from a UPI.
@@ -50,6 +57,32 @@ func (s *UpiService) GetOutboundUpi(id string) (*types.UPIOutBoundOutput, *Respo
 	return &upi, resp, err
 }
 
+// WaitOutbound polls an outbound UPI payment until it reaches a terminal
+// status. The last fetched payment is returned even when ctx expires first.
+func (s *UpiService) WaitOutbound(ctx context.Context, id string, opts *WaitOptions) (*types.UPIOutBoundOutput, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	var last *types.UPIOutBoundOutput
+	resp, err := poll(ctx, opts, func() (bool, *Response, error) {
+		upi, resp, err := s.GetOutboundUpi(id)
+		if err != nil {
+			return false, resp, err
+		}
+
+		status := types.UpiPaymentStatus(upi.Status)
+		if last != nil && !types.UpiPaymentStatus(last.Status).CanTransitionTo(status) {
+			return false, resp, fmt.Errorf("%w: %s -> %s", ErrUnexpectedTransition, last.Status, status)
+		}
+		last = upi
+
+		return status.IsTerminal(), resp, nil
+	})
+
+	return last, resp, err
+}
+
 // GetQRCodeData is a service used to retrieve information details from a UPI QRCode.
 func (s *UpiService) GetQRCodeData(input types.GetQRCodeInput) (*types.QRCode, *Response, error) {
 	const path = "/v1/upi/outbound_upi_payments/brcodes"
@@ -70,6 +103,12 @@ func (s *UpiService) GetQRCodeData(input types.GetQRCodeInput) (*types.QRCode, *
 
 //ListQRCodeDynamic list the dynamic qrcodes of an account
 func (s *UpiService) ListDynamicQRCodes(accountID string) ([]types.QRCodeDynamic, *Response, error) {
+	return s.FilterDynamicQRCodes(accountID, types.DynamicQRCodeFilter{})
+}
+
+// FilterDynamicQRCodes lists the dynamic qrcodes of an account by status and
+// creation date. The filter is sent to the API and applied again locally.
+func (s *UpiService) FilterDynamicQRCodes(accountID string, filter types.DynamicQRCodeFilter) ([]types.QRCodeDynamic, *Response, error) {
 	path := fmt.Sprintf("/v1/upi_payment_invoices/?account_id=%s", accountID)
 
 	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
@@ -82,6 +121,18 @@ func (s *UpiService) ListDynamicQRCodes(accountID string) ([]types.QRCodeDynamic
 		return nil, nil, err
 	}
 
+	q := req.URL.Query()
+	if filter.Status != "" {
+		q.Add("status", string(filter.Status))
+	}
+	if !filter.From.IsZero() {
+		q.Add("from", filter.From.String())
+	}
+	if !filter.To.IsZero() {
+		q.Add("to", filter.To.String())
+	}
+	req.URL.RawQuery = q.Encode()
+
 	var dataResp struct {
 		Cursor types.Cursor          `json:"cursor"`
 		Data   []types.QRCodeDynamic `json:"data"`
@@ -92,7 +143,96 @@ func (s *UpiService) ListDynamicQRCodes(accountID string) ([]types.QRCodeDynamic
 		return nil, resp, err
 	}
 
-	return dataResp.Data, resp, err
+	data := dataResp.Data[:0]
+	for _, code := range dataResp.Data {
+		if filter.Matches(code) {
+			data = append(data, code)
+		}
+	}
+
+	return data, resp, err
+}
+
+// GetDynamicQRCode retrieves a dynamic qrcode invoice of an account
+func (s *UpiService) GetDynamicQRCode(accountID, id string) (*types.UPIInvoiceOutput, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi_payment_invoices/%s", id)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var upiInvoiceOutput types.UPIInvoiceOutput
+	resp, err := s.client.Do(req, &upiInvoiceOutput)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &upiInvoiceOutput, resp, err
+}
+
+// UpdateDynamicQRCode changes the amount, expiration or payer data of an
+// unpaid dynamic qrcode. It fails with ErrRevisionConflict when the code was
+// changed after input.Revision was read.
+func (s *UpiService) UpdateDynamicQRCode(accountID, id string, input types.UpdateDynamicQRCodeInput, idempotencyKey string) (*types.UPIInvoiceOutput, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	if err := input.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	path := fmt.Sprintf("/v1/upi_payment_invoices/%s", id)
+	return s.invoiceAction(http.MethodPatch, path, accountID, input, idempotencyKey)
+}
+
+// CancelDynamicQRCode cancels an unpaid dynamic qrcode, with the same
+// revision check as UpdateDynamicQRCode.
+func (s *UpiService) CancelDynamicQRCode(accountID, id string, revision int, idempotencyKey string) (*types.UPIInvoiceOutput, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi_payment_invoices/%s/actions/cancel", id)
+	return s.invoiceAction(http.MethodPost, path, accountID, types.CancelDynamicQRCodeInput{Revision: revision}, idempotencyKey)
+}
+
+func (s *UpiService) invoiceAction(method, path, accountID string, body interface{}, idempotencyKey string) (*types.UPIInvoiceOutput, *Response, error) {
+	req, err := s.client.NewAPIRequest(method, path, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var upiInvoiceOutput types.UPIInvoiceOutput
+	resp, err := s.client.Do(req, &upiInvoiceOutput)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusPreconditionFailed) {
+			err = fmt.Errorf("%w: %v", ErrRevisionConflict, err)
+		}
+		return nil, resp, err
+	}
+
+	return &upiInvoiceOutput, resp, err
 }
 
 // CreateDynamicQRCode make a bar code payment invoice
@@ -126,6 +266,10 @@ func (s *UpiService) CreateDynamicQRCode(input types.CreateDynamicQRCodeInput, i
 func (s *UpiService) CreatePendingPayment(input types.CreatePendingPaymentInput, idempotencyKey string) (*types.PendingPaymentOutput, *Response, error) {
 	const path = "/v1/upi/outbound_upi_payments"
 
+	if err := input.Validate(); err != nil {
+		return nil, nil, err
+	}
+
 	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
 	if err != nil {
 		return nil, nil, err
@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/bhojpur/bank/pkg/types"
 )
@@ -65,6 +66,10 @@ func (s *UpiService) CreateEntry(input types.CreateUpiEntryInput, idempotencyKey
 		return output, nil, errors.New("accountID cannot be empty")
 	}
 
+	if err := input.Validate(); err != nil {
+		return output, nil, err
+	}
+
 	path := fmt.Sprintf("/v1/upi/%s/entries", input.AccountID)
 
 	if input.ParticipantISPB == "" {
@@ -95,3 +100,195 @@ func (s *UpiService) CreateEntry(input types.CreateUpiEntryInput, idempotencyKey
 
 	return output, resp, err
 }
+
+// GetEntry retrieves the entry of an account by its key
+func (s *UpiService) GetEntry(accountID, key string) (*types.UpiEntry, *Response, error) {
+	if accountID == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+	if key == "" {
+		return nil, nil, errors.New("key can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/%s/entries/%s", accountID, url.PathEscape(key))
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entry types.UpiEntry
+	resp, err := s.client.Do(req, &entry)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &entry, resp, err
+}
+
+// DeleteEntry removes a key from an account
+func (s *UpiService) DeleteEntry(accountID, key, idempotencyKey string) (*Response, error) {
+	if accountID == "" {
+		return nil, errors.New("account_id can't be empty")
+	}
+	if key == "" {
+		return nil, errors.New("key can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/%s/entries/%s", accountID, url.PathEscape(key))
+
+	req, err := s.client.NewAPIRequest(http.MethodDelete, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.client.Do(req, nil)
+}
+
+// ResendVerificationCode sends the code of a pending email or phone
+// verification again
+func (s *UpiService) ResendVerificationCode(accountID, verificationID string) (*Response, error) {
+	if accountID == "" {
+		return nil, errors.New("account_id can't be empty")
+	}
+	if verificationID == "" {
+		return nil, errors.New("verification_id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/%s/verifications/%s/actions/resend", accountID, verificationID)
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.client.Do(req, nil)
+}
+
+// CreateClaim opens an ownership or portability claim over a key registered
+// by another account or institution
+func (s *UpiService) CreateClaim(input types.CreateUpiClaimInput, idempotencyKey string) (*types.UpiClaim, *Response, error) {
+	if err := input.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if input.ParticipantISPB == "" {
+		input.ParticipantISPB = BhojpurISPBCode
+	}
+
+	path := fmt.Sprintf("/v1/upi/%s/claims", input.AccountID)
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var claim types.UpiClaim
+	resp, err := s.client.Do(req, &claim)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &claim, resp, err
+}
+
+// GetClaim retrieves a claim, opened by the account or against one of its keys
+func (s *UpiService) GetClaim(accountID, claimID string) (*types.UpiClaim, *Response, error) {
+	if accountID == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+	if claimID == "" {
+		return nil, nil, errors.New("claim_id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/%s/claims/%s", accountID, claimID)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var claim types.UpiClaim
+	resp, err := s.client.Do(req, &claim)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &claim, resp, err
+}
+
+// ListClaims lists the claims of an account, both as claimer and as donor
+func (s *UpiService) ListClaims(accountID string) ([]types.UpiClaim, *Response, error) {
+	if accountID == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/%s/claims", accountID)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dataResp struct {
+		Cursor types.Cursor     `json:"cursor"`
+		Data   []types.UpiClaim `json:"data"`
+	}
+
+	resp, err := s.client.Do(req, &dataResp)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return dataResp.Data, resp, err
+}
+
+// ConfirmClaim releases a key to the claimer. It is called by the donor
+// account while the claim waits for resolution.
+func (s *UpiService) ConfirmClaim(accountID, claimID, idempotencyKey string) (*types.UpiClaim, *Response, error) {
+	return s.claimAction(accountID, claimID, "confirm", nil, idempotencyKey)
+}
+
+// CancelClaim withdraws a claim as claimer, or refuses it as donor
+func (s *UpiService) CancelClaim(accountID, claimID string, input types.CancelUpiClaimInput, idempotencyKey string) (*types.UpiClaim, *Response, error) {
+	return s.claimAction(accountID, claimID, "cancel", input, idempotencyKey)
+}
+
+func (s *UpiService) claimAction(accountID, claimID, action string, body interface{}, idempotencyKey string) (*types.UpiClaim, *Response, error) {
+	if accountID == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+	if claimID == "" {
+		return nil, nil, errors.New("claim_id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/%s/claims/%s/actions/%s", accountID, claimID, action)
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var claim types.UpiClaim
+	resp, err := s.client.Do(req, &claim)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &claim, resp, err
+}
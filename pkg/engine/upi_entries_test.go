@@ -21,6 +21,7 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -91,3 +92,65 @@ func TestCreateEntryWithVerification(t *testing.T) {
 		t.Errorf("upi.CreateEntry returned %+v, expected %+v", data, expected)
 	}
 }
+
+func TestCreateEntryInvalidKey(t *testing.T) {
+	setup()
+	defer teardown()
+
+	input := types.CreateUpiEntryInput{
+		AccountID: "8cbeb3d2-750f-4b14-81a1-143ad715c273",
+		Key:       "11111111111",
+		KeyType:   "CPF",
+	}
+	_, _, err := client.Upi.CreateEntry(input, "idempotencyKey123")
+	if !errors.Is(err, types.ErrInvalidUpiKey) {
+		t.Errorf("upi.CreateEntry returned error %v, expected %v", err, types.ErrInvalidUpiKey)
+	}
+}
+
+func TestGetAndDeleteEntry(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi/acc/entries/+5511987654321", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"id": "e1", "key": "+5511987654321", "key_type": "phone", "status": "REGISTERED"}`)
+	})
+
+	entry, _, err := client.Upi.GetEntry("acc", "+5511987654321")
+	if err != nil {
+		t.Fatalf("upi.GetEntry returned error: %v", err)
+	}
+
+	expected := &types.UpiEntry{ID: "e1", Key: "+5511987654321", KeyType: "phone", Status: "REGISTERED"}
+	if !reflect.DeepEqual(entry, expected) {
+		t.Errorf("upi.GetEntry returned %+v, expected %+v", entry, expected)
+	}
+
+	if _, err := client.Upi.DeleteEntry("acc", "+5511987654321", "idempotencyKey123"); err != nil {
+		t.Errorf("upi.DeleteEntry returned error: %v", err)
+	}
+}
+
+func TestConfirmClaim(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi/acc/claims/c1/actions/confirm", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		fmt.Fprint(w, `{"id": "c1", "type": "PORTABILITY", "status": "CONFIRMED"}`)
+	})
+
+	claim, _, err := client.Upi.ConfirmClaim("acc", "c1", "idempotencyKey123")
+	if err != nil {
+		t.Fatalf("upi.ConfirmClaim returned error: %v", err)
+	}
+
+	if claim.Status != string(types.UpiClaimStatusConfirmed) {
+		t.Errorf("upi.ConfirmClaim returned status %s, expected CONFIRMED", claim.Status)
+	}
+}
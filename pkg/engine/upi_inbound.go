@@ -0,0 +1,177 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// UpiInboundFilter narrows ListInbound. Dates are inclusive and zero fields
+// are not sent.
+type UpiInboundFilter struct {
+	From          types.Date
+	To            types.Date
+	Status        types.UpiPaymentStatus
+	TransactionID string
+	// After is the cursor returned by the previous page
+	After string
+	Limit int
+}
+
+// UpiInboundPage is a page of received UPI payments. Next is empty on the
+// last page.
+type UpiInboundPage struct {
+	Data []types.UPIInBoundOutput
+	Next string
+}
+
+// GetInbound is a service used to retrieve a UPI payment received by an account.
+func (s *UpiService) GetInbound(id string) (*types.UPIInBoundOutput, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/inbound_upi_payments/%s", id)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var upi types.UPIInBoundOutput
+	resp, err := s.client.Do(req, &upi)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &upi, resp, err
+}
+
+// ListInbound is a service used to list a page of UPI payments received by an account.
+func (s *UpiService) ListInbound(accountID string, filter UpiInboundFilter) (*UpiInboundPage, *Response, error) {
+	if accountID == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return nil, nil, errors.New("to can't be before from")
+	}
+
+	const path = "/v1/upi/inbound_upi_payments"
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q := req.URL.Query()
+	q.Add("account_id", accountID)
+	if !filter.From.IsZero() {
+		q.Add("from", filter.From.String())
+	}
+	if !filter.To.IsZero() {
+		q.Add("to", filter.To.String())
+	}
+	if filter.Status != "" {
+		q.Add("status", string(filter.Status))
+	}
+	if filter.TransactionID != "" {
+		q.Add("transaction_id", filter.TransactionID)
+	}
+	if filter.After != "" {
+		q.Add("after", filter.After)
+	}
+	if filter.Limit > 0 {
+		q.Add("limit", strconv.Itoa(filter.Limit))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	var dataResp struct {
+		Cursor types.Cursor             `json:"cursor"`
+		Data   []types.UPIInBoundOutput `json:"data"`
+	}
+
+	resp, err := s.client.Do(req, &dataResp)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	page := &UpiInboundPage{Data: dataResp.Data}
+	if dataResp.Cursor.After != nil {
+		page.Next = *dataResp.Cursor.After
+	}
+
+	return page, resp, err
+}
+
+// ListAllInbound follows the cursor of ListInbound until the last page or
+// until ctx is done, returning what was fetched so far on error.
+func (s *UpiService) ListAllInbound(ctx context.Context, accountID string, filter UpiInboundFilter) ([]types.UPIInBoundOutput, *Response, error) {
+	var all []types.UPIInBoundOutput
+	for {
+		if err := ctx.Err(); err != nil {
+			return all, nil, err
+		}
+
+		page, resp, err := s.ListInbound(accountID, filter)
+		if err != nil {
+			return all, resp, err
+		}
+		all = append(all, page.Data...)
+
+		if page.Next == "" || page.Next == filter.After || len(page.Data) == 0 {
+			return all, resp, nil
+		}
+		filter.After = page.Next
+	}
+}
+
+// InboundForInvoice lists the received payments of a dynamic QR code
+// invoice, correlated by its transaction id.
+func (s *UpiService) InboundForInvoice(ctx context.Context, invoice types.UPIInvoiceOutput) ([]types.UPIInBoundOutput, *Response, error) {
+	if invoice.TransactionID == "" {
+		return nil, nil, errors.New("transaction_id can't be empty")
+	}
+
+	payments, resp, err := s.ListAllInbound(ctx, invoice.AccountID, UpiInboundFilter{TransactionID: invoice.TransactionID})
+	if err != nil {
+		return nil, resp, err
+	}
+
+	matched := payments[:0]
+	for _, p := range payments {
+		if p.Pays(&invoice) {
+			matched = append(matched, p)
+		}
+	}
+
+	return matched, resp, nil
+}
@@ -0,0 +1,72 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestListAllInbound(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi/inbound_upi_payments", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+
+		q := r.URL.Query()
+		if q.Get("from") != "2026-01-01" || q.Get("transaction_id") != "txn1" {
+			t.Errorf("ListInbound sent query %s", r.URL.RawQuery)
+		}
+
+		if q.Get("after") == "" {
+			fmt.Fprint(w, `{"cursor": {"after": "p2"}, "data": [{"id": "a", "transaction_id": "txn1",
+				"source": {"entity": {"name": "Fulano", "document": "11.222.333/0001-81"}}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"cursor": {"after": null}, "data": [{"id": "b", "transaction_id": "txn1"}]}`)
+	})
+
+	payments, _, err := client.Upi.ListAllInbound(context.Background(), "acc", UpiInboundFilter{
+		From:          types.Date("2026-01-01"),
+		TransactionID: "txn1",
+	})
+	if err != nil {
+		t.Fatalf("upi.ListAllInbound returned error: %v", err)
+	}
+
+	if len(payments) != 2 || payments[0].ID != "a" || payments[1].ID != "b" {
+		t.Fatalf("upi.ListAllInbound returned %+v, expected payments a and b", payments)
+	}
+
+	payer := payments[0].Payer()
+	if !payer.IsCompany() || payer.Document != "11222333000181" {
+		t.Errorf("Payer returned %+v, expected a company with document 11222333000181", payer)
+	}
+
+	if !payments[1].Pays(&types.UPIInvoiceOutput{TransactionID: "txn1"}) {
+		t.Errorf("payment b should pay the invoice of txn1")
+	}
+}
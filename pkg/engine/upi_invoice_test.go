@@ -0,0 +1,160 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestUpdateDynamicQRCodeRevisionConflict(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi_payment_invoices/inv1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPatch)
+
+		var input types.UpdateDynamicQRCodeInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		if input.Revision != 2 {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"title": "revision mismatch"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id": "inv1", "amount": %v, "revision": 3}`, *input.Amount)
+	})
+
+	amount := 2500.0
+	_, _, err := client.Upi.UpdateDynamicQRCode("acc", "inv1", types.UpdateDynamicQRCodeInput{Revision: 1, Amount: &amount}, "key")
+	if !errors.Is(err, ErrRevisionConflict) {
+		t.Errorf("upi.UpdateDynamicQRCode returned error %v, expected %v", err, ErrRevisionConflict)
+	}
+
+	invoice, _, err := client.Upi.UpdateDynamicQRCode("acc", "inv1", types.UpdateDynamicQRCodeInput{Revision: 2, Amount: &amount}, "key")
+	if err != nil {
+		t.Fatalf("upi.UpdateDynamicQRCode returned error: %v", err)
+	}
+
+	if invoice.Amount != amount || invoice.Revision != 3 {
+		t.Errorf("upi.UpdateDynamicQRCode returned %+v, expected amount %v at revision 3", invoice, amount)
+	}
+}
+
+func TestFilterDynamicQRCodes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi_payment_invoices/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("status") != "CREATED" {
+			t.Errorf("FilterDynamicQRCodes sent query %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"data": [
+			{"status": "CREATED", "created_at": "2026-03-01T10:00:00Z"},
+			{"status": "CREATED", "created_at": "2026-03-01T02:00:00Z"},
+			{"status": "CREATED", "created_at": "2026-02-01T10:00:00Z"},
+			{"status": "PAID", "created_at": "2026-03-02T10:00:00Z"}
+		]}`)
+	})
+
+	codes, _, err := client.Upi.FilterDynamicQRCodes("acc", types.DynamicQRCodeFilter{
+		Status: types.UpiInvoiceStatusCreated,
+		From:   types.Date("2026-03-01"),
+	})
+	if err != nil {
+		t.Fatalf("upi.FilterDynamicQRCodes returned error: %v", err)
+	}
+
+	if len(codes) != 1 || codes[0].CreatedAt != "2026-03-01T10:00:00Z" {
+		t.Errorf("upi.FilterDynamicQRCodes returned %+v, expected the code created on 2026-03-01 bank time", codes)
+	}
+}
+
+func TestGetDynamicQRCode(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi_payment_invoices/inv1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.Header.Get("x-bhojpur-account-id") != "acc" {
+			t.Errorf("GetDynamicQRCode sent account id %q, expected acc", r.Header.Get("x-bhojpur-account-id"))
+		}
+		fmt.Fprint(w, `{"id": "inv1", "status": "CREATED", "amount": 1500, "revision": 2}`)
+	})
+
+	invoice, _, err := client.Upi.GetDynamicQRCode("acc", "inv1")
+	if err != nil {
+		t.Fatalf("upi.GetDynamicQRCode returned error: %v", err)
+	}
+
+	if invoice.ID != "inv1" || invoice.Amount != 1500 || invoice.Revision != 2 {
+		t.Errorf("upi.GetDynamicQRCode returned %+v, expected inv1 at revision 2", invoice)
+	}
+
+	if _, _, err := client.Upi.GetDynamicQRCode("acc", ""); err == nil {
+		t.Error("upi.GetDynamicQRCode with an empty id returned no error")
+	}
+}
+
+func TestCancelDynamicQRCode(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi_payment_invoices/inv1/actions/cancel", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		if r.Header.Get("x-bhojpur-idempotency-key") != "key" {
+			t.Errorf("CancelDynamicQRCode sent idempotency key %q, expected key", r.Header.Get("x-bhojpur-idempotency-key"))
+		}
+
+		var input types.CancelDynamicQRCodeInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		if input.Revision != 2 {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `{"title": "revision mismatch"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": "inv1", "status": "CANCELLED", "revision": 3}`)
+	})
+
+	_, _, err := client.Upi.CancelDynamicQRCode("acc", "inv1", 1, "key")
+	if !errors.Is(err, ErrRevisionConflict) {
+		t.Errorf("upi.CancelDynamicQRCode returned error %v, expected %v", err, ErrRevisionConflict)
+	}
+
+	invoice, _, err := client.Upi.CancelDynamicQRCode("acc", "inv1", 2, "key")
+	if err != nil {
+		t.Fatalf("upi.CancelDynamicQRCode returned error: %v", err)
+	}
+
+	if invoice.Status != "CANCELLED" || invoice.Revision != 3 {
+		t.Errorf("upi.CancelDynamicQRCode returned %+v, expected CANCELLED at revision 3", invoice)
+	}
+}
@@ -0,0 +1,162 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// defaultKeyLookupTTL keeps lookups short-lived, as keys may move between
+// accounts at any time
+const defaultKeyLookupTTL = 30 * time.Second
+
+var ErrBeneficiaryMismatch = errors.New("beneficiary name doesn't match the expected name")
+
+// keyLookupCache holds recent key lookups per account
+type keyLookupCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]keyLookupEntry
+}
+
+type keyLookupEntry struct {
+	lookup    types.UpiKeyLookup
+	expiresAt time.Time
+}
+
+func newKeyLookupCache(ttl time.Duration) *keyLookupCache {
+	if ttl == 0 {
+		ttl = defaultKeyLookupTTL
+	}
+	return &keyLookupCache{ttl: ttl, entries: make(map[string]keyLookupEntry)}
+}
+
+func (c *keyLookupCache) get(key string, now time.Time) (*types.UpiKeyLookup, bool) {
+	if c == nil || c.ttl < 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if now.After(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	lookup := entry.lookup
+	return &lookup, true
+}
+
+func (c *keyLookupCache) put(key string, lookup types.UpiKeyLookup, now time.Time) {
+	if c == nil || c.ttl < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = keyLookupEntry{lookup: lookup, expiresAt: now.Add(c.ttl)}
+}
+
+// WithKeyLookupTTL sets how long UpiService.LookupKey results are reused.
+// A negative ttl disables the cache.
+func WithKeyLookupTTL(ttl time.Duration) ClientOpt {
+	return func(c *Client) {
+		c.keyLookupTTL = ttl
+	}
+}
+
+// LookupKey resolves a UPI key to its beneficiary before paying it. Results
+// are cached per account for a short time, and a cached result is returned
+// with a nil Response.
+func (s *UpiService) LookupKey(accountID, key string) (*types.UpiKeyLookup, *Response, error) {
+	if accountID == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+
+	key = strings.TrimSpace(key)
+	if keyType, err := types.DetectUpiKeyType(key); err == nil {
+		key, _ = keyType.Normalize(key)
+	}
+	if key == "" {
+		return nil, nil, errors.New("key can't be empty")
+	}
+
+	cacheKey := accountID + "|" + key
+	if lookup, ok := s.keys.get(cacheKey, time.Now()); ok {
+		return lookup, nil, nil
+	}
+
+	path := fmt.Sprintf("/v1/upi/keys/%s", url.PathEscape(key))
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lookup types.UpiKeyLookup
+	resp, err := s.client.Do(req, &lookup)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	s.keys.put(cacheKey, lookup, time.Now())
+
+	return &lookup, resp, err
+}
+
+// ConfirmBeneficiary looks up key and checks that its owner is named
+// expectedName, returning the lookup so it can be shown to the payer.
+func (s *UpiService) ConfirmBeneficiary(accountID, key, expectedName string) (*types.UpiKeyLookup, *Response, error) {
+	lookup, resp, err := s.LookupKey(accountID, key)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	if !lookup.BeneficiaryEntity.NameMatches(expectedName) {
+		return lookup, resp, fmt.Errorf("%w: key belongs to %s", ErrBeneficiaryMismatch, lookup.BeneficiaryEntity.Name)
+	}
+
+	return lookup, resp, nil
+}
@@ -0,0 +1,73 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestLookupKeyCacheAndConfirmation(t *testing.T) {
+	setup()
+	defer teardown()
+
+	calls := 0
+	mux.HandleFunc("/v1/upi/keys/c1@bhojpur.net", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		calls++
+		fmt.Fprint(w, `{"key": "c1@bhojpur.net", "key_type": "email",
+			"institution": {"ispb_code": "19730825", "name": "Bhojpur Bank"},
+			"beneficiary_entity": {"name": "José da Silva", "document_type": "cpf", "document": "52998224725"}}`)
+	})
+	mux.HandleFunc("/v1/upi/outbound_upi_payments", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("payment created despite beneficiary mismatch")
+	})
+
+	lookup, _, err := client.Upi.LookupKey("acc", " C1@bhojpur.net ")
+	if err != nil {
+		t.Fatalf("upi.LookupKey returned error: %v", err)
+	}
+
+	if masked := lookup.BeneficiaryEntity.MaskedDocument(); masked != "***.982.247-**" {
+		t.Errorf("MaskedDocument returned %s, expected ***.982.247-**", masked)
+	}
+
+	if _, _, err := client.Upi.ConfirmBeneficiary("acc", "c1@bhojpur.net", "jose  DA silva"); err != nil {
+		t.Errorf("upi.ConfirmBeneficiary returned error: %v", err)
+	}
+
+	_, _, err = client.Upi.PayKey(context.Background(), "c1@bhojpur.net", UpiPayOptions{
+		PaymentID:               "pay-3",
+		AccountID:               "acc",
+		Amount:                  100,
+		ExpectedBeneficiaryName: "Maria da Silva",
+	})
+	if !errors.Is(err, ErrBeneficiaryMismatch) {
+		t.Errorf("upi.PayKey returned error %v, expected %v", err, ErrBeneficiaryMismatch)
+	}
+
+	if calls != 1 {
+		t.Errorf("key directory was called %d times, expected 1", calls)
+	}
+}
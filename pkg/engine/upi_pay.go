@@ -0,0 +1,345 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/emv"
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// upiPayKeyMaxSize leaves room for the step suffix within the idempotency
+// key limit.
+const upiPayKeyMaxSize = idempotencyKeyMaxSize - 8
+
+// defaultUpiCurrency is used when neither the QR code nor the options set one
+const defaultUpiCurrency = "BRL"
+
+var (
+	ErrQRCodeExpired  = errors.New("qr code expired")
+	ErrAmountMismatch = errors.New("amount differs from the qr code amount")
+	ErrAmountRequired = errors.New("amount is required when the qr code has none")
+	// ErrPaymentIDReused is returned when a saved payment is resumed with
+	// another qr code, key or amount
+	ErrPaymentIDReused = errors.New("payment_id belongs to another payment")
+)
+
+// Steps of an outbound UPI payment, in order
+const (
+	UpiPayStepCreate  = "create"
+	UpiPayStepConfirm = "confirm"
+	UpiPayStepWait    = "wait"
+	UpiPayStepDone    = "done"
+)
+
+// UpiPayOptions configures UpiService.PayQRCode and UpiService.PayKey
+type UpiPayOptions struct {
+	// PaymentID identifies the payment. Every request is sent with an
+	// idempotency key derived from it, so calling again with the same
+	// PaymentID resumes the payment instead of paying twice.
+	PaymentID string
+	AccountID string
+	// Amount in cents. Required when the QR code has no amount; otherwise it
+	// must be zero or equal to the QR code amount.
+	Amount float64
+	// Currency defaults to the QR code currency, or BRL
+	Currency            string
+	Description         string
+	AddTargetToContacts bool
+	// ExpectedBeneficiaryName, when set, makes the payment fail with
+	// ErrBeneficiaryMismatch before anything is created unless the key
+	// belongs to someone with that name
+	ExpectedBeneficiaryName string
+	// Checkpoint, when set, records the progress so a payment interrupted
+	// after being created is resumed from the step where it stopped
+	Checkpoint BatchCheckpoint
+	// Wait configures the polling of the payment after confirmation
+	Wait *WaitOptions
+	// Now returns the current time used to check the QR code expiration,
+	// defaults to time.Now
+	Now func() time.Time
+}
+
+// UpiPayState is the progress of an outbound UPI payment saved to the
+// checkpoint. BRCode is the QR code paid, empty when paying a key.
+type UpiPayState struct {
+	Step    string                           `json:"step"`
+	UpiID   string                           `json:"upi_id,omitempty"`
+	BRCode  string                           `json:"brcode,omitempty"`
+	Input   types.CreatePendingPaymentInput  `json:"input"`
+	Confirm types.ConfirmPendingPaymentInput `json:"confirm"`
+}
+
+// UpiPayError reports the step at which a payment stopped. When UpiID is set
+// the pending payment exists and the call can be retried with the same
+// PaymentID to resume it.
+type UpiPayError struct {
+	Step  string
+	UpiID string
+	Err   error
+}
+
+func (e *UpiPayError) Error() string {
+	if e.UpiID != "" {
+		return fmt.Sprintf("upi payment %s failed at %s: %v", e.UpiID, e.Step, e.Err)
+	}
+	return fmt.Sprintf("upi payment failed at %s: %v", e.Step, e.Err)
+}
+
+func (e *UpiPayError) Unwrap() error {
+	return e.Err
+}
+
+func (o *UpiPayOptions) validate() error {
+	id := strings.TrimSpace(o.PaymentID)
+	if id == "" {
+		return errors.New("payment_id can't be empty")
+	}
+	if len(id) > upiPayKeyMaxSize {
+		return fmt.Errorf("payment_id can't be longer than %d characters", upiPayKeyMaxSize)
+	}
+	if o.AccountID == "" {
+		return errors.New("account_id can't be empty")
+	}
+	if o.Amount < 0 {
+		return errors.New("amount can't be negative")
+	}
+	return nil
+}
+
+func (o *UpiPayOptions) idempotencyKey(step string) string {
+	return strings.TrimSpace(o.PaymentID) + "-" + step
+}
+
+// PayQRCode pays a UPI QR code. The payload is decoded locally, resolved with
+// GetQRCodeData, checked for expiration and amount, then created, confirmed
+// and polled until it reaches a terminal status.
+func (s *UpiService) PayQRCode(ctx context.Context, brcode string, opts UpiPayOptions) (*types.UPIOutBoundOutput, *Response, error) {
+	if err := opts.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if state, ok := s.loadPayState(opts); ok {
+		if state.BRCode != strings.TrimSpace(brcode) || (opts.Amount != 0 && opts.Amount != state.Input.Amount) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrPaymentIDReused, opts.PaymentID)
+		}
+		return s.pay(ctx, state, opts)
+	}
+
+	payload, err := emv.Decode(brcode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qrcode, resp, err := s.GetQRCodeData(types.GetQRCodeInput{
+		BRCode:       strings.TrimSpace(brcode),
+		OwnerAccount: opts.AccountID,
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+
+	key, txnID, currency, amount := qrcode.Static.Key, qrcode.Static.TxnID, qrcode.Static.Currency, qrcode.Static.Amount
+	if qrcode.Type == types.QRCodeTypeDynamic {
+		key, txnID, currency, amount = qrcode.Dynamic.Key, qrcode.Dynamic.TxnID, qrcode.Dynamic.Currency, qrcode.Dynamic.Amount
+
+		now := time.Now
+		if opts.Now != nil {
+			now = opts.Now
+		}
+		if qrcode.Dynamic.Expired(now()) {
+			return nil, resp, ErrQRCodeExpired
+		}
+	}
+
+	switch {
+	case amount == 0 && opts.Amount == 0:
+		return nil, resp, ErrAmountRequired
+	case amount != 0 && opts.Amount != 0 && amount != opts.Amount:
+		return nil, resp, fmt.Errorf("%w: %.0f instead of %.0f", ErrAmountMismatch, opts.Amount, amount)
+	case amount == 0:
+		amount = opts.Amount
+	}
+
+	if key == "" {
+		key = payload.Key
+	}
+
+	if opts.ExpectedBeneficiaryName != "" {
+		_, resp, err := s.ConfirmBeneficiary(opts.AccountID, key, opts.ExpectedBeneficiaryName)
+		if err != nil {
+			return nil, resp, err
+		}
+	}
+	if opts.Currency == "" {
+		opts.Currency = currency
+	}
+	if opts.Currency == "" {
+		opts.Currency = payload.Currency
+	}
+
+	state := newUpiPayState(opts, key, amount)
+	state.BRCode = strings.TrimSpace(brcode)
+	state.Input.TransactionID = txnID
+
+	return s.pay(ctx, state, opts)
+}
+
+// PayKey pays amount to a UPI key, following the same steps as PayQRCode.
+func (s *UpiService) PayKey(ctx context.Context, key string, opts UpiPayOptions) (*types.UPIOutBoundOutput, *Response, error) {
+	if err := opts.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if state, ok := s.loadPayState(opts); ok {
+		if state.BRCode != "" || state.Input.Key != strings.TrimSpace(key) || state.Input.Amount != opts.Amount {
+			return nil, nil, fmt.Errorf("%w: %s", ErrPaymentIDReused, opts.PaymentID)
+		}
+		return s.pay(ctx, state, opts)
+	}
+
+	if strings.TrimSpace(key) == "" {
+		return nil, nil, errors.New("key can't be empty")
+	}
+	if opts.Amount <= 0 {
+		return nil, nil, errors.New("amount must be greater than zero")
+	}
+
+	if opts.ExpectedBeneficiaryName != "" {
+		_, resp, err := s.ConfirmBeneficiary(opts.AccountID, key, opts.ExpectedBeneficiaryName)
+		if err != nil {
+			return nil, resp, err
+		}
+	}
+
+	return s.pay(ctx, newUpiPayState(opts, strings.TrimSpace(key), opts.Amount), opts)
+}
+
+func newUpiPayState(opts UpiPayOptions, key string, amount float64) *UpiPayState {
+	if opts.Currency == "" {
+		opts.Currency = defaultUpiCurrency
+	}
+
+	return &UpiPayState{
+		Step: UpiPayStepCreate,
+		Input: types.CreatePendingPaymentInput{
+			AccountID:   opts.AccountID,
+			Currency:    opts.Currency,
+			Amount:      amount,
+			Description: opts.Description,
+			Key:         key,
+		},
+		Confirm: types.ConfirmPendingPaymentInput{
+			Currency:            opts.Currency,
+			Amount:              amount,
+			Description:         opts.Description,
+			AddTargetToContacts: opts.AddTargetToContacts,
+		},
+	}
+}
+
+func (s *UpiService) loadPayState(opts UpiPayOptions) (*UpiPayState, bool) {
+	if opts.Checkpoint == nil {
+		return nil, false
+	}
+
+	raw, ok := opts.Checkpoint.Load(opts.idempotencyKey("state"))
+	if !ok {
+		return nil, false
+	}
+
+	var state UpiPayState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, false
+	}
+	return &state, true
+}
+
+func (s *UpiService) savePayState(state *UpiPayState, opts UpiPayOptions) error {
+	if opts.Checkpoint == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return opts.Checkpoint.Save(opts.idempotencyKey("state"), raw)
+}
+
+// pay runs the remaining steps of state, saving it after each one.
+func (s *UpiService) pay(ctx context.Context, state *UpiPayState, opts UpiPayOptions) (*types.UPIOutBoundOutput, *Response, error) {
+	fail := func(resp *Response, err error) (*types.UPIOutBoundOutput, *Response, error) {
+		return nil, resp, &UpiPayError{Step: state.Step, UpiID: state.UpiID, Err: err}
+	}
+
+	next := func(step string) error {
+		state.Step = step
+		return s.savePayState(state, opts)
+	}
+
+	if err := s.savePayState(state, opts); err != nil {
+		return fail(nil, err)
+	}
+
+	if state.Step == UpiPayStepCreate {
+		pending, resp, err := s.CreatePendingPayment(state.Input, opts.idempotencyKey(UpiPayStepCreate))
+		if err != nil {
+			return fail(resp, err)
+		}
+
+		state.UpiID = pending.ID
+		if err := next(UpiPayStepConfirm); err != nil {
+			return fail(resp, err)
+		}
+	}
+
+	if state.Step == UpiPayStepConfirm {
+		resp, err := s.ConfirmPendingPayment(state.Confirm, opts.idempotencyKey(UpiPayStepConfirm), state.UpiID)
+		if err != nil {
+			return fail(resp, err)
+		}
+
+		if err := next(UpiPayStepWait); err != nil {
+			return fail(resp, err)
+		}
+	}
+
+	upi, resp, err := s.WaitOutbound(ctx, state.UpiID, opts.Wait)
+	if err != nil {
+		if upi != nil {
+			return upi, resp, &UpiPayError{Step: state.Step, UpiID: state.UpiID, Err: err}
+		}
+		return fail(resp, err)
+	}
+
+	if err := next(UpiPayStepDone); err != nil {
+		return upi, resp, &UpiPayError{Step: state.Step, UpiID: state.UpiID, Err: err}
+	}
+
+	return upi, resp, nil
+}
@@ -0,0 +1,123 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUpiPayKeyResume(t *testing.T) {
+	setup()
+	defer teardown()
+
+	creates, confirms := 0, 0
+	mux.HandleFunc("/v1/upi/outbound_upi_payments", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		if key := r.Header.Get("x-bhojpur-idempotency-key"); key != "pay-1-create" {
+			t.Errorf("create sent idempotency key %q, expected pay-1-create", key)
+		}
+		creates++
+		fmt.Fprint(w, `{"id": "abc123", "status": "CREATED"}`)
+	})
+	mux.HandleFunc("/v1/upi/outbound_upi_payments/abc123/actions/confirm", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		confirms++
+		if confirms == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	})
+	mux.HandleFunc("/v1/upi/outbound_upi_payments/abc123", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "abc123", "status": "SETTLED", "amount": 1500}`)
+	})
+
+	opts := UpiPayOptions{
+		PaymentID:  "pay-1",
+		AccountID:  "acc",
+		Amount:     1500,
+		Checkpoint: NewMemoryCheckpoint(),
+		Wait:       &WaitOptions{Interval: time.Millisecond},
+	}
+
+	_, _, err := client.Upi.PayKey(context.Background(), "c1@bhojpur.net", opts)
+	var payErr *UpiPayError
+	if !errors.As(err, &payErr) || payErr.Step != UpiPayStepConfirm || payErr.UpiID != "abc123" {
+		t.Fatalf("upi.PayKey returned error %v, expected failure at confirm of abc123", err)
+	}
+
+	upi, _, err := client.Upi.PayKey(context.Background(), "c1@bhojpur.net", opts)
+	if err != nil {
+		t.Fatalf("upi.PayKey returned error on resume: %v", err)
+	}
+
+	if upi.Status != "SETTLED" || creates != 1 || confirms != 2 {
+		t.Errorf("upi.PayKey returned %s after %d creates and %d confirms, expected SETTLED, 1 and 2", upi.Status, creates, confirms)
+	}
+}
+
+func TestUpiPayResumeMismatch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi/outbound_upi_payments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	opts := UpiPayOptions{PaymentID: "pay-3", AccountID: "acc", Amount: 1500, Checkpoint: NewMemoryCheckpoint()}
+	if _, _, err := client.Upi.PayKey(context.Background(), "c1@bhojpur.net", opts); err == nil {
+		t.Fatal("upi.PayKey returned no error with the API down")
+	}
+
+	const brcode = "00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-4266554400005204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***63041D3D"
+	if _, _, err := client.Upi.PayQRCode(context.Background(), brcode, opts); !errors.Is(err, ErrPaymentIDReused) {
+		t.Errorf("upi.PayQRCode returned error %v, expected %v", err, ErrPaymentIDReused)
+	}
+
+	if _, _, err := client.Upi.PayKey(context.Background(), "c2@bhojpur.net", opts); !errors.Is(err, ErrPaymentIDReused) {
+		t.Errorf("upi.PayKey with another key returned error %v, expected %v", err, ErrPaymentIDReused)
+	}
+
+	opts.Amount = 2000
+	if _, _, err := client.Upi.PayKey(context.Background(), "c1@bhojpur.net", opts); !errors.Is(err, ErrPaymentIDReused) {
+		t.Errorf("upi.PayKey with another amount returned error %v, expected %v", err, ErrPaymentIDReused)
+	}
+}
+
+func TestUpiPayQRCodeAmountMismatch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v1/upi/outbound_upi_payments/brcodes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "static", "static": {"key": "c1@bhojpur.net", "amount": 1000}}`)
+	})
+
+	const brcode = "00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-4266554400005204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***63041D3D"
+
+	_, _, err := client.Upi.PayQRCode(context.Background(), brcode, UpiPayOptions{PaymentID: "pay-2", AccountID: "acc", Amount: 500})
+	if !errors.Is(err, ErrAmountMismatch) {
+		t.Errorf("upi.PayQRCode returned error %v, expected %v", err, ErrAmountMismatch)
+	}
+}
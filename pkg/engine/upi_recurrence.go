@@ -0,0 +1,293 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// CreateRecurrence sends a recurring payment authorisation request to the
+// payer. It starts as PENDING_APPROVAL until the payer answers in their bank.
+func (s *UpiService) CreateRecurrence(input types.UpiRecurrenceInput, idempotencyKey string) (*types.UpiRecurrence, *Response, error) {
+	const path = "/v1/upi/recurrences"
+
+	if err := input.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, input.AccountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recurrence types.UpiRecurrence
+	resp, err := s.client.Do(req, &recurrence)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &recurrence, resp, err
+}
+
+// GetRecurrence retrieves a recurring payment authorisation
+func (s *UpiService) GetRecurrence(accountID, id string) (*types.UpiRecurrence, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/recurrences/%s", id)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recurrence types.UpiRecurrence
+	resp, err := s.client.Do(req, &recurrence)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &recurrence, resp, err
+}
+
+// ListRecurrences lists the recurring payment authorisations of an account,
+// optionally only those in status
+func (s *UpiService) ListRecurrences(accountID string, status types.UpiRecurrenceStatus) ([]types.UpiRecurrence, *Response, error) {
+	if accountID == "" {
+		return nil, nil, errors.New("account_id can't be empty")
+	}
+
+	const path = "/v1/upi/recurrences"
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if status != "" {
+		q := req.URL.Query()
+		q.Add("status", string(status))
+		req.URL.RawQuery = q.Encode()
+	}
+
+	var dataResp struct {
+		Cursor types.Cursor          `json:"cursor"`
+		Data   []types.UpiRecurrence `json:"data"`
+	}
+
+	resp, err := s.client.Do(req, &dataResp)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return dataResp.Data, resp, err
+}
+
+// WaitRecurrenceApproval polls a recurrence until the payer approves or
+// rejects it, or it expires. The last fetched recurrence is returned even
+// when ctx expires first.
+func (s *UpiService) WaitRecurrenceApproval(ctx context.Context, accountID, id string, opts *WaitOptions) (*types.UpiRecurrence, *Response, error) {
+	var last *types.UpiRecurrence
+	resp, err := poll(ctx, opts, func() (bool, *Response, error) {
+		recurrence, resp, err := s.GetRecurrence(accountID, id)
+		if err != nil {
+			return false, resp, err
+		}
+		last = recurrence
+
+		status := types.UpiRecurrenceStatus(recurrence.Status)
+		return status == types.UpiRecurrenceStatusApproved || status.IsTerminal(), resp, nil
+	})
+
+	return last, resp, err
+}
+
+// CancelRecurrence revokes an authorisation. Collections already scheduled
+// against it are cancelled by the API.
+func (s *UpiService) CancelRecurrence(accountID, id string, input types.CancelUpiRecurrenceInput, idempotencyKey string) (*types.UpiRecurrence, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/recurrences/%s/actions/cancel", id)
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recurrence types.UpiRecurrence
+	resp, err := s.client.Do(req, &recurrence)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &recurrence, resp, err
+}
+
+// ScheduleCollection schedules a debit against an approved recurrence. The
+// recurrence and its collections are fetched first so the amount and due
+// date are checked against what the payer authorised. A collection for a
+// period already taken is still sent with an idempotency key, as it may
+// retry the one taking it, and the API decides.
+func (s *UpiService) ScheduleCollection(accountID, recurrenceID string, input types.UpiCollectionInput, idempotencyKey string) (*types.UpiCollection, *Response, error) {
+	recurrence, resp, err := s.GetRecurrence(accountID, recurrenceID)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	existing, resp, err := s.ListCollections(accountID, recurrenceID)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	periodErr := input.Validate(recurrence, existing, types.BankNow())
+	if periodErr != nil && (idempotencyKey == "" || !errors.Is(periodErr, types.ErrCollectionPeriodTaken)) {
+		return nil, nil, periodErr
+	}
+
+	path := fmt.Sprintf("/v1/upi/recurrences/%s/collections", recurrenceID)
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var collection types.UpiCollection
+	resp, err = s.client.Do(req, &collection)
+	if err != nil {
+		if periodErr != nil {
+			return nil, resp, periodErr
+		}
+		return nil, resp, err
+	}
+
+	return &collection, resp, err
+}
+
+// ListCollections lists the collections scheduled against a recurrence
+func (s *UpiService) ListCollections(accountID, recurrenceID string) ([]types.UpiCollection, *Response, error) {
+	if recurrenceID == "" {
+		return nil, nil, errors.New("recurrence_id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/recurrences/%s/collections", recurrenceID)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dataResp struct {
+		Cursor types.Cursor          `json:"cursor"`
+		Data   []types.UpiCollection `json:"data"`
+	}
+
+	resp, err := s.client.Do(req, &dataResp)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return dataResp.Data, resp, err
+}
+
+// CancelCollection cancels a scheduled collection before its due date
+func (s *UpiService) CancelCollection(accountID, recurrenceID, collectionID, idempotencyKey string) (*types.UpiCollection, *Response, error) {
+	if recurrenceID == "" || collectionID == "" {
+		return nil, nil, errors.New("recurrence_id and collection_id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/recurrences/%s/collections/%s/actions/cancel", recurrenceID, collectionID)
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddAccountIdHeader(req, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var collection types.UpiCollection
+	resp, err := s.client.Do(req, &collection)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &collection, resp, err
+}
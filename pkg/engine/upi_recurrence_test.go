@@ -0,0 +1,107 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestScheduleCollection(t *testing.T) {
+	setup()
+	defer teardown()
+
+	due := types.NewDate(types.BankNow().AddDate(0, 0, 3))
+	start, _ := due.AddDays(-14)
+	mux.HandleFunc("/v1/upi/recurrences/rec1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id": "rec1", "status": "APPROVED", "max_amount": 5000,
+			"recurrence": {"startDate": %q, "frequency": "WEEKLY", "interval": 2}}`, start)
+	})
+
+	collections := []string{fmt.Sprintf(`{"id": "col0", "due_date": %q, "status": "CANCELLED"}`, due)}
+	byKey := map[string]string{}
+	posts := 0
+	mux.HandleFunc("/v1/upi/recurrences/rec1/collections", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"data": [%s]}`, strings.Join(collections, ","))
+			return
+		}
+
+		testMethod(t, r, http.MethodPost)
+		posts++
+		key := r.Header.Get("x-bhojpur-idempotency-key")
+		if collection, ok := byKey[key]; ok {
+			fmt.Fprint(w, collection)
+			return
+		}
+		collection := fmt.Sprintf(`{"id": "col1", "recurrence_id": "rec1", "amount": 4500, "due_date": %q, "status": "SCHEDULED"}`, due)
+		collections = append(collections, collection)
+		byKey[key] = collection
+		fmt.Fprint(w, collection)
+	})
+
+	_, _, err := client.Upi.ScheduleCollection("acc", "rec1", types.UpiCollectionInput{Amount: 6000, DueDate: due}, "key")
+	if err == nil {
+		t.Error("upi.ScheduleCollection accepted an amount above max_amount")
+	}
+
+	_, _, err = client.Upi.ScheduleCollection("acc", "rec1", types.UpiCollectionInput{Amount: 4500, DueDate: types.NewDate(time.Now().AddDate(0, 1, 0))}, "key")
+	if err == nil {
+		t.Error("upi.ScheduleCollection accepted a due date beyond the horizon")
+	}
+
+	offCycle, _ := due.AddDays(1)
+	_, _, err = client.Upi.ScheduleCollection("acc", "rec1", types.UpiCollectionInput{Amount: 4500, DueDate: offCycle}, "key")
+	if err == nil {
+		t.Error("upi.ScheduleCollection accepted a due date between occurrences")
+	}
+
+	collection, _, err := client.Upi.ScheduleCollection("acc", "rec1", types.UpiCollectionInput{Amount: 4500, DueDate: due}, "key")
+	if err != nil {
+		t.Fatalf("upi.ScheduleCollection returned error: %v", err)
+	}
+
+	if collection.ID != "col1" || collection.Status != string(types.UpiCollectionStatusScheduled) {
+		t.Errorf("upi.ScheduleCollection returned %+v, expected scheduled col1", collection)
+	}
+
+	_, _, err = client.Upi.ScheduleCollection("acc", "rec1", types.UpiCollectionInput{Amount: 4500, DueDate: due}, "")
+	if !errors.Is(err, types.ErrCollectionPeriodTaken) {
+		t.Errorf("upi.ScheduleCollection returned error %v, expected %v", err, types.ErrCollectionPeriodTaken)
+	}
+	if posts != 1 {
+		t.Errorf("upi.ScheduleCollection sent %d collections, expected 1", posts)
+	}
+
+	retry, _, err := client.Upi.ScheduleCollection("acc", "rec1", types.UpiCollectionInput{Amount: 4500, DueDate: due}, "key")
+	if err != nil {
+		t.Fatalf("upi.ScheduleCollection retry returned error: %v", err)
+	}
+	if retry.ID != collection.ID {
+		t.Errorf("upi.ScheduleCollection retry returned %+v, expected %+v", retry, collection)
+	}
+}
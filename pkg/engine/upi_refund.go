@@ -0,0 +1,183 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+// RefundInbound returns all or part of a received UPI payment to the payer.
+// The refund is refused locally when, added to the refunds already issued,
+// it would exceed the payment amount. With an idempotency key it is sent
+// anyway, as it may retry a refund already counted, and the API decides.
+func (s *UpiService) RefundInbound(id string, input types.CreateUpiRefundInput, idempotencyKey string) (*types.UpiRefund, *Response, error) {
+	upi, resp, err := s.GetInbound(id)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return s.refund("inbound_upi_payments", id, upi.Amount, upi.RefundedAmount, input, idempotencyKey)
+}
+
+// RefundOutbound requests the return of all or part of a sent UPI payment,
+// with the same cumulative limit as RefundInbound.
+func (s *UpiService) RefundOutbound(id string, input types.CreateUpiRefundInput, idempotencyKey string) (*types.UpiRefund, *Response, error) {
+	upi, resp, err := s.GetOutboundUpi(id)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return s.refund("outbound_upi_payments", id, upi.Amount, upi.RefundedAmount, input, idempotencyKey)
+}
+
+// ListInboundRefunds lists the refunds of a received UPI payment
+func (s *UpiService) ListInboundRefunds(id string) ([]types.UpiRefund, *Response, error) {
+	return s.listRefunds("inbound_upi_payments", id)
+}
+
+// ListOutboundRefunds lists the refunds of a sent UPI payment
+func (s *UpiService) ListOutboundRefunds(id string) ([]types.UpiRefund, *Response, error) {
+	return s.listRefunds("outbound_upi_payments", id)
+}
+
+// GetRefund retrieves a refund by its id
+func (s *UpiService) GetRefund(refundID string) (*types.UpiRefund, *Response, error) {
+	if refundID == "" {
+		return nil, nil, errors.New("refund_id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/refunds/%s", refundID)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var refund types.UpiRefund
+	resp, err := s.client.Do(req, &refund)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &refund, resp, err
+}
+
+// WaitRefund polls a refund until it is settled or failed. The last fetched
+// refund is returned even when ctx expires first.
+func (s *UpiService) WaitRefund(ctx context.Context, refundID string, opts *WaitOptions) (*types.UpiRefund, *Response, error) {
+	if refundID == "" {
+		return nil, nil, errors.New("refund_id can't be empty")
+	}
+
+	var last *types.UpiRefund
+	resp, err := poll(ctx, opts, func() (bool, *Response, error) {
+		refund, resp, err := s.GetRefund(refundID)
+		if err != nil {
+			return false, resp, err
+		}
+
+		if last != nil && types.UpiRefundStatus(last.Status).IsTerminal() && last.Status != refund.Status {
+			return false, resp, fmt.Errorf("%w: %s -> %s", ErrUnexpectedTransition, last.Status, refund.Status)
+		}
+		last = refund
+
+		return types.UpiRefundStatus(refund.Status).IsTerminal(), resp, nil
+	})
+
+	return last, resp, err
+}
+
+func (s *UpiService) refund(resource, id string, amount, refunded float64, input types.CreateUpiRefundInput, idempotencyKey string) (*types.UpiRefund, *Response, error) {
+	// Refunds still in flight are not part of refunded_amount yet
+	refunds, resp, err := s.listRefunds(resource, id)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	issued := 0.0
+	for _, r := range refunds {
+		if r.Status != string(types.UpiRefundStatusFailed) {
+			issued += r.Amount
+		}
+	}
+	if issued > refunded {
+		refunded = issued
+	}
+
+	limitErr := input.Validate(amount, refunded)
+	if limitErr != nil && (idempotencyKey == "" || !errors.Is(limitErr, types.ErrRefundExceedsAmount)) {
+		return nil, nil, limitErr
+	}
+
+	path := fmt.Sprintf("/v1/upi/%s/%s/refunds", resource, id)
+
+	req, err := s.client.NewAPIRequest(http.MethodPost, path, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.client.AddIdempotencyHeader(req, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var refund types.UpiRefund
+	resp, err = s.client.Do(req, &refund)
+	if err != nil {
+		// A rejected retry is reported with the local reason
+		if limitErr != nil {
+			return nil, resp, limitErr
+		}
+		return nil, resp, err
+	}
+
+	return &refund, resp, err
+}
+
+func (s *UpiService) listRefunds(resource, id string) ([]types.UpiRefund, *Response, error) {
+	if id == "" {
+		return nil, nil, errors.New("id can't be empty")
+	}
+
+	path := fmt.Sprintf("/v1/upi/%s/%s/refunds", resource, id)
+
+	req, err := s.client.NewAPIRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dataResp struct {
+		Cursor types.Cursor      `json:"cursor"`
+		Data   []types.UpiRefund `json:"data"`
+	}
+
+	resp, err := s.client.Do(req, &dataResp)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return dataResp.Data, resp, err
+}
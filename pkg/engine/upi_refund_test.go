@@ -0,0 +1,116 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+func TestRefundInboundCumulativeLimit(t *testing.T) {
+	setup()
+	defer teardown()
+
+	refunds := []string{
+		`{"id": "r1", "amount": 300, "status": "SETTLED"}`,
+		`{"id": "r2", "amount": 500, "status": "CREATED"}`,
+		`{"id": "r3", "amount": 100, "status": "FAILED"}`,
+	}
+	byKey := map[string]string{}
+	posts := 0
+
+	mux.HandleFunc("/v1/upi/inbound_upi_payments/abc123", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "abc123", "amount": 1000, "refunded_amount": 300, "status": "PARTIALLY_REFUNDED"}`)
+	})
+	mux.HandleFunc("/v1/upi/inbound_upi_payments/abc123/refunds", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"data": [%s]}`, strings.Join(refunds, ","))
+			return
+		}
+
+		posts++
+		key := r.Header.Get("x-bhojpur-idempotency-key")
+		if refund, ok := byKey[key]; ok {
+			fmt.Fprint(w, refund)
+			return
+		}
+
+		var input types.CreateUpiRefundInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Error(err)
+			return
+		}
+		remaining := 200.0
+		if len(byKey) > 0 {
+			remaining = 0
+		}
+		if input.Amount == 0 {
+			input.Amount = remaining
+		}
+		if remaining == 0 || input.Amount > remaining {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"type": "REFUND_EXCEEDS_AMOUNT"}`)
+			return
+		}
+
+		refund := fmt.Sprintf(`{"id": "r4", "amount": %v, "reason_code": %q, "status": "CREATED"}`, input.Amount, input.ReasonCode)
+		refunds = append(refunds, refund)
+		byKey[key] = refund
+		fmt.Fprint(w, refund)
+	})
+
+	_, _, err := client.Upi.RefundInbound("abc123", types.CreateUpiRefundInput{Amount: 300, ReasonCode: "MD06"}, "")
+	if !errors.Is(err, types.ErrRefundExceedsAmount) {
+		t.Errorf("upi.RefundInbound returned error %v, expected %v", err, types.ErrRefundExceedsAmount)
+	}
+	if posts != 0 {
+		t.Errorf("upi.RefundInbound sent a refund over the limit without an idempotency key")
+	}
+
+	_, _, err = client.Upi.RefundInbound("abc123", types.CreateUpiRefundInput{Amount: 300, ReasonCode: "MD06"}, "over")
+	if !errors.Is(err, types.ErrRefundExceedsAmount) {
+		t.Errorf("upi.RefundInbound returned error %v, expected %v", err, types.ErrRefundExceedsAmount)
+	}
+
+	refund, _, err := client.Upi.RefundInbound("abc123", types.CreateUpiRefundInput{ReasonCode: "MD06"}, "key")
+	if err != nil {
+		t.Fatalf("upi.RefundInbound returned error: %v", err)
+	}
+	if refund.Amount != 200 {
+		t.Errorf("upi.RefundInbound refunded %v, expected the remaining 200", refund.Amount)
+	}
+
+	// The response was lost: the retry counts r4 as issued but must still
+	// return it rather than fail locally
+	retry, _, err := client.Upi.RefundInbound("abc123", types.CreateUpiRefundInput{ReasonCode: "MD06"}, "key")
+	if err != nil {
+		t.Fatalf("upi.RefundInbound retry returned error: %v", err)
+	}
+	if retry.ID != refund.ID || retry.Amount != refund.Amount {
+		t.Errorf("upi.RefundInbound retry returned %+v, expected %+v", retry, refund)
+	}
+}
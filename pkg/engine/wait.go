@@ -0,0 +1,118 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultWaitInterval    = time.Second
+	defaultWaitMaxInterval = 30 * time.Second
+	defaultWaitMultiplier  = 2
+)
+
+// ErrUnexpectedTransition is returned while waiting when the API reports a
+// status that cannot follow the previously observed one.
+var ErrUnexpectedTransition = errors.New("unexpected status transition")
+
+// WaitOptions controls how a resource is polled until it reaches a terminal
+// status. Zero values are replaced by defaults; use the context to bound the
+// total wait.
+type WaitOptions struct {
+	// External selects the external transfers endpoint in TransferService.Wait
+	External bool
+
+	Interval    time.Duration
+	MaxInterval time.Duration
+	Multiplier  float64
+}
+
+func (o *WaitOptions) withDefaults() WaitOptions {
+	var opts WaitOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultWaitInterval
+	}
+	if opts.MaxInterval < opts.Interval {
+		opts.MaxInterval = defaultWaitMaxInterval
+		if opts.MaxInterval < opts.Interval {
+			opts.MaxInterval = opts.Interval
+		}
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = defaultWaitMultiplier
+	}
+	return opts
+}
+
+// poll calls fn with exponential backoff until it reports done, returns a
+// non retryable error or ctx is done.
+func poll(ctx context.Context, o *WaitOptions, fn func() (bool, *Response, error)) (*Response, error) {
+	opts := o.withDefaults()
+	interval := opts.Interval
+
+	for {
+		done, resp, err := fn()
+		if err != nil && !retryable(resp, err) {
+			return resp, err
+		}
+		if done {
+			return resp, nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if err != nil {
+				return resp, fmt.Errorf("%v: %w", ctx.Err(), err)
+			}
+			return resp, ctx.Err()
+		case <-timer.C:
+		}
+
+		interval = time.Duration(float64(interval) * opts.Multiplier)
+		if interval > opts.MaxInterval {
+			interval = opts.MaxInterval
+		}
+	}
+}
+
+// retryable reports whether a failed poll should be attempted again. Network
+// errors, rate limiting and server side errors are considered transient.
+func retryable(resp *Response, err error) bool {
+	if errors.Is(err, ErrUnexpectedTransition) {
+		return false
+	}
+	if resp == nil || resp.Response == nil {
+		var urlErr *url.Error
+		return errors.As(err, &urlErr)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
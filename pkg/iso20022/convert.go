@@ -0,0 +1,225 @@
+package iso20022
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/bhojpur/bank/pkg/engine"
+	"github.com/bhojpur/bank/pkg/types"
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
+// InstitutionResolver looks up an institution by ISPB or compe code. It is
+// satisfied by engine.InstitutionService.
+type InstitutionResolver interface {
+	Get(code string) (*types.Institution, *engine.Response, error)
+}
+
+// Batch holds the transfers of one PmtInf block
+type Batch struct {
+	MessageID            string
+	PaymentInformationID string
+	Instructions         []Instruction
+}
+
+// Instruction is a single CdtTrfTxInf converted to a transfer. Err is set
+// when the transaction could not be converted or failed validation.
+type Instruction struct {
+	InstructionID string
+	EndToEndID    string
+	Input         types.TransferInput
+	Err           error
+}
+
+// ID returns the identifier used for the batch in TransferBatchOptions
+func (b *Batch) ID() string {
+	return b.MessageID + "/" + b.PaymentInformationID
+}
+
+// Inputs returns the transfers of the instructions without errors, in order
+func (b *Batch) Inputs() []types.TransferInput {
+	var inputs []types.TransferInput
+	for _, instr := range b.Instructions {
+		if instr.Err == nil {
+			inputs = append(inputs, instr.Input)
+		}
+	}
+	return inputs
+}
+
+// Convert turns every PmtInf of doc into a batch of transfers. Creditor
+// agents are resolved through resolver; transactions without a creditor
+// agent, or whose agent is Bhojpur Bank, become internal transfers.
+func Convert(doc *Document, resolver InstitutionResolver) ([]Batch, error) {
+	if resolver == nil {
+		return nil, errors.New("institution resolver can't be nil")
+	}
+
+	institutions := make(map[string]*types.Institution)
+	resolve := func(code string) (*types.Institution, error) {
+		if institution, ok := institutions[code]; ok {
+			return institution, nil
+		}
+		institution, _, err := resolver.Get(code)
+		if err != nil {
+			return nil, fmt.Errorf("unknown institution %s: %w", code, err)
+		}
+		institutions[code] = institution
+		return institution, nil
+	}
+
+	today := types.NewDate(types.BankNow())
+
+	var batches []Batch
+	for _, pmtInf := range doc.CstmrCdtTrfInitn.PmtInf {
+		if mtd := strings.TrimSpace(pmtInf.PmtMtd); mtd != "" && mtd != "TRF" {
+			return nil, fmt.Errorf("PmtInf %s: unsupported PmtMtd %q", pmtInf.PmtInfId, mtd)
+		}
+
+		accountID := strings.TrimSpace(pmtInf.DbtrAcct.Id.Othr.Id)
+
+		var scheduledTo types.Date
+		if date := pmtInf.ReqdExctnDt.Date(); date != "" {
+			d, err := types.ParseDate(date)
+			if err != nil {
+				return nil, fmt.Errorf("PmtInf %s: ReqdExctnDt: %w", pmtInf.PmtInfId, err)
+			}
+			if today.Before(d) {
+				scheduledTo = d
+			}
+		}
+
+		batch := Batch{
+			MessageID:            doc.CstmrCdtTrfInitn.GrpHdr.MsgId,
+			PaymentInformationID: pmtInf.PmtInfId,
+		}
+
+		for _, tx := range pmtInf.CdtTrfTxInf {
+			instr := Instruction{
+				InstructionID: tx.PmtId.InstrId,
+				EndToEndID:    tx.PmtId.EndToEndId,
+			}
+
+			input, err := convertTransaction(tx, resolve)
+			if err == nil {
+				input.AccountID = accountID
+				input.ScheduledTo = scheduledTo
+				err = input.Validate()
+			}
+			instr.Input = input
+			instr.Err = err
+
+			batch.Instructions = append(batch.Instructions, instr)
+		}
+
+		batches = append(batches, batch)
+	}
+
+	return batches, nil
+}
+
+func convertTransaction(tx CreditTransferTransaction, resolve func(string) (*types.Institution, error)) (types.TransferInput, error) {
+	var input types.TransferInput
+
+	amount, err := cents(tx.Amt.InstdAmt.Value)
+	if err != nil {
+		return input, err
+	}
+	input.Amount = amount
+	input.Currency = strings.TrimSpace(tx.Amt.InstdAmt.Ccy)
+	input.Description = strings.TrimSpace(strings.Join(tx.RmtInf.Ustrd, " "))
+
+	input.Target.Account.AccountCode = strings.TrimSpace(tx.CdtrAcct.Id.Othr.Id)
+	input.Target.Account.AccountType = accountType(tx.CdtrAcct.Tp)
+
+	code := strings.TrimSpace(tx.CdtrAgt.FinInstnId.ClrSysMmbId.MmbId)
+	if code == "" && (tx.CdtrAgt.FinInstnId.BIC != "" || tx.CdtrAgt.FinInstnId.BICFI != "") {
+		return input, errors.New("creditor agent must be identified by ClrSysMmbId, BIC is not supported")
+	}
+	if code == "" || code == engine.BhojpurISPBCode {
+		return input, nil
+	}
+
+	institution, err := resolve(code)
+	if err != nil {
+		return input, err
+	}
+
+	input.Target.Account.BranchCode = strings.TrimSpace(tx.CdtrAgt.BrnchId.Id)
+	input.Target.Account.InstitutionISPB = institution.ISPBCode
+	input.Target.Account.InstitutionName = institution.Name
+	input.Target.Account.InstitutionNumberCode = institution.NumberCode
+	input.Target.Account.InstitutionCode = institution.NumberCode
+	if input.Target.Account.InstitutionCode == "" {
+		input.Target.Account.InstitutionCode = institution.ISPBCode
+	}
+
+	document := partyDocument(tx.Cdtr.Id)
+	input.Target.Entity = types.Entity{
+		Name:         strings.TrimSpace(tx.Cdtr.Nm),
+		Document:     document,
+		DocumentType: validation.DocumentTypeOf(document),
+	}
+
+	return input, nil
+}
+
+// cents converts a decimal amount in major units to the cents used by the
+// API without going through floating point.
+func cents(value string) (float64, error) {
+	amount, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok || amount.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+
+	amount.Mul(amount, big.NewRat(100, 1))
+	if !amount.IsInt() {
+		return 0, fmt.Errorf("amount %q has more than 2 decimal places", value)
+	}
+
+	f, _ := amount.Float64()
+	return f, nil
+}
+
+func partyDocument(id PartyIdentifier) string {
+	for _, ids := range [][]GenericIdentification{id.PrvtId.Othr, id.OrgId.Othr} {
+		for _, othr := range ids {
+			if doc := validation.OnlyDigits(othr.Id); doc != "" {
+				return doc
+			}
+		}
+	}
+	return ""
+}
+
+func accountType(tp SchemeName) string {
+	switch strings.ToUpper(strings.TrimSpace(tp.Cd)) {
+	case "CACC":
+		return "checking"
+	case "SVGS":
+		return "savings"
+	}
+	return strings.ToLower(strings.TrimSpace(tp.Prtry))
+}
@@ -0,0 +1,251 @@
+package iso20022
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+const (
+	Pain001V03 = "pain.001.001.03"
+	Pain001V09 = "pain.001.001.09"
+
+	namespacePrefix = "urn:iso:std:iso:20022:tech:xsd:"
+)
+
+// Document is a pain.001 customer credit transfer initiation message. Only
+// the elements needed to initiate transfers are mapped.
+type Document struct {
+	XMLName          xml.Name
+	CstmrCdtTrfInitn CustomerCreditTransferInitiation `xml:"CstmrCdtTrfInitn"`
+}
+
+type CustomerCreditTransferInitiation struct {
+	GrpHdr GroupHeader          `xml:"GrpHdr"`
+	PmtInf []PaymentInformation `xml:"PmtInf"`
+}
+
+type GroupHeader struct {
+	MsgId    string `xml:"MsgId"`
+	CreDtTm  string `xml:"CreDtTm"`
+	NbOfTxs  string `xml:"NbOfTxs"`
+	CtrlSum  string `xml:"CtrlSum"`
+	InitgPty Party  `xml:"InitgPty"`
+}
+
+type PaymentInformation struct {
+	PmtInfId    string                      `xml:"PmtInfId"`
+	PmtMtd      string                      `xml:"PmtMtd"`
+	NbOfTxs     string                      `xml:"NbOfTxs"`
+	CtrlSum     string                      `xml:"CtrlSum"`
+	ReqdExctnDt RequestedDate               `xml:"ReqdExctnDt"`
+	Dbtr        Party                       `xml:"Dbtr"`
+	DbtrAcct    Account                     `xml:"DbtrAcct"`
+	DbtrAgt     Agent                       `xml:"DbtrAgt"`
+	CdtTrfTxInf []CreditTransferTransaction `xml:"CdtTrfTxInf"`
+}
+
+// RequestedDate is a plain date in pain.001.001.03 and a choice between Dt
+// and DtTm in later versions.
+type RequestedDate struct {
+	Value string `xml:",chardata"`
+	Dt    string `xml:"Dt"`
+	DtTm  string `xml:"DtTm"`
+}
+
+// Date returns the requested execution date as YYYY-MM-DD
+func (d RequestedDate) Date() string {
+	switch {
+	case strings.TrimSpace(d.Dt) != "":
+		return strings.TrimSpace(d.Dt)
+	case len(strings.TrimSpace(d.DtTm)) >= 10:
+		return strings.TrimSpace(d.DtTm)[:10]
+	}
+	return strings.TrimSpace(d.Value)
+}
+
+type CreditTransferTransaction struct {
+	PmtId    PaymentIdentification `xml:"PmtId"`
+	Amt      AmountType            `xml:"Amt"`
+	CdtrAgt  Agent                 `xml:"CdtrAgt"`
+	Cdtr     Party                 `xml:"Cdtr"`
+	CdtrAcct Account               `xml:"CdtrAcct"`
+	RmtInf   RemittanceInformation `xml:"RmtInf"`
+}
+
+type PaymentIdentification struct {
+	InstrId    string `xml:"InstrId"`
+	EndToEndId string `xml:"EndToEndId"`
+}
+
+type AmountType struct {
+	InstdAmt Amount `xml:"InstdAmt"`
+}
+
+type Amount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type Agent struct {
+	FinInstnId FinancialInstitutionIdentification `xml:"FinInstnId"`
+	BrnchId    BranchIdentification               `xml:"BrnchId"`
+}
+
+type FinancialInstitutionIdentification struct {
+	BIC         string                             `xml:"BIC"`
+	BICFI       string                             `xml:"BICFI"`
+	ClrSysMmbId ClearingSystemMemberIdentification `xml:"ClrSysMmbId"`
+	Nm          string                             `xml:"Nm"`
+}
+
+type ClearingSystemMemberIdentification struct {
+	MmbId string `xml:"MmbId"`
+}
+
+type BranchIdentification struct {
+	Id string `xml:"Id"`
+}
+
+type Party struct {
+	Nm string          `xml:"Nm"`
+	Id PartyIdentifier `xml:"Id"`
+}
+
+type PartyIdentifier struct {
+	OrgId  GenericIdentifiers `xml:"OrgId"`
+	PrvtId GenericIdentifiers `xml:"PrvtId"`
+}
+
+type GenericIdentifiers struct {
+	Othr []GenericIdentification `xml:"Othr"`
+}
+
+type GenericIdentification struct {
+	Id      string     `xml:"Id"`
+	SchmeNm SchemeName `xml:"SchmeNm"`
+}
+
+type SchemeName struct {
+	Cd    string `xml:"Cd"`
+	Prtry string `xml:"Prtry"`
+}
+
+type Account struct {
+	Id AccountIdentification `xml:"Id"`
+	Tp SchemeName            `xml:"Tp"`
+}
+
+type AccountIdentification struct {
+	IBAN string                `xml:"IBAN"`
+	Othr GenericIdentification `xml:"Othr"`
+}
+
+type RemittanceInformation struct {
+	Ustrd []string `xml:"Ustrd"`
+}
+
+// Version returns the message definition, for example pain.001.001.03
+func (d *Document) Version() string {
+	return strings.TrimPrefix(d.XMLName.Space, namespacePrefix)
+}
+
+// Parse reads a pain.001.001.03 or pain.001.001.09 document and checks the
+// declared transaction counts and control sums.
+func Parse(r io.Reader) (*Document, error) {
+	var doc Document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid pain.001 document: %w", err)
+	}
+
+	switch doc.Version() {
+	case Pain001V03, Pain001V09:
+	default:
+		return nil, fmt.Errorf("unsupported message %q", doc.XMLName.Space)
+	}
+
+	if err := doc.check(); err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+func (d *Document) check() error {
+	initn := d.CstmrCdtTrfInitn
+	if strings.TrimSpace(initn.GrpHdr.MsgId) == "" {
+		return errors.New("GrpHdr/MsgId can't be empty")
+	}
+	if len(initn.PmtInf) == 0 {
+		return errors.New("document has no PmtInf")
+	}
+
+	count := 0
+	sum := new(big.Rat)
+	for _, pmtInf := range initn.PmtInf {
+		pmtSum := new(big.Rat)
+		for _, tx := range pmtInf.CdtTrfTxInf {
+			amount, ok := new(big.Rat).SetString(strings.TrimSpace(tx.Amt.InstdAmt.Value))
+			if !ok {
+				return fmt.Errorf("PmtInf %s: invalid amount %q", pmtInf.PmtInfId, tx.Amt.InstdAmt.Value)
+			}
+			pmtSum.Add(pmtSum, amount)
+		}
+
+		if err := checkTotals(pmtInf.NbOfTxs, pmtInf.CtrlSum, len(pmtInf.CdtTrfTxInf), pmtSum); err != nil {
+			return fmt.Errorf("PmtInf %s: %w", pmtInf.PmtInfId, err)
+		}
+
+		count += len(pmtInf.CdtTrfTxInf)
+		sum.Add(sum, pmtSum)
+	}
+
+	if err := checkTotals(initn.GrpHdr.NbOfTxs, initn.GrpHdr.CtrlSum, count, sum); err != nil {
+		return fmt.Errorf("GrpHdr: %w", err)
+	}
+
+	return nil
+}
+
+// checkTotals compares the declared NbOfTxs and CtrlSum, when present, with
+// the actual ones.
+func checkTotals(nbOfTxs, ctrlSum string, count int, sum *big.Rat) error {
+	if nbOfTxs = strings.TrimSpace(nbOfTxs); nbOfTxs != "" && nbOfTxs != fmt.Sprint(count) {
+		return fmt.Errorf("NbOfTxs is %s but there are %d transactions", nbOfTxs, count)
+	}
+
+	if ctrlSum = strings.TrimSpace(ctrlSum); ctrlSum != "" {
+		declared, ok := new(big.Rat).SetString(ctrlSum)
+		if !ok {
+			return fmt.Errorf("invalid CtrlSum %q", ctrlSum)
+		}
+		if declared.Cmp(sum) != 0 {
+			return fmt.Errorf("CtrlSum is %s but transactions add up to %s", ctrlSum, sum.FloatString(2))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package iso20022
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bhojpur/bank/pkg/engine"
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+const pain001 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <CstmrCdtTrfInitn>
+    <GrpHdr>
+      <MsgId>ERP-20220601-1</MsgId>
+      <CreDtTm>2022-06-01T10:00:00</CreDtTm>
+      <NbOfTxs>3</NbOfTxs>
+      <CtrlSum>351.50</CtrlSum>
+      <InitgPty><Nm>ACME</Nm></InitgPty>
+    </GrpHdr>
+    <PmtInf>
+      <PmtInfId>PAYROLL</PmtInfId>
+      <PmtMtd>TRF</PmtMtd>
+      <ReqdExctnDt>2022-06-01</ReqdExctnDt>
+      <Dbtr><Nm>ACME</Nm></Dbtr>
+      <DbtrAcct><Id><Othr><Id>8cbeb3d2-750f-4b14-81a1-143ad715c273</Id></Othr></Id></DbtrAcct>
+      <DbtrAgt><FinInstnId><ClrSysMmbId><MmbId>19730825</MmbId></ClrSysMmbId></FinInstnId></DbtrAgt>
+      <CdtTrfTxInf>
+        <PmtId><InstrId>1</InstrId><EndToEndId>E2E-1</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="BRL">150.00</InstdAmt></Amt>
+        <CdtrAgt><FinInstnId><ClrSysMmbId><MmbId>341</MmbId></ClrSysMmbId></FinInstnId><BrnchId><Id>2545</Id></BrnchId></CdtrAgt>
+        <Cdtr><Nm>Maria Silva</Nm><Id><PrvtId><Othr><Id>529.982.247-25</Id></Othr></PrvtId></Id></Cdtr>
+        <CdtrAcct><Id><Othr><Id>02366-1</Id></Othr></Id><Tp><Cd>CACC</Cd></Tp></CdtrAcct>
+        <RmtInf><Ustrd>Salary</Ustrd></RmtInf>
+      </CdtTrfTxInf>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>E2E-2</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="BRL">200.50</InstdAmt></Amt>
+        <Cdtr><Nm>Internal</Nm></Cdtr>
+        <CdtrAcct><Id><Othr><Id>334201</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>E2E-3</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="BRL">1.00</InstdAmt></Amt>
+        <CdtrAgt><FinInstnId><ClrSysMmbId><MmbId>341</MmbId></ClrSysMmbId></FinInstnId><BrnchId><Id>2545</Id></BrnchId></CdtrAgt>
+        <Cdtr><Nm>Typo</Nm><Id><PrvtId><Othr><Id>52998224726</Id></Othr></PrvtId></Id></Cdtr>
+        <CdtrAcct><Id><Othr><Id>02366-1</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`
+
+type fakeResolver map[string]types.Institution
+
+func (f fakeResolver) Get(code string) (*types.Institution, *engine.Response, error) {
+	institution, ok := f[code]
+	if !ok {
+		return nil, nil, errors.New("not found")
+	}
+	return &institution, nil, nil
+}
+
+func TestConvert(t *testing.T) {
+	doc, err := Parse(strings.NewReader(pain001))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	resolver := fakeResolver{"341": {ISPBCode: "60701190", NumberCode: "341", Name: "ITAU UNIBANCO S.A."}}
+	batches, err := Convert(doc, resolver)
+	if err != nil {
+		t.Fatalf("Convert returned error: %v", err)
+	}
+
+	if len(batches) != 1 || len(batches[0].Instructions) != 3 {
+		t.Fatalf("Convert returned %+v", batches)
+	}
+
+	external := batches[0].Instructions[0]
+	if external.Err != nil {
+		t.Fatalf("Convert instruction 1 returned error: %v", external.Err)
+	}
+	if external.Input.Amount != 15000 || external.Input.Target.Account.InstitutionCode != "341" ||
+		external.Input.Target.Entity.Document != "52998224725" || external.Input.Target.Entity.DocumentType != "cpf" ||
+		external.Input.AccountID != "8cbeb3d2-750f-4b14-81a1-143ad715c273" || external.Input.Description != "Salary" {
+		t.Errorf("Convert instruction 1 returned %+v", external.Input)
+	}
+
+	internal := batches[0].Instructions[1]
+	if internal.Err != nil || internal.Input.IsExternal() || internal.Input.Amount != 20050 {
+		t.Errorf("Convert instruction 2 returned %+v, %v", internal.Input, internal.Err)
+	}
+
+	if batches[0].Instructions[2].Err == nil {
+		t.Errorf("Convert instruction 3 should fail cpf validation")
+	}
+
+	if n := len(batches[0].Inputs()); n != 2 {
+		t.Errorf("Batch.Inputs returned %d inputs, expected 2", n)
+	}
+}
+
+func TestParseControlSum(t *testing.T) {
+	_, err := Parse(strings.NewReader(strings.Replace(pain001, "<CtrlSum>351.50</CtrlSum>", "<CtrlSum>351.49</CtrlSum>", 1)))
+	if err == nil || !strings.Contains(err.Error(), "CtrlSum") {
+		t.Errorf("Parse returned error %v, expected CtrlSum mismatch", err)
+	}
+}
+
+func TestStatusReport(t *testing.T) {
+	doc, err := Parse(strings.NewReader(pain001))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	batches, err := Convert(doc, fakeResolver{"341": {ISPBCode: "60701190", NumberCode: "341"}})
+	if err != nil {
+		t.Fatalf("Convert returned error: %v", err)
+	}
+
+	report := &engine.TransferBatchReport{Results: []engine.TransferBatchResult{
+		{Line: 1, Transfer: &types.Transfer{ID: "t1", Status: "FINISHED"}},
+		{Line: 2, Transfer: &types.Transfer{ID: "t2", Status: "CREATED"}},
+	}}
+
+	status := &StatusReport{
+		MessageID: "STS-1",
+		Original:  doc,
+		Batches:   []BatchStatus{batches[0].Statuses(report)},
+	}
+
+	var buf bytes.Buffer
+	if _, err := status.WriteTo(&buf); err != nil {
+		t.Fatalf("StatusReport.WriteTo returned error: %v", err)
+	}
+
+	out := strings.Join(strings.Fields(buf.String()), "")
+	for _, expected := range []string{
+		`xmlns="urn:iso:std:iso:20022:tech:xsd:pain.002.001.03"`,
+		"<OrgnlMsgId>ERP-20220601-1</OrgnlMsgId>",
+		"<GrpSts>PART</GrpSts>",
+		"<OrgnlEndToEndId>E2E-1</OrgnlEndToEndId><TxSts>ACSC</TxSts>",
+		"<OrgnlEndToEndId>E2E-2</OrgnlEndToEndId><TxSts>ACSP</TxSts>",
+		"<OrgnlEndToEndId>E2E-3</OrgnlEndToEndId><TxSts>RJCT</TxSts><StsRsnInf><Rsn><Cd>NARR</Cd></Rsn>",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("StatusReport.WriteTo output missing %q:\n%s", expected, out)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package iso20022
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bhojpur/bank/pkg/engine"
+	"github.com/bhojpur/bank/pkg/types"
+)
+
+const (
+	Pain002V03 = "pain.002.001.03"
+	Pain002V10 = "pain.002.001.10"
+
+	maxAdditionalInfo = 105
+)
+
+// StatusCode is an ISO 20022 external payment transaction status code
+type StatusCode string
+
+const (
+	StatusAccepted           StatusCode = "ACCP"
+	StatusSettlementProgress StatusCode = "ACSP"
+	StatusSettled            StatusCode = "ACSC"
+	StatusPending            StatusCode = "PDNG"
+	StatusRejected           StatusCode = "RJCT"
+	StatusPartiallyAccepted  StatusCode = "PART"
+)
+
+// TransactionStatus is the outcome of one original transaction
+type TransactionStatus struct {
+	InstructionID string
+	EndToEndID    string
+	Status        StatusCode
+	// ReasonCode is an ISO 20022 external status reason code, such as NARR
+	ReasonCode string
+	// Reason is a proprietary reason code, as reported by the API
+	Reason      string
+	Information string
+}
+
+// BatchStatus is the outcome of one original PmtInf block
+type BatchStatus struct {
+	PaymentInformationID string
+	Transactions         []TransactionStatus
+}
+
+// Statuses maps the report of executing b.Inputs() through
+// TransferService.TransferBatch back to the original transactions.
+// Instructions that failed conversion are reported as rejected.
+func (b *Batch) Statuses(report *engine.TransferBatchReport) BatchStatus {
+	status := BatchStatus{PaymentInformationID: b.PaymentInformationID}
+
+	line := 0
+	for _, instr := range b.Instructions {
+		tx := TransactionStatus{InstructionID: instr.InstructionID, EndToEndID: instr.EndToEndID}
+
+		switch {
+		case instr.Err != nil:
+			tx.Status = StatusRejected
+			tx.ReasonCode = "NARR"
+			tx.Information = instr.Err.Error()
+		case report == nil || line >= len(report.Results):
+			tx.Status = StatusPending
+			line++
+		default:
+			result := report.Results[line]
+			line++
+			if result.Err != nil {
+				tx.Status = StatusRejected
+				tx.ReasonCode = "NARR"
+				tx.Information = result.Error
+			} else {
+				tx.Status, tx.Reason, tx.Information = transferStatus(result.Transfer)
+			}
+		}
+
+		status.Transactions = append(status.Transactions, tx)
+	}
+
+	return status
+}
+
+func transferStatus(t *types.Transfer) (StatusCode, string, string) {
+	if t == nil {
+		return StatusPending, "", ""
+	}
+
+	switch types.TransferStatus(t.Status) {
+	case types.TransferStatusFinished:
+		return StatusSettled, "", ""
+	case types.TransferStatusFailed, types.TransferStatusRejected, types.TransferStatusCancelled,
+		types.TransferStatusApprovalExpired, types.TransferStatusRefunded:
+		return StatusRejected, t.FailureReasonCode, t.FailureReasonDescription
+	case types.TransferStatusScheduled, types.TransferStatusApproved:
+		return StatusAccepted, "", ""
+	}
+	return StatusSettlementProgress, "", ""
+}
+
+// StatusReport describes the pain.002 answering a pain.001 document
+type StatusReport struct {
+	MessageID string
+	CreatedAt time.Time
+	Original  *Document
+	Batches   []BatchStatus
+}
+
+// WriteTo encodes the report as pain.002.001.03 for pain.001.001.03 input
+// and as pain.002.001.10 otherwise.
+func (r *StatusReport) WriteTo(w io.Writer) (int64, error) {
+	version := Pain002V10
+	if r.Original.Version() == Pain001V03 {
+		version = Pain002V03
+	}
+
+	createdAt := r.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	doc := pain002Document{
+		Xmlns: namespacePrefix + version,
+		Report: pain002Report{
+			GrpHdr: pain002GroupHeader{
+				MsgId:   r.MessageID,
+				CreDtTm: createdAt.Format("2006-01-02T15:04:05"),
+			},
+			OrgnlGrpInfAndSts: pain002OriginalGroup{
+				OrgnlMsgId:   r.Original.CstmrCdtTrfInitn.GrpHdr.MsgId,
+				OrgnlMsgNmId: r.Original.Version(),
+				OrgnlNbOfTxs: r.Original.CstmrCdtTrfInitn.GrpHdr.NbOfTxs,
+				OrgnlCtrlSum: r.Original.CstmrCdtTrfInitn.GrpHdr.CtrlSum,
+			},
+		},
+	}
+
+	var all []StatusCode
+	for _, batch := range r.Batches {
+		pmtInf := pain002PaymentInformation{OrgnlPmtInfId: batch.PaymentInformationID}
+
+		var statuses []StatusCode
+		for _, tx := range batch.Transactions {
+			txSts := pain002Transaction{
+				OrgnlInstrId:    tx.InstructionID,
+				OrgnlEndToEndId: tx.EndToEndID,
+				TxSts:           string(tx.Status),
+			}
+			if tx.ReasonCode != "" || tx.Reason != "" || tx.Information != "" {
+				txSts.StsRsnInf = &pain002StatusReason{AddtlInf: truncate(tx.Information, maxAdditionalInfo)}
+				// Rsn is a choice, an external code wins over a proprietary one
+				switch {
+				case tx.ReasonCode != "":
+					txSts.StsRsnInf.Rsn = &pain002Reason{Cd: tx.ReasonCode}
+				case tx.Reason != "":
+					txSts.StsRsnInf.Rsn = &pain002Reason{Prtry: tx.Reason}
+				}
+			}
+			pmtInf.TxInfAndSts = append(pmtInf.TxInfAndSts, txSts)
+			statuses = append(statuses, tx.Status)
+		}
+
+		pmtInf.PmtInfSts = string(groupStatus(statuses))
+		doc.Report.OrgnlPmtInfAndSts = append(doc.Report.OrgnlPmtInfAndSts, pmtInf)
+		all = append(all, statuses...)
+	}
+	doc.Report.OrgnlGrpInfAndSts.GrpSts = string(groupStatus(all))
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return int64(n), err
+}
+
+// groupStatus summarises transaction statuses: a uniform status is kept,
+// a mix of rejections and acceptances is PART and anything else is ACSP.
+func groupStatus(statuses []StatusCode) StatusCode {
+	if len(statuses) == 0 {
+		return StatusPending
+	}
+
+	rejected := 0
+	same := true
+	for _, s := range statuses {
+		if s == StatusRejected {
+			rejected++
+		}
+		if s != statuses[0] {
+			same = false
+		}
+	}
+
+	switch {
+	case same:
+		return statuses[0]
+	case rejected > 0:
+		return StatusPartiallyAccepted
+	}
+	return StatusSettlementProgress
+}
+
+func truncate(s string, max int) string {
+	if r := []rune(s); len(r) > max {
+		return string(r[:max])
+	}
+	return s
+}
+
+type pain002Document struct {
+	XMLName xml.Name      `xml:"Document"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Report  pain002Report `xml:"CstmrPmtStsRpt"`
+}
+
+type pain002Report struct {
+	GrpHdr            pain002GroupHeader          `xml:"GrpHdr"`
+	OrgnlGrpInfAndSts pain002OriginalGroup        `xml:"OrgnlGrpInfAndSts"`
+	OrgnlPmtInfAndSts []pain002PaymentInformation `xml:"OrgnlPmtInfAndSts"`
+}
+
+type pain002GroupHeader struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type pain002OriginalGroup struct {
+	OrgnlMsgId   string `xml:"OrgnlMsgId"`
+	OrgnlMsgNmId string `xml:"OrgnlMsgNmId"`
+	OrgnlNbOfTxs string `xml:"OrgnlNbOfTxs,omitempty"`
+	OrgnlCtrlSum string `xml:"OrgnlCtrlSum,omitempty"`
+	GrpSts       string `xml:"GrpSts"`
+}
+
+type pain002PaymentInformation struct {
+	OrgnlPmtInfId string               `xml:"OrgnlPmtInfId"`
+	PmtInfSts     string               `xml:"PmtInfSts"`
+	TxInfAndSts   []pain002Transaction `xml:"TxInfAndSts"`
+}
+
+type pain002Transaction struct {
+	OrgnlInstrId    string               `xml:"OrgnlInstrId,omitempty"`
+	OrgnlEndToEndId string               `xml:"OrgnlEndToEndId"`
+	TxSts           string               `xml:"TxSts"`
+	StsRsnInf       *pain002StatusReason `xml:"StsRsnInf,omitempty"`
+}
+
+type pain002StatusReason struct {
+	Rsn      *pain002Reason `xml:"Rsn,omitempty"`
+	AddtlInf string         `xml:"AddtlInf,omitempty"`
+}
+
+type pain002Reason struct {
+	Cd    string `xml:"Cd,omitempty"`
+	Prtry string `xml:"Prtry,omitempty"`
+}
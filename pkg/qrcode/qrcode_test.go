@@ -0,0 +1,227 @@
+package qrcode
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestFormatAndVersionBits(t *testing.T) {
+	readFormat := func(c *Code) int {
+		bits := 0
+		for i := 0; i <= 5; i++ {
+			if c.modules[i][8] {
+				bits |= 1 << uint(i)
+			}
+		}
+		if c.modules[7][8] {
+			bits |= 1 << 6
+		}
+		if c.modules[8][8] {
+			bits |= 1 << 7
+		}
+		if c.modules[8][7] {
+			bits |= 1 << 8
+		}
+		for i := 9; i < 15; i++ {
+			if c.modules[8][14-i] {
+				bits |= 1 << uint(i)
+			}
+		}
+		return bits
+	}
+
+	c := newCode(1, Low)
+	c.drawFormatBits(0)
+	if got := readFormat(c); got != 0x77C4 {
+		t.Errorf("format bits for L/0 are %#x, want 0x77c4", got)
+	}
+
+	c = newCode(1, Medium)
+	c.drawFormatBits(0)
+	if got := readFormat(c); got != 0x5412 {
+		t.Errorf("format bits for M/0 are %#x, want 0x5412", got)
+	}
+
+	c = newCode(7, Low)
+	bits := 0
+	for i := 0; i < 18; i++ {
+		if c.modules[i/3][c.size-11+i%3] {
+			bits |= 1 << uint(i)
+		}
+	}
+	if bits != 0x07C94 {
+		t.Errorf("version bits for 7 are %#x, want 0x7c94", bits)
+	}
+}
+
+// TestEncodeRoundTrip reads the symbol back: it removes the mask, collects
+// the codewords, checks every Reed-Solomon block and decodes the byte segment.
+func TestEncodeRoundTrip(t *testing.T) {
+	payloads := []string{
+		"",
+		"hello",
+		"00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-4266554400005204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***63041D3D",
+		strings.Repeat("bhojpur bank ", 60),
+	}
+
+	for _, payload := range payloads {
+		for level := Low; level <= High; level++ {
+			c, err := Encode(payload, level)
+			if err != nil {
+				t.Fatalf("Encode(%d bytes, %s) returned error: %v", len(payload), level, err)
+			}
+
+			ref := newCode(c.Version, level)
+			for y := range ref.modules {
+				for x := range ref.modules[y] {
+					if ref.function[y][x] {
+						continue
+					}
+					ref.modules[y][x] = c.modules[y][x] != maskBit(c.Mask, x, y)
+				}
+			}
+
+			var raw []byte
+			var cur byte
+			n := 0
+			for right := ref.size - 1; right >= 1; right -= 2 {
+				if right == 6 {
+					right = 5
+				}
+				for vert := 0; vert < ref.size; vert++ {
+					for j := 0; j < 2; j++ {
+						x, y := right-j, vert
+						if (right+1)&2 == 0 {
+							y = ref.size - 1 - vert
+						}
+						if ref.function[y][x] {
+							continue
+						}
+						cur <<= 1
+						if ref.modules[y][x] {
+							cur |= 1
+						}
+						if n++; n%8 == 0 {
+							raw = append(raw, cur)
+							cur = 0
+						}
+					}
+				}
+			}
+
+			data := deinterleave(t, raw[:rawDataModules(c.Version)/8], c.Version, level)
+
+			length := int(data[0]&0x0F)<<4 | int(data[1]>>4)
+			offset := 1
+			if charCountBits(c.Version) == 16 {
+				length = int(data[0]&0x0F)<<12 | int(data[1])<<4 | int(data[2]>>4)
+				offset = 2
+			}
+			if data[0]>>4 != 0x4 {
+				t.Fatalf("mode indicator is %#x, want byte mode", data[0]>>4)
+			}
+			if length != len(payload) {
+				t.Fatalf("decoded length %d, want %d", length, len(payload))
+			}
+
+			got := make([]byte, length)
+			for i := range got {
+				got[i] = data[offset+i]<<4 | data[offset+i+1]>>4
+			}
+			if string(got) != payload {
+				t.Errorf("decoded %q, want %q", got, payload)
+			}
+		}
+	}
+}
+
+func deinterleave(t *testing.T, raw []byte, version int, level Level) []byte {
+	numBlocks := eccBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	numShort := numBlocks - len(raw)%numBlocks
+	shortLen := len(raw) / numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < shortLen+1; i++ {
+		for j := range blocks {
+			if i == shortLen-eccLen && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for j, block := range blocks {
+		// The codeword polynomial must vanish at every root of the
+		// generator, alpha^0 to alpha^(eccLen-1).
+		root := byte(1)
+		for i := 0; i < eccLen; i++ {
+			var s byte
+			for _, b := range block {
+				s = gfMultiply(s, root) ^ b
+			}
+			if s != 0 {
+				t.Fatalf("version %d-%s block %d has syndrome %d = %#x", version, level, j, i, s)
+			}
+			root = gfMultiply(root, 0x02)
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+	return data
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode("00020126", Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.PNG(&buf, &RenderOptions{ModuleSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (c.Size() + 8) * 2; img.Bounds().Dx() != want {
+		t.Errorf("PNG width is %d, want %d", img.Bounds().Dx(), want)
+	}
+
+	buf.Reset()
+	if err := c.Terminal(&buf, &RenderOptions{QuietZone: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != (c.Size()+1)/2 {
+		t.Errorf("terminal output has %d lines, want %d", lines, (c.Size()+1)/2)
+	}
+
+	if err := c.SVG(&buf, &RenderOptions{Logo: img}); err != ErrLogoLevel {
+		t.Errorf("SVG with logo at level M returned %v, want %v", err, ErrLogoLevel)
+	}
+}
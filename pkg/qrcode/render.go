@@ -0,0 +1,252 @@
+package qrcode
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+)
+
+const (
+	defaultModuleSize = 8
+	defaultQuietZone  = 4
+	defaultLogoRatio  = 0.2
+	maxLogoRatio      = 0.3
+)
+
+var ErrLogoLevel = errors.New("a logo overlay requires error correction level Q or H")
+
+// RenderOptions controls how a Code is drawn. The zero value renders black
+// modules of 8 pixels with the standard quiet zone of 4 modules.
+type RenderOptions struct {
+	// ModuleSize is the side of each module in pixels (PNG and SVG only)
+	ModuleSize int
+	// QuietZone is the border in modules; zero means the default of 4 and a
+	// negative value disables it
+	QuietZone int
+	// Logo is drawn centered over the symbol
+	Logo image.Image
+	// LogoRatio is the logo width relative to the symbol, at most 0.3
+	LogoRatio float64
+	// Invert swaps dark and light in terminal output, for light backgrounds
+	Invert bool
+}
+
+func (o RenderOptions) withDefaults() RenderOptions {
+	if o.ModuleSize <= 0 {
+		o.ModuleSize = defaultModuleSize
+	}
+	if o.QuietZone == 0 {
+		o.QuietZone = defaultQuietZone
+	} else if o.QuietZone < 0 {
+		o.QuietZone = 0
+	}
+	if o.LogoRatio <= 0 {
+		o.LogoRatio = defaultLogoRatio
+	}
+	if o.LogoRatio > maxLogoRatio {
+		o.LogoRatio = maxLogoRatio
+	}
+	return o
+}
+
+func (c *Code) checkLogo(o RenderOptions) error {
+	if o.Logo != nil && c.Level < Quartile {
+		return ErrLogoLevel
+	}
+	return nil
+}
+
+// logoRect returns the area covered by the logo, in pixels of an image whose
+// side is width, keeping the aspect ratio of the logo.
+func logoRect(logo image.Image, width int, ratio float64) image.Rectangle {
+	b := logo.Bounds()
+	w := int(float64(width) * ratio)
+	h := w
+	if b.Dx() > 0 {
+		h = w * b.Dy() / b.Dx()
+	}
+	x, y := (width-w)/2, (width-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// Image draws the code as a paletted image
+func (c *Code) Image(opts *RenderOptions) (image.Image, error) {
+	o := RenderOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o = o.withDefaults()
+
+	if err := c.checkLogo(o); err != nil {
+		return nil, err
+	}
+
+	width := (c.size + 2*o.QuietZone) * o.ModuleSize
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, width, width), palette)
+
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			px, py := (x+o.QuietZone)*o.ModuleSize, (y+o.QuietZone)*o.ModuleSize
+			draw.Draw(img, image.Rect(px, py, px+o.ModuleSize, py+o.ModuleSize), image.Black, image.Point{}, draw.Src)
+		}
+	}
+
+	if o.Logo == nil {
+		return img, nil
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, image.Point{}, draw.Src)
+
+	r := logoRect(o.Logo, width, o.LogoRatio)
+	draw.Draw(rgba, r.Inset(-o.ModuleSize/2), image.White, image.Point{}, draw.Src)
+	drawScaled(rgba, r, o.Logo)
+
+	return rgba, nil
+}
+
+// drawScaled draws src into r of dst with nearest neighbour scaling
+func drawScaled(dst draw.Image, r image.Rectangle, src image.Image) {
+	b := src.Bounds()
+	if b.Empty() || r.Empty() {
+		return
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sy := b.Min.Y + (y-r.Min.Y)*b.Dy()/r.Dy()
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sx := b.Min.X + (x-r.Min.X)*b.Dx()/r.Dx()
+			if _, _, _, a := src.At(sx, sy).RGBA(); a == 0 {
+				continue
+			}
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+}
+
+// PNG writes the code as a PNG image
+func (c *Code) PNG(w io.Writer, opts *RenderOptions) error {
+	img, err := c.Image(opts)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// SVG writes the code as a single path, which scales without loss for print
+func (c *Code) SVG(w io.Writer, opts *RenderOptions) error {
+	o := RenderOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o = o.withDefaults()
+
+	if err := c.checkLogo(o); err != nil {
+		return err
+	}
+
+	dim := c.size + 2*o.QuietZone
+	width := dim * o.ModuleSize
+
+	var path strings.Builder
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+o.QuietZone, y+o.QuietZone)
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", width, width, dim, dim)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#FFFFFF"/>`+"\n")
+	fmt.Fprintf(&b, `<path d="%s" fill="#000000"/>`+"\n", path.String())
+
+	if o.Logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, o.Logo); err != nil {
+			return err
+		}
+
+		r := logoRect(o.Logo, dim*1000, o.LogoRatio)
+		x, y := float64(r.Min.X)/1000, float64(r.Min.Y)/1000
+		lw, lh := float64(r.Dx())/1000, float64(r.Dy())/1000
+		fmt.Fprintf(&b, `<rect x="%g" y="%g" width="%g" height="%g" fill="#FFFFFF"/>`+"\n", x-0.5, y-0.5, lw+1, lh+1)
+		fmt.Fprintf(&b, `<image x="%g" y="%g" width="%g" height="%g" href="data:image/png;base64,%s"/>`+"\n",
+			x, y, lw, lh, base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Terminal writes the code with UTF-8 half blocks, two module rows per line.
+// The logo option is ignored.
+func (c *Code) Terminal(w io.Writer, opts *RenderOptions) error {
+	o := RenderOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o = o.withDefaults()
+
+	// Terminals usually draw light text on a dark background, so a printed
+	// block is a light module unless inverted.
+	light := func(x, y int) bool {
+		return c.Dark(x, y) == o.Invert
+	}
+
+	var b strings.Builder
+	for y := -o.QuietZone; y < c.size+o.QuietZone; y += 2 {
+		for x := -o.QuietZone; x < c.size+o.QuietZone; x++ {
+			top := light(x, y)
+			bottom := y+1 < c.size+o.QuietZone && light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteRune('█')
+			case top:
+				b.WriteRune('▀')
+			case bottom:
+				b.WriteRune('▄')
+			default:
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
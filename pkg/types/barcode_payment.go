@@ -0,0 +1,136 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"strings"
+)
+
+// BarcodePaymentScheduleHorizonDays is how far ahead a bill payment can be
+// scheduled
+const BarcodePaymentScheduleHorizonDays = 365
+
+// StatementOperationBarcodePayment is the statement operation of bill payments
+const StatementOperationBarcodePayment = "barcode_payment"
+
+// BarcodePaymentStatus is the lifecycle status of a bill payment
+type BarcodePaymentStatus string
+
+const (
+	BarcodePaymentStatusCreated    BarcodePaymentStatus = "CREATED"
+	BarcodePaymentStatusScheduled  BarcodePaymentStatus = "SCHEDULED"
+	BarcodePaymentStatusProcessing BarcodePaymentStatus = "PROCESSING"
+	BarcodePaymentStatusSettled    BarcodePaymentStatus = "SETTLED"
+	BarcodePaymentStatusFailed     BarcodePaymentStatus = "FAILED"
+	BarcodePaymentStatusCancelled  BarcodePaymentStatus = "CANCELLED"
+)
+
+// IsTerminal reports whether the payment reached its final status
+func (s BarcodePaymentStatus) IsTerminal() bool {
+	switch s {
+	case BarcodePaymentStatusSettled, BarcodePaymentStatusFailed, BarcodePaymentStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Cancellable reports whether the payment can still be cancelled
+func (s BarcodePaymentStatus) Cancellable() bool {
+	return s == BarcodePaymentStatusCreated || s == BarcodePaymentStatusScheduled
+}
+
+// BarcodeDetails is what the clearing house registered for a slip, with the
+// amount due on the day of the query
+type BarcodeDetails struct {
+	Barcode        string  `json:"barcode"`
+	WritableLine   string  `json:"writable_line"`
+	Kind           string  `json:"kind"` // bank or utility
+	BankCode       string  `json:"bank_code,omitempty"`
+	BankName       string  `json:"bank_name,omitempty"`
+	Beneficiary    Entity  `json:"beneficiary"`
+	Payer          Entity  `json:"payer"`
+	DueDate        Date    `json:"due_date,omitempty"`
+	LimitDate      Date    `json:"limit_date,omitempty"`
+	OriginalAmount float64 `json:"original_amount"`
+	FineAmount     float64 `json:"fine_amount"`
+	InterestAmount float64 `json:"interest_amount"`
+	DiscountAmount float64 `json:"discount_amount"`
+	Amount         float64 `json:"amount"`
+	MinAmount      float64 `json:"min_amount,omitempty"`
+	MaxAmount      float64 `json:"max_amount,omitempty"`
+	// AmountEditable is set for slips that accept an amount other than Amount,
+	// within MinAmount and MaxAmount
+	AmountEditable bool `json:"amount_editable"`
+}
+
+type BarcodePaymentInput struct {
+	AccountID   string  `json:"account_id"`
+	Barcode     string  `json:"barcode"`
+	Currency    string  `json:"currency"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description,omitempty"`
+	ScheduledTo Date    `json:"scheduled_to,omitempty"`
+}
+
+// Validate checks the fields that don't depend on the barcode itself
+func (p *BarcodePaymentInput) Validate() error {
+	if strings.TrimSpace(p.AccountID) == "" {
+		return errors.New("account_id can't be empty")
+	}
+
+	if strings.TrimSpace(p.Barcode) == "" {
+		return errors.New("barcode can't be empty")
+	}
+
+	if p.Amount < 0 {
+		return errors.New("amount can't be negative")
+	}
+
+	if !p.ScheduledTo.IsZero() {
+		if err := p.ScheduledTo.ValidateWithin(BankNow(), BarcodePaymentScheduleHorizonDays); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type BarcodePayment struct {
+	ID                       string  `json:"id"`
+	AccountID                string  `json:"account_id"`
+	Barcode                  string  `json:"barcode"`
+	WritableLine             string  `json:"writable_line"`
+	Currency                 string  `json:"currency"`
+	Amount                   float64 `json:"amount"`
+	Fee                      float64 `json:"fee"`
+	Description              string  `json:"description"`
+	Status                   string  `json:"status"` // see BarcodePaymentStatus
+	Beneficiary              Entity  `json:"beneficiary"`
+	DueDate                  Date    `json:"due_date,omitempty"`
+	ScheduledTo              Date    `json:"scheduled_to,omitempty"`
+	CreatedAt                string  `json:"created_at"`
+	SettledAt                string  `json:"settled_at,omitempty"`
+	CancelledAt              string  `json:"cancelled_at,omitempty"`
+	FailedAt                 string  `json:"failed_at,omitempty"`
+	FailureReasonCode        string  `json:"failure_reason_code,omitempty"`
+	FailureReasonDescription string  `json:"failure_reason_description,omitempty"`
+}
@@ -21,9 +21,101 @@ package types
 // THE SOFTWARE.
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
+// DateLayout is the layout of calendar dates exchanged with the API
+const DateLayout = "2006-01-02"
+
+// BankLocation is the time zone of the bank, in which dates are exchanged
+// with the API. Brasilia has no daylight saving time since 2019.
+var BankLocation = time.FixedZone("BRT", -3*60*60)
+
+// BankNow returns the current time in BankLocation
+func BankNow() time.Time {
+	return time.Now().In(BankLocation)
+}
+
+// Date is a calendar date in the YYYY-MM-DD form used by the API
+type Date string
+
+// NewDate returns the calendar date of t in its own location
+func NewDate(t time.Time) Date {
+	return Date(t.Format(DateLayout))
+}
+
+// BankDate returns the calendar date of an RFC 3339 timestamp in BankLocation
+func BankDate(timestamp string) (Date, error) {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return "", fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	return NewDate(t.In(BankLocation)), nil
+}
+
+// ParseDate parses s as a YYYY-MM-DD date
+func ParseDate(s string) (Date, error) {
+	if _, err := time.Parse(DateLayout, s); err != nil {
+		return "", fmt.Errorf("invalid date %q", s)
+	}
+	return Date(s), nil
+}
+
+func (d Date) String() string {
+	return string(d)
+}
+
+// IsZero reports whether no date is set
+func (d Date) IsZero() bool {
+	return d == ""
+}
+
+// Time returns midnight UTC of d
+func (d Date) Time() (time.Time, error) {
+	t, err := time.Parse(DateLayout, string(d))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", string(d))
+	}
+	return t, nil
+}
+
+// Before reports whether d is before other. Both must be valid dates, which
+// compare correctly as strings.
+func (d Date) Before(other Date) bool {
+	return d < other
+}
+
+// AddDays returns d moved by n days
+func (d Date) AddDays(n int) (Date, error) {
+	t, err := d.Time()
+	if err != nil {
+		return "", err
+	}
+	return NewDate(t.AddDate(0, 0, n)), nil
+}
+
+// ValidateWithin checks that d is a valid date between today and
+// horizonDays after today, inclusive.
+func (d Date) ValidateWithin(today time.Time, horizonDays int) error {
+	if _, err := d.Time(); err != nil {
+		return err
+	}
+
+	first := NewDate(today)
+	if d.Before(first) {
+		return errors.New("date can't be in the past")
+	}
+
+	last := NewDate(today.AddDate(0, 0, horizonDays))
+	if last.Before(d) {
+		return fmt.Errorf("date can't be more than %d days ahead", horizonDays)
+	}
+
+	return nil
+}
+
 type Cursor struct {
 	After  *string `json:"after"`
 	Before *string `json:"before"`
@@ -36,3 +128,27 @@ type DateRange struct {
 	From time.Time
 	To   time.Time
 }
+
+// reachable walks a status graph breadth first.
+func reachable(from, to string, next func(string) []string) bool {
+	if from == to {
+		return true
+	}
+
+	seen := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		for _, n := range next(queue[0]) {
+			if n == to {
+				return true
+			}
+			if !seen[n] {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+		queue = queue[1:]
+	}
+
+	return false
+}
@@ -0,0 +1,165 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// InstallmentConfig is the installment policy of a merchant. Amounts are in
+// cents and MonthlyRate is a percentage compounded monthly (Price table).
+type InstallmentConfig struct {
+	MaxInstallments int     `json:"max_installments"`
+	InterestFree    int     `json:"interest_free"`
+	MonthlyRate     float64 `json:"monthly_rate"`
+	MinInstallment  float64 `json:"min_installment"`
+}
+
+// InstallmentOption is one row of an installment table. When the amount
+// doesn't split evenly, First carries the remaining cents and every other
+// installment is Installment.
+type InstallmentOption struct {
+	Number       int   `json:"number"`
+	First        int64 `json:"first"`
+	Installment  int64 `json:"installment"`
+	Total        int64 `json:"total"`
+	Interest     int64 `json:"interest"`
+	InterestFree bool  `json:"interest_free"`
+}
+
+// InstallmentPlan is an installment table ordered by Number
+type InstallmentPlan []InstallmentOption
+
+// Validate checks the installment policy against the checkout limits
+func (c InstallmentConfig) Validate() error {
+	if c.MaxInstallments < 1 || c.MaxInstallments > PaymentLinkMaxInstallments {
+		return fmt.Errorf("max_installments must be between 1 and %d", PaymentLinkMaxInstallments)
+	}
+
+	if c.InterestFree < 0 || c.InterestFree > c.MaxInstallments {
+		return errors.New("interest_free must be between 0 and max_installments")
+	}
+
+	if c.MonthlyRate < 0 || c.MonthlyRate >= 100 || math.IsNaN(c.MonthlyRate) {
+		return errors.New("monthly_rate must be between 0 and 100")
+	}
+
+	if c.MinInstallment < 0 || c.MinInstallment != math.Trunc(c.MinInstallment) {
+		return errors.New("min_installment must be a positive amount in cents")
+	}
+
+	return nil
+}
+
+// Plan returns the installment table of amount. Options whose installments
+// would fall below MinInstallment are left out, but paying in full is always
+// offered. Interest is computed exactly and each installment is rounded
+// half up to the cent.
+func (c InstallmentConfig) Plan(amount float64) (InstallmentPlan, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	if amount <= 0 || amount != math.Trunc(amount) || amount > 1<<53 {
+		return nil, errors.New("amount must be a positive amount in cents")
+	}
+	cents := int64(amount)
+
+	rate, ok := new(big.Rat).SetString(strconv.FormatFloat(c.MonthlyRate, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("invalid monthly_rate %v", c.MonthlyRate)
+	}
+	rate.Quo(rate, big.NewRat(100, 1))
+
+	min := int64(c.MinInstallment)
+	plan := InstallmentPlan{}
+	for n := 1; n <= c.MaxInstallments; n++ {
+		option := InstallmentOption{Number: n}
+
+		if n == 1 || n <= c.InterestFree || rate.Sign() == 0 {
+			option.InterestFree = true
+			option.Installment = cents / int64(n)
+			option.First = option.Installment + cents%int64(n)
+			option.Total = cents
+		} else {
+			option.Installment = roundCents(priceInstallment(cents, rate, n))
+			option.First = option.Installment
+			option.Total = option.Installment * int64(n)
+			option.Interest = option.Total - cents
+		}
+
+		if n > 1 && option.Installment < min {
+			continue
+		}
+		plan = append(plan, option)
+	}
+
+	return plan, nil
+}
+
+// Option returns the option with n installments
+func (p InstallmentPlan) Option(n int) (InstallmentOption, bool) {
+	for _, option := range p {
+		if option.Number == n {
+			return option, true
+		}
+	}
+	return InstallmentOption{}, false
+}
+
+// PaymentLink converts the plan to the installments of a checkout credit
+// card input.
+func (p InstallmentPlan) PaymentLink() []PaymentLinkCreditCardInstallment {
+	installments := make([]PaymentLinkCreditCardInstallment, 0, len(p))
+	for _, option := range p {
+		installments = append(installments, PaymentLinkCreditCardInstallment{
+			Number: option.Number,
+			Total:  int(option.Total),
+		})
+	}
+	return installments
+}
+
+// priceInstallment is amount * i / (1 - (1 + i)^-n)
+func priceInstallment(amount int64, rate *big.Rat, n int) *big.Rat {
+	factor := new(big.Rat).Add(big.NewRat(1, 1), rate)
+	pow := big.NewRat(1, 1)
+	for i := 0; i < n; i++ {
+		pow.Mul(pow, factor)
+	}
+
+	// amount * i * (1 + i)^n / ((1 + i)^n - 1)
+	installment := new(big.Rat).Mul(big.NewRat(amount, 1), rate)
+	installment.Mul(installment, pow)
+	return installment.Quo(installment, pow.Sub(pow, big.NewRat(1, 1)))
+}
+
+// roundCents rounds a non-negative value half up
+func roundCents(r *big.Rat) int64 {
+	num := new(big.Int).Mul(r.Num(), big.NewInt(2))
+	num.Add(num, r.Denom())
+	den := new(big.Int).Mul(r.Denom(), big.NewInt(2))
+	return num.Quo(num, den).Int64()
+}
@@ -0,0 +1,145 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInstallmentConfigPlan(t *testing.T) {
+	tests := []struct {
+		name   string
+		config InstallmentConfig
+		amount float64
+		want   InstallmentPlan
+	}{
+		{
+			name:   "interest free split",
+			config: InstallmentConfig{MaxInstallments: 3, InterestFree: 3},
+			amount: 10001,
+			want: InstallmentPlan{
+				{Number: 1, First: 10001, Installment: 10001, Total: 10001, InterestFree: true},
+				{Number: 2, First: 5001, Installment: 5000, Total: 10001, InterestFree: true},
+				{Number: 3, First: 3335, Installment: 3333, Total: 10001, InterestFree: true},
+			},
+		},
+		{
+			name:   "price table",
+			config: InstallmentConfig{MaxInstallments: 3, InterestFree: 1, MonthlyRate: 2},
+			amount: 10000,
+			want: InstallmentPlan{
+				{Number: 1, First: 10000, Installment: 10000, Total: 10000, InterestFree: true},
+				{Number: 2, First: 5150, Installment: 5150, Total: 10300, Interest: 300},
+				{Number: 3, First: 3468, Installment: 3468, Total: 10404, Interest: 404},
+			},
+		},
+		{
+			name:   "interest free before interest",
+			config: InstallmentConfig{MaxInstallments: 3, InterestFree: 2, MonthlyRate: 2},
+			amount: 10000,
+			want: InstallmentPlan{
+				{Number: 1, First: 10000, Installment: 10000, Total: 10000, InterestFree: true},
+				{Number: 2, First: 5000, Installment: 5000, Total: 10000, InterestFree: true},
+				{Number: 3, First: 3468, Installment: 3468, Total: 10404, Interest: 404},
+			},
+		},
+		{
+			name:   "fractional rate",
+			config: InstallmentConfig{MaxInstallments: 4, InterestFree: 3, MonthlyRate: 1.99},
+			amount: 100000,
+			want: InstallmentPlan{
+				{Number: 1, First: 100000, Installment: 100000, Total: 100000, InterestFree: true},
+				{Number: 2, First: 50000, Installment: 50000, Total: 100000, InterestFree: true},
+				{Number: 3, First: 33334, Installment: 33333, Total: 100000, InterestFree: true},
+				{Number: 4, First: 26256, Installment: 26256, Total: 105024, Interest: 5024},
+			},
+		},
+		{
+			// 15 * 1.5^2 / 2.5 is exactly 13.5
+			name:   "half up",
+			config: InstallmentConfig{MaxInstallments: 2, MonthlyRate: 50},
+			amount: 15,
+			want: InstallmentPlan{
+				{Number: 1, First: 15, Installment: 15, Total: 15, InterestFree: true},
+				{Number: 2, First: 14, Installment: 14, Total: 28, Interest: 13},
+			},
+		},
+		{
+			name:   "zero rate",
+			config: InstallmentConfig{MaxInstallments: 2},
+			amount: 1000,
+			want: InstallmentPlan{
+				{Number: 1, First: 1000, Installment: 1000, Total: 1000, InterestFree: true},
+				{Number: 2, First: 500, Installment: 500, Total: 1000, InterestFree: true},
+			},
+		},
+		{
+			name:   "min installment reached",
+			config: InstallmentConfig{MaxInstallments: 4, InterestFree: 4, MinInstallment: 2500},
+			amount: 10000,
+			want: InstallmentPlan{
+				{Number: 1, First: 10000, Installment: 10000, Total: 10000, InterestFree: true},
+				{Number: 2, First: 5000, Installment: 5000, Total: 10000, InterestFree: true},
+				{Number: 3, First: 3334, Installment: 3333, Total: 10000, InterestFree: true},
+				{Number: 4, First: 2500, Installment: 2500, Total: 10000, InterestFree: true},
+			},
+		},
+		{
+			name:   "min installment cut off",
+			config: InstallmentConfig{MaxInstallments: 4, InterestFree: 4, MinInstallment: 2501},
+			amount: 10000,
+			want: InstallmentPlan{
+				{Number: 1, First: 10000, Installment: 10000, Total: 10000, InterestFree: true},
+				{Number: 2, First: 5000, Installment: 5000, Total: 10000, InterestFree: true},
+				{Number: 3, First: 3334, Installment: 3333, Total: 10000, InterestFree: true},
+			},
+		},
+		{
+			name:   "full payment below min installment",
+			config: InstallmentConfig{MaxInstallments: 4, MinInstallment: 5000},
+			amount: 100,
+			want: InstallmentPlan{
+				{Number: 1, First: 100, Installment: 100, Total: 100, InterestFree: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		plan, err := tt.config.Plan(tt.amount)
+		if err != nil {
+			t.Fatalf("%s: Plan returned error: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(plan, tt.want) {
+			t.Errorf("%s: Plan returned %+v, expected %+v", tt.name, plan, tt.want)
+		}
+	}
+
+	for _, amount := range []float64{0, -100, 10.5} {
+		if _, err := (InstallmentConfig{MaxInstallments: 2}).Plan(amount); err == nil {
+			t.Errorf("Plan(%v) returned no error", amount)
+		}
+	}
+
+	if _, err := (InstallmentConfig{MaxInstallments: 12, InterestFree: 13}).Plan(100000); err == nil {
+		t.Error("Plan expected error for interest_free above max_installments")
+	}
+}
@@ -0,0 +1,252 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// ChargeTypeFixed is an amount in cents
+	ChargeTypeFixed = "fixed"
+	// ChargeTypePercent is a percentage of the invoice amount
+	ChargeTypePercent = "percent"
+
+	// InterestTypeDailyAmount charges a fixed amount in cents per day late
+	InterestTypeDailyAmount = "daily_amount"
+	// InterestTypeMonthlyPercent charges a monthly percentage of the invoice
+	// amount, pro rata per day late over 30 days
+	InterestTypeMonthlyPercent = "monthly_percent"
+
+	maxDiscountTiers = 3
+)
+
+var ErrSettlementMismatch = errors.New("settlement amount doesn't match the amount due")
+
+// InvoiceFine is charged once when the invoice is paid after expiration
+type InvoiceFine struct {
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+}
+
+// InvoiceInterest accrues for each day the invoice is paid after expiration
+type InvoiceInterest struct {
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+}
+
+// InvoiceDiscount is granted when the invoice is paid up to LimitDate
+type InvoiceDiscount struct {
+	Type      string  `json:"type"`
+	Value     float64 `json:"value"`
+	LimitDate Date    `json:"limit_date"`
+}
+
+// InvoiceRules are the charges and instructions printed on an invoice
+type InvoiceRules struct {
+	Fine         *InvoiceFine      `json:"fine,omitempty"`
+	Interest     *InvoiceInterest  `json:"interest,omitempty"`
+	Discounts    []InvoiceDiscount `json:"discounts,omitempty"`
+	Instructions []string          `json:"instructions,omitempty"`
+}
+
+// InvoiceAmountDue details what is owed on a given date, in cents
+type InvoiceAmountDue struct {
+	Original float64
+	Fine     float64
+	Interest float64
+	Discount float64
+	Total    float64
+	DaysLate int
+}
+
+// Validate checks the rules of an invoice of amount expiring on expiration
+func (r InvoiceRules) Validate(amount float64, expiration Date) error {
+	if r.Fine != nil {
+		if err := validateCharge(r.Fine.Type, r.Fine.Value); err != nil {
+			return fmt.Errorf("fine: %w", err)
+		}
+	}
+
+	if r.Interest != nil {
+		switch r.Interest.Type {
+		case InterestTypeDailyAmount, InterestTypeMonthlyPercent:
+		default:
+			return fmt.Errorf("interest: invalid type %q", r.Interest.Type)
+		}
+		if r.Interest.Value <= 0 {
+			return errors.New("interest: value must be greater than zero")
+		}
+	}
+
+	if len(r.Discounts) > maxDiscountTiers {
+		return fmt.Errorf("at most %d discounts are allowed", maxDiscountTiers)
+	}
+
+	tiers := r.sortedDiscounts()
+	for i, d := range tiers {
+		if err := validateCharge(d.Type, d.Value); err != nil {
+			return fmt.Errorf("discount: %w", err)
+		}
+		if _, err := d.LimitDate.Time(); err != nil {
+			return fmt.Errorf("discount: %w", err)
+		}
+		if expiration.Before(d.LimitDate) {
+			return errors.New("discount: limit_date can't be after expiration_date")
+		}
+		if chargeAmount(d.Type, d.Value, amount) >= amount {
+			return errors.New("discount: must be less than the amount")
+		}
+		if i > 0 {
+			prev := tiers[i-1]
+			if prev.LimitDate == d.LimitDate {
+				return errors.New("discount: limit dates must be distinct")
+			}
+			if chargeAmount(prev.Type, prev.Value, amount) < chargeAmount(d.Type, d.Value, amount) {
+				return errors.New("discount: later tiers can't be larger than earlier ones")
+			}
+		}
+	}
+
+	return nil
+}
+
+// AmountDue computes what is owed for an invoice of amount expiring on
+// expiration when paid on date. Every charge is rounded to the cent.
+func (r InvoiceRules) AmountDue(amount float64, expiration, date Date) (InvoiceAmountDue, error) {
+	due := InvoiceAmountDue{Original: amount}
+
+	exp, err := expiration.Time()
+	if err != nil {
+		return due, err
+	}
+	paid, err := date.Time()
+	if err != nil {
+		return due, err
+	}
+
+	if paid.After(exp) {
+		due.DaysLate = int(paid.Sub(exp).Hours() / 24)
+
+		if r.Fine != nil {
+			due.Fine = chargeAmount(r.Fine.Type, r.Fine.Value, amount)
+		}
+
+		if r.Interest != nil {
+			switch r.Interest.Type {
+			case InterestTypeDailyAmount:
+				due.Interest = math.Round(r.Interest.Value * float64(due.DaysLate))
+			case InterestTypeMonthlyPercent:
+				due.Interest = math.Round(amount * r.Interest.Value / 100 / 30 * float64(due.DaysLate))
+			}
+		}
+	} else {
+		for _, d := range r.sortedDiscounts() {
+			if !d.LimitDate.Before(date) {
+				due.Discount = chargeAmount(d.Type, d.Value, amount)
+				break
+			}
+		}
+	}
+
+	due.Total = amount + due.Fine + due.Interest - due.Discount
+	return due, nil
+}
+
+// DueDates moves expirations on weekends and holidays to the day they can
+// still be paid without charges, see calendar.Calendar
+type DueDates interface {
+	DueDate(expiration Date) Date
+}
+
+// AmountDueOn is AmountDue honouring days: paying up to the due date of an
+// expiration on a weekend or holiday is not late, while later payments accrue
+// from the original expiration. A nil days is AmountDue.
+func (r InvoiceRules) AmountDueOn(days DueDates, amount float64, expiration, date Date) (InvoiceAmountDue, error) {
+	if days != nil && expiration.Before(date) && !days.DueDate(expiration).Before(date) {
+		date = expiration
+	}
+	return r.AmountDue(amount, expiration, date)
+}
+
+// VerifySettlement checks that the amount paid for a settled invoice is what
+// its rules make due on the settlement date.
+func (p *PaymentInvoice) VerifySettlement() error {
+	return p.VerifySettlementOn(nil)
+}
+
+// VerifySettlementOn is VerifySettlement with the due dates of days
+func (p *PaymentInvoice) VerifySettlementOn(days DueDates) error {
+	if p.SettledAt == "" {
+		return errors.New("invoice is not settled")
+	}
+	settled, err := BankDate(p.SettledAt)
+	if err != nil {
+		return fmt.Errorf("invalid settled_at %q", p.SettledAt)
+	}
+
+	due, err := p.InvoiceRules.AmountDueOn(days, p.Amount, Date(p.ExpirationDate), settled)
+	if err != nil {
+		return err
+	}
+
+	if math.Round(p.PaidAmount) != due.Total {
+		return fmt.Errorf("%w: paid %.0f, due %.0f", ErrSettlementMismatch, p.PaidAmount, due.Total)
+	}
+
+	return nil
+}
+
+// sortedDiscounts returns the discounts by limit date, earliest first
+func (r InvoiceRules) sortedDiscounts() []InvoiceDiscount {
+	tiers := append([]InvoiceDiscount{}, r.Discounts...)
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].LimitDate.Before(tiers[j].LimitDate)
+	})
+	return tiers
+}
+
+func validateCharge(chargeType string, value float64) error {
+	switch chargeType {
+	case ChargeTypeFixed:
+	case ChargeTypePercent:
+		if value > 100 {
+			return errors.New("percent can't exceed 100")
+		}
+	default:
+		return fmt.Errorf("invalid type %q", chargeType)
+	}
+
+	if value <= 0 {
+		return errors.New("value must be greater than zero")
+	}
+	return nil
+}
+
+func chargeAmount(chargeType string, value, amount float64) float64 {
+	if chargeType == ChargeTypePercent {
+		return math.Round(amount * value / 100)
+	}
+	return math.Round(value)
+}
@@ -0,0 +1,222 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"testing"
+)
+
+func testInvoiceRules() InvoiceRules {
+	return InvoiceRules{
+		Fine:     &InvoiceFine{Type: ChargeTypePercent, Value: 2},
+		Interest: &InvoiceInterest{Type: InterestTypeMonthlyPercent, Value: 1},
+		Discounts: []InvoiceDiscount{
+			{Type: ChargeTypePercent, Value: 5, LimitDate: "2026-03-05"},
+			{Type: ChargeTypeFixed, Value: 1000, LimitDate: "2026-03-01"},
+		},
+	}
+}
+
+func TestInvoiceRulesAmountDue(t *testing.T) {
+	daily := InvoiceRules{
+		Fine:     &InvoiceFine{Type: ChargeTypeFixed, Value: 500},
+		Interest: &InvoiceInterest{Type: InterestTypeDailyAmount, Value: 50},
+	}
+
+	tests := []struct {
+		name  string
+		rules InvoiceRules
+		date  Date
+		want  InvoiceAmountDue
+	}{
+		{"first tier", testInvoiceRules(), "2026-02-20", InvoiceAmountDue{Original: 10000, Discount: 1000, Total: 9000}},
+		{"first tier limit", testInvoiceRules(), "2026-03-01", InvoiceAmountDue{Original: 10000, Discount: 1000, Total: 9000}},
+		{"second tier", testInvoiceRules(), "2026-03-02", InvoiceAmountDue{Original: 10000, Discount: 500, Total: 9500}},
+		{"second tier limit", testInvoiceRules(), "2026-03-05", InvoiceAmountDue{Original: 10000, Discount: 500, Total: 9500}},
+		{"after discounts", testInvoiceRules(), "2026-03-06", InvoiceAmountDue{Original: 10000, Total: 10000}},
+		{"on expiration", testInvoiceRules(), "2026-03-10", InvoiceAmountDue{Original: 10000, Total: 10000}},
+		{"one day late", testInvoiceRules(), "2026-03-11", InvoiceAmountDue{Original: 10000, Fine: 200, Interest: 3, Total: 10203, DaysLate: 1}},
+		{"one month late", testInvoiceRules(), "2026-04-09", InvoiceAmountDue{Original: 10000, Fine: 200, Interest: 100, Total: 10300, DaysLate: 30}},
+		{"daily interest", daily, "2026-03-13", InvoiceAmountDue{Original: 10000, Fine: 500, Interest: 150, Total: 10650, DaysLate: 3}},
+		{"no rules", InvoiceRules{}, "2026-03-20", InvoiceAmountDue{Original: 10000, Total: 10000, DaysLate: 10}},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.rules.AmountDue(10000, "2026-03-10", tt.date)
+		if err != nil {
+			t.Fatalf("%s: AmountDue returned error: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: AmountDue returned %+v, expected %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := testInvoiceRules().AmountDue(10000, "2026-03-10", "2026-03-32"); err == nil {
+		t.Error("AmountDue with an invalid date returned no error")
+	}
+}
+
+func TestInvoiceRulesValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules InvoiceRules
+		valid bool
+	}{
+		{"valid", testInvoiceRules(), true},
+		{"no rules", InvoiceRules{}, true},
+		{"fine percent over 100", InvoiceRules{Fine: &InvoiceFine{Type: ChargeTypePercent, Value: 101}}, false},
+		{"fine without value", InvoiceRules{Fine: &InvoiceFine{Type: ChargeTypeFixed}}, false},
+		{"interest type", InvoiceRules{Interest: &InvoiceInterest{Type: ChargeTypeFixed, Value: 1}}, false},
+		{"interest without value", InvoiceRules{Interest: &InvoiceInterest{Type: InterestTypeDailyAmount}}, false},
+		{"discount of the whole amount", InvoiceRules{Discounts: []InvoiceDiscount{
+			{Type: ChargeTypePercent, Value: 100, LimitDate: "2026-03-01"},
+		}}, false},
+		{"discount after expiration", InvoiceRules{Discounts: []InvoiceDiscount{
+			{Type: ChargeTypeFixed, Value: 100, LimitDate: "2026-03-11"},
+		}}, false},
+		{"discount on expiration", InvoiceRules{Discounts: []InvoiceDiscount{
+			{Type: ChargeTypeFixed, Value: 100, LimitDate: "2026-03-10"},
+		}}, true},
+		{"invalid limit date", InvoiceRules{Discounts: []InvoiceDiscount{
+			{Type: ChargeTypeFixed, Value: 100, LimitDate: "2026-02-30"},
+		}}, false},
+		{"repeated limit date", InvoiceRules{Discounts: []InvoiceDiscount{
+			{Type: ChargeTypeFixed, Value: 200, LimitDate: "2026-03-01"},
+			{Type: ChargeTypeFixed, Value: 100, LimitDate: "2026-03-01"},
+		}}, false},
+		{"later tier larger", InvoiceRules{Discounts: []InvoiceDiscount{
+			{Type: ChargeTypeFixed, Value: 100, LimitDate: "2026-03-01"},
+			{Type: ChargeTypePercent, Value: 2, LimitDate: "2026-03-05"},
+		}}, false},
+		{"too many tiers", InvoiceRules{Discounts: []InvoiceDiscount{
+			{Type: ChargeTypeFixed, Value: 400, LimitDate: "2026-03-01"},
+			{Type: ChargeTypeFixed, Value: 300, LimitDate: "2026-03-02"},
+			{Type: ChargeTypeFixed, Value: 200, LimitDate: "2026-03-03"},
+			{Type: ChargeTypeFixed, Value: 100, LimitDate: "2026-03-04"},
+		}}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.rules.Validate(10000, "2026-03-10")
+		if tt.valid && err != nil {
+			t.Errorf("%s: Validate returned error: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: Validate returned no error", tt.name)
+		}
+	}
+}
+
+// mondayDueDates moves the 2026-03-14 saturday to the following monday
+type mondayDueDates struct{}
+
+func (mondayDueDates) DueDate(expiration Date) Date {
+	if expiration == "2026-03-14" {
+		return "2026-03-16"
+	}
+	return expiration
+}
+
+// movedDueDates moves the expirations it holds to another due date
+type movedDueDates map[Date]Date
+
+func (m movedDueDates) DueDate(expiration Date) Date {
+	if due, ok := m[expiration]; ok {
+		return due
+	}
+	return expiration
+}
+
+func TestPaymentInvoiceInputValidateOn(t *testing.T) {
+	input := func(expiration, limit Date) PaymentInvoiceInput {
+		return PaymentInvoiceInput{
+			AccountID:      "acc",
+			Amount:         10000,
+			ExpirationDate: string(expiration),
+			LimitDate:      string(limit),
+			InvoiceType:    InvoiceTypeBillOfExchange,
+			Payer:          PaymentInvoicePayerInput{Document: "52998224725", LegalName: "Maria"},
+		}
+	}
+
+	holiday := NewDate(BankNow().AddDate(0, 0, 30))
+	next, _ := holiday.AddDays(1)
+	days := movedDueDates{holiday: next}
+
+	p := input(holiday, "")
+	if err := p.ValidateOn(days, next); err != nil {
+		t.Fatalf("ValidateOn returned error: %v", err)
+	}
+	if p.LimitDate != string(next) {
+		t.Errorf("ValidateOn set limit_date %s, expected the due date %s", p.LimitDate, next)
+	}
+
+	p = input(holiday, "")
+	if err := p.ValidateOn(nil, next); err == nil {
+		t.Error("ValidateOn accepted an invoice expiring before it is registered")
+	}
+
+	p = input(holiday, holiday)
+	if err := p.ValidateOn(days, holiday); err == nil {
+		t.Error("ValidateOn accepted a limit_date before the due date")
+	}
+}
+
+func TestPaymentInvoiceVerifySettlement(t *testing.T) {
+	tests := []struct {
+		name       string
+		days       DueDates
+		expiration string
+		settledAt  string
+		paid       float64
+		err        error
+	}{
+		{"on time", nil, "2026-03-10", "2026-03-10T15:00:00Z", 10000, nil},
+		// 01:00 UTC is still the evening of the expiration day in Brasilia
+		{"late in utc only", nil, "2026-03-10", "2026-03-11T01:00:00Z", 10000, nil},
+		{"late", nil, "2026-03-10", "2026-03-11T12:00:00Z", 10203, nil},
+		{"late without charges", nil, "2026-03-10", "2026-03-11T12:00:00Z", 10000, ErrSettlementMismatch},
+		{"discount", nil, "2026-03-10", "2026-03-01T12:00:00-03:00", 9000, nil},
+		{"due on monday", mondayDueDates{}, "2026-03-14", "2026-03-16T12:00:00Z", 10000, nil},
+		{"late after monday", mondayDueDates{}, "2026-03-14", "2026-03-17T12:00:00Z", 10210, nil},
+	}
+
+	for _, tt := range tests {
+		invoice := PaymentInvoice{
+			Amount:         10000,
+			ExpirationDate: tt.expiration,
+			SettledAt:      tt.settledAt,
+			PaidAmount:     tt.paid,
+			InvoiceRules:   testInvoiceRules(),
+		}
+		if err := invoice.VerifySettlementOn(tt.days); !errors.Is(err, tt.err) {
+			t.Errorf("%s: VerifySettlementOn returned error %v, expected %v", tt.name, err, tt.err)
+		}
+	}
+
+	for _, settledAt := range []string{"", "2026-03-10"} {
+		invoice := PaymentInvoice{Amount: 10000, ExpirationDate: "2026-03-10", SettledAt: settledAt}
+		if err := invoice.VerifySettlement(); err == nil {
+			t.Errorf("VerifySettlement with settled_at %q returned no error", settledAt)
+		}
+	}
+}
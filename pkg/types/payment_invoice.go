@@ -23,26 +23,39 @@ package types
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
+
+	"github.com/bhojpur/bank/pkg/validation"
 )
 
 const (
-	invoiceAmountMin = 2000
-	invoiceAmountMax = 1000000
-
-	invoiceTypeDeposit        = "deposit"
-	invoiceTypeProposal       = "proposal"
-	invoiceTypeBillOfExchange = "bill_of_exchange"
+	InvoiceTypeDeposit        = "deposit"
+	InvoiceTypeProposal       = "proposal"
+	InvoiceTypeBillOfExchange = "bill_of_exchange"
 )
 
-var digitsRegex = regexp.MustCompile("[0-9]+")
+// Statuses of a PaymentInvoice
+const (
+	PaymentInvoiceStatusCreated    = "CREATED"
+	PaymentInvoiceStatusRegistered = "REGISTERED"
+	PaymentInvoiceStatusPaid       = "PAID"
+	PaymentInvoiceStatusCancelled  = "CANCELLED"
+	PaymentInvoiceStatusExpired    = "EXPIRED"
+)
 
-func onlyDigits(key string) string {
-	return strings.Join(digitsRegex.FindAllString(key, -1), "")
+// AmountLimits bounds the amount of an invoice, in cents
+type AmountLimits struct {
+	Min float64
+	Max float64
 }
 
+// Default amount limits of PaymentInvoiceInput.Validate, in cents
+const (
+	InvoiceAmountMin = 2000
+	InvoiceAmountMax = 1000000
+)
+
 type PaymentInvoiceInput struct {
 	AccountID      string                   `json:"account_id"`
 	Currency       string                   `json:"currency"`
@@ -51,6 +64,8 @@ type PaymentInvoiceInput struct {
 	LimitDate      string                   `json:"limit_date,omitempty"`
 	InvoiceType    string                   `json:"invoice_type"`
 	Payer          PaymentInvoicePayerInput `json:"payer,omitempty" `
+
+	InvoiceRules
 }
 
 type PaymentInvoicePayerInput struct {
@@ -60,46 +75,94 @@ type PaymentInvoicePayerInput struct {
 }
 
 func (p *PaymentInvoiceInput) Validate() error {
+	return p.ValidateWithLimits(AmountLimits{Min: InvoiceAmountMin, Max: InvoiceAmountMax})
+}
+
+// ValidateOn is Validate for an invoice the API registers on registered,
+// which follows the business days and cut-off of the issuer. An expiration
+// on a weekend or holiday moves to the due date days gives it: the invoice
+// must still be due when registered, and a bill of exchange must stay
+// payable until then.
+func (p *PaymentInvoiceInput) ValidateOn(days DueDates, registered Date) error {
+	return p.validate(AmountLimits{Min: InvoiceAmountMin, Max: InvoiceAmountMax}, days, registered)
+}
+
+// ValidateWithLimits is like Validate with the given amount limits
+func (p *PaymentInvoiceInput) ValidateWithLimits(limits AmountLimits) error {
+	return p.validate(limits, nil, NewDate(BankNow()))
+}
+
+func (p *PaymentInvoiceInput) validate(limits AmountLimits, days DueDates, registered Date) error {
 	if strings.TrimSpace(p.AccountID) == "" {
 		return errors.New("account_id can't be empty")
 	}
 
-	if p.Amount < invoiceAmountMin || p.Amount > invoiceAmountMax {
-		return fmt.Errorf("amount can't be < %v or > %v", invoiceAmountMin, invoiceAmountMax)
+	if p.Amount < limits.Min || p.Amount > limits.Max {
+		return fmt.Errorf("amount can't be < %.0f or > %.0f", limits.Min, limits.Max)
 	}
 
-	_, err := time.Parse("2006-01-02", p.ExpirationDate)
-	if err != nil || time.Now().Format("2006-01-02") > p.ExpirationDate {
+	expiration, err := ParseDate(p.ExpirationDate)
+	if err != nil || expiration.Before(NewDate(BankNow())) {
 		return errors.New("invalid expiration_date")
 	}
+	due := expiration
+	if days != nil {
+		due = days.DueDate(expiration)
+	}
+	if due.Before(registered) {
+		return fmt.Errorf("invalid expiration_date: due on %s, before the invoice is registered on %s", due, registered)
+	}
 
 	switch p.InvoiceType {
-	case invoiceTypeDeposit, invoiceTypeProposal:
+	case InvoiceTypeDeposit, InvoiceTypeProposal:
 		p.LimitDate = p.ExpirationDate
-	case invoiceTypeBillOfExchange:
+	case InvoiceTypeBillOfExchange:
 		if strings.TrimSpace(p.LimitDate) == "" {
-			p.LimitDate = p.ExpirationDate
+			p.LimitDate = string(due)
 		} else {
 			_, err := time.Parse("2006-01-02", p.LimitDate)
 			if err != nil || p.LimitDate < p.ExpirationDate {
 				return errors.New("invalid limit_date")
 			}
+			if Date(p.LimitDate).Before(due) {
+				return fmt.Errorf("invalid limit_date: the invoice is due until %s", due)
+			}
 		}
 	default:
 		return errors.New("invalid invoice_type")
 	}
 
-	if p.InvoiceType != invoiceTypeDeposit {
+	if p.InvoiceType != InvoiceTypeDeposit {
 		if strings.TrimSpace(p.Payer.LegalName) == "" {
 			return errors.New("payer legal_name can't be empty")
 		}
 
-		p.Payer.Document = onlyDigits(p.Payer.Document)
-		if strings.TrimSpace(p.Payer.Document) == "" {
-			return errors.New("payer document can't be empty")
+		if err := p.Payer.Validate(); err != nil {
+			return err
 		}
 	}
 
+	return p.InvoiceRules.Validate(p.Amount, Date(p.ExpirationDate))
+}
+
+// Validate checks the payer document check digits, inferring CPF or CNPJ
+// from its length.
+func (p *PaymentInvoicePayerInput) Validate() error {
+	document := validation.OnlyDigits(p.Document)
+	if document == "" {
+		return errors.New("payer document can't be empty")
+	}
+
+	documentType := validation.DocumentTypeOf(document)
+	if documentType == "" {
+		return errors.New("payer document must be a cpf or cnpj")
+	}
+
+	if _, err := validation.ValidateDocument(document, documentType); err != nil {
+		return fmt.Errorf("payer document: %w", err)
+	}
+	p.Document = document
+
 	return nil
 }
 
@@ -122,6 +185,10 @@ type PaymentInvoice struct {
 	OurNumber      string                    `json:"our_number"`
 	Beneficiary    PaymentInvoiceBeneficiary `json:"beneficiary"`
 	Payer          PaymentInvoicePayer       `json:"payer"`
+	PaidAmount     float64                   `json:"paid_amount,omitempty"`
+	QRCode         string                    `json:"qrcode,omitempty"` // BR Code of hybrid invoices
+
+	InvoiceRules
 }
 
 type PaymentInvoiceBeneficiary struct {
@@ -21,10 +21,120 @@ package types
 // THE SOFTWARE.
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
+// PaymentLinkStatus is the status of a payment link order
+type PaymentLinkStatus string
+
+const (
+	PaymentLinkStatusPending  PaymentLinkStatus = "pending"
+	PaymentLinkStatusPaid     PaymentLinkStatus = "paid"
+	PaymentLinkStatusCanceled PaymentLinkStatus = "canceled"
+	PaymentLinkStatusFailed   PaymentLinkStatus = "failed"
 )
 
+// PaymentLinkCheckoutStatus is the lifecycle status of a checkout
+type PaymentLinkCheckoutStatus string
+
+const (
+	PaymentLinkCheckoutStatusOpen              PaymentLinkCheckoutStatus = "open"
+	PaymentLinkCheckoutStatusPaid              PaymentLinkCheckoutStatus = "paid"
+	PaymentLinkCheckoutStatusPartiallyRefunded PaymentLinkCheckoutStatus = "partially_refunded"
+	PaymentLinkCheckoutStatusRefunded          PaymentLinkCheckoutStatus = "refunded"
+	PaymentLinkCheckoutStatusCanceled          PaymentLinkCheckoutStatus = "canceled"
+	PaymentLinkCheckoutStatusExpired           PaymentLinkCheckoutStatus = "expired"
+	PaymentLinkCheckoutStatusFailed            PaymentLinkCheckoutStatus = "failed"
+)
+
+// checkoutTransitions lists the statuses directly reachable from each status.
+var checkoutTransitions = map[PaymentLinkCheckoutStatus][]PaymentLinkCheckoutStatus{
+	PaymentLinkCheckoutStatusOpen: {
+		PaymentLinkCheckoutStatusPaid, PaymentLinkCheckoutStatusCanceled,
+		PaymentLinkCheckoutStatusExpired, PaymentLinkCheckoutStatusFailed,
+	},
+	PaymentLinkCheckoutStatusPaid:              {PaymentLinkCheckoutStatusPartiallyRefunded, PaymentLinkCheckoutStatusRefunded},
+	PaymentLinkCheckoutStatusPartiallyRefunded: {PaymentLinkCheckoutStatusRefunded},
+}
+
+// IsTerminal reports whether the checkout reached a status it will not
+// leave. A paid checkout may still be refunded.
+func (s PaymentLinkCheckoutStatus) IsTerminal() bool {
+	switch s {
+	case PaymentLinkCheckoutStatusRefunded, PaymentLinkCheckoutStatusCanceled,
+		PaymentLinkCheckoutStatusExpired, PaymentLinkCheckoutStatusFailed:
+		return true
+	}
+	return false
+}
+
+// IsSettled reports whether the customer is done with the checkout, either
+// paying it or letting it close
+func (s PaymentLinkCheckoutStatus) IsSettled() bool {
+	return s != PaymentLinkCheckoutStatusOpen && s.IsKnown()
+}
+
+// IsRefundable reports whether a checkout in this status can be refunded
+func (s PaymentLinkCheckoutStatus) IsRefundable() bool {
+	return s == PaymentLinkCheckoutStatusPaid || s == PaymentLinkCheckoutStatusPartiallyRefunded
+}
+
+// IsKnown reports whether s is one of the statuses declared in this package
+func (s PaymentLinkCheckoutStatus) IsKnown() bool {
+	switch s {
+	case PaymentLinkCheckoutStatusOpen, PaymentLinkCheckoutStatusPaid,
+		PaymentLinkCheckoutStatusPartiallyRefunded, PaymentLinkCheckoutStatusRefunded,
+		PaymentLinkCheckoutStatusCanceled, PaymentLinkCheckoutStatusExpired,
+		PaymentLinkCheckoutStatusFailed:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether next may follow s. Unknown statuses are
+// accepted, so new API statuses don't break clients.
+func (s PaymentLinkCheckoutStatus) CanTransitionTo(next PaymentLinkCheckoutStatus) bool {
+	if !s.IsKnown() || !next.IsKnown() {
+		return true
+	}
+
+	return reachable(string(s), string(next), func(from string) []string {
+		var to []string
+		for _, n := range checkoutTransitions[PaymentLinkCheckoutStatus(from)] {
+			to = append(to, string(n))
+		}
+		return to
+	})
+}
+
+// Payment methods of payment links
+const (
+	PaymentLinkMethodCheckout   = "checkout"
+	PaymentLinkMethodCreditCard = "credit_card"
+	PaymentLinkMethodDebitCard  = "debit_card"
+	PaymentLinkMethodBoleto     = "boleto"
+	PaymentLinkMethodUpi        = "upi"
+
+	// PaymentLinkMaxInstallments is the most installments a card payment
+	// may be split in
+	PaymentLinkMaxInstallments = 12
+)
+
+func isPaymentLinkMethod(method string) bool {
+	switch method {
+	case PaymentLinkMethodCreditCard, PaymentLinkMethodDebitCard, PaymentLinkMethodBoleto, PaymentLinkMethodUpi:
+		return true
+	}
+	return false
+}
+
 type PaymentLink struct {
 	ID        string                `json:"id"`
 	Currency  string                `json:"currency"`
@@ -41,26 +151,28 @@ type PaymentLink struct {
 }
 
 type PaymentLinkCheckout struct {
-	ID                          string                `json:"id"`
-	AcceptedMultiPaymentMethods []string              `json:"accepted_multi_payment_methods"`
-	AcceptedPaymentMethods      []string              `json:"accepted_payment_methods"`
-	Currency                    string                `json:"currency"`
-	Amount                      float64               `json:"amount"`
-	BillingAddress              json.RawMessage       `json:"billing_address"`
-	BillingAddressEditable      bool                  `json:"billing_address_editable"`
-	CreditCard                  PaymentLinkCreditCard `json:"credit_card"`
-	Customer                    PaymentLinkCustomer   `json:"customer"`
-	CustomerEditable            bool                  `json:"customer_editable"`
-	ExpiresAt                   string                `json:"expires_at"`
-	Metadata                    json.RawMessage       `json:"metadata"`
-	PaymentURL                  string                `json:"payment_url"`
-	RequiredFields              []string              `json:"required_fields"`
-	Shippable                   bool                  `json:"shippable"`
-	SkipCheckoutSuccessPage     bool                  `json:"skip_checkout_success_page"`
-	Status                      string                `json:"status"`
-	SuccessURL                  string                `json:"success_url"`
-	CreatedAt                   string                `json:"created_at"`
-	UpdatedAt                   string                `json:"updated_at"`
+	ID                          string                 `json:"id"`
+	AcceptedMultiPaymentMethods []string               `json:"accepted_multi_payment_methods"`
+	AcceptedPaymentMethods      []string               `json:"accepted_payment_methods"`
+	Currency                    string                 `json:"currency"`
+	Amount                      float64                `json:"amount"`
+	BillingAddress              *PaymentLinkAddress    `json:"billing_address,omitempty"`
+	BillingAddressEditable      bool                   `json:"billing_address_editable"`
+	CreditCard                  PaymentLinkCreditCard  `json:"credit_card"`
+	Customer                    PaymentLinkCustomer    `json:"customer"`
+	CustomerEditable            bool                   `json:"customer_editable"`
+	ExpiresAt                   string                 `json:"expires_at"`
+	Metadata                    map[string]interface{} `json:"metadata,omitempty"`
+	PaymentURL                  string                 `json:"payment_url"`
+	RequiredFields              []string               `json:"required_fields"`
+	Shippable                   bool                   `json:"shippable"`
+	SkipCheckoutSuccessPage     bool                   `json:"skip_checkout_success_page"`
+	Status                      string                 `json:"status"` // see PaymentLinkCheckoutStatus
+	PaidAmount                  float64                `json:"paid_amount,omitempty"`
+	RefundedAmount              float64                `json:"refunded_amount,omitempty"`
+	SuccessURL                  string                 `json:"success_url"`
+	CreatedAt                   string                 `json:"created_at"`
+	UpdatedAt                   string                 `json:"updated_at"`
 }
 
 type PaymentLinkCreditCard struct {
@@ -70,8 +182,8 @@ type PaymentLinkCreditCard struct {
 }
 
 type PaymentLinkCreditCardAuth struct {
-	ThreedSecure json.RawMessage `json:"threed_secure"`
-	Type         string          `json:"type"`
+	ThreedSecure *PaymentLinkThreeDSecure `json:"threed_secure,omitempty"`
+	Type         string                   `json:"type"`
 }
 
 type PaymentLinkCreditCardInstallment struct {
@@ -80,12 +192,53 @@ type PaymentLinkCreditCardInstallment struct {
 }
 
 type PaymentLinkCustomer struct {
-	ID         string          `json:"id"`
-	Name       string          `json:"name"`
-	Delinquent bool            `json:"delinquent"`
-	Phones     json.RawMessage `json:"phones"`
-	CreatedAt  string          `json:"created_at"`
-	UpdatedAt  string          `json:"updated_at"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Delinquent bool              `json:"delinquent"`
+	Phones     PaymentLinkPhones `json:"phones"`
+	CreatedAt  string            `json:"created_at"`
+	UpdatedAt  string            `json:"updated_at"`
+}
+
+type PaymentLinkAddress struct {
+	Line1   string `json:"line_1"`
+	Line2   string `json:"line_2,omitempty"`
+	ZipCode string `json:"zip_code"`
+	City    string `json:"city"`
+	State   string `json:"state"`
+	Country string `json:"country"`
+}
+
+type PaymentLinkThreeDSecure struct {
+	MPI           string `json:"mpi"`
+	ECI           string `json:"eci,omitempty"`
+	CAVV          string `json:"cavv,omitempty"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	SuccessURL    string `json:"success_url,omitempty"`
+}
+
+type PaymentLinkPhones struct {
+	HomePhone   *PaymentLinkPhone `json:"home_phone,omitempty"`
+	MobilePhone *PaymentLinkPhone `json:"mobile_phone,omitempty"`
+}
+
+type PaymentLinkPhone struct {
+	CountryCode string `json:"country_code"`
+	AreaCode    string `json:"area_code"`
+	Number      string `json:"number"`
+}
+
+// Validate checks that the phone has only digits and a plausible length
+func (p *PaymentLinkPhone) Validate() error {
+	for _, f := range [][2]string{{"country_code", p.CountryCode}, {"area_code", p.AreaCode}, {"number", p.Number}} {
+		if f[1] == "" || validation.OnlyDigits(f[1]) != f[1] {
+			return fmt.Errorf("phone %s must have only digits", f[0])
+		}
+	}
+	if len(p.Number) < 8 || len(p.Number) > 9 {
+		return errors.New("phone number must have 8 or 9 digits")
+	}
+	return nil
 }
 
 type PaymentLinkItem struct {
@@ -116,7 +269,10 @@ type PaymentLinkItemInput struct {
 }
 
 type PaymentLinkCustomerInput struct {
-	Name string `json:"name"`
+	Name     string             `json:"name"`
+	Email    string             `json:"email,omitempty"`
+	Document string             `json:"document,omitempty"`
+	Phones   *PaymentLinkPhones `json:"phones,omitempty"`
 }
 
 type PaymentLinkPaymentInput struct {
@@ -142,6 +298,159 @@ type PaymentLinkCreditCardInput struct {
 	Installments []PaymentLinkCreditCardInstallment `json:"installments"`
 }
 
+// Validate checks the items, customer and payments of the order. Payments
+// must add up to the items total.
+func (p *PaymentLinkInput) Validate() error {
+	if strings.TrimSpace(p.AccountID) == "" {
+		return errors.New("account_id can't be empty")
+	}
+
+	if len(p.Items) == 0 {
+		return errors.New("items can't be empty")
+	}
+	total := 0.0
+	for i := range p.Items {
+		item := &p.Items[i]
+		if err := item.Validate(); err != nil {
+			return fmt.Errorf("items[%d]: %w", i, err)
+		}
+		if item.Currency != p.Items[0].Currency {
+			return fmt.Errorf("items[%d]: all items must have the same currency", i)
+		}
+		total += item.Amount * float64(item.Quantity)
+	}
+
+	if err := p.Customer.Validate(); err != nil {
+		return fmt.Errorf("customer: %w", err)
+	}
+
+	if len(p.Payments) == 0 {
+		return errors.New("payments can't be empty")
+	}
+	paid := 0.0
+	for i := range p.Payments {
+		if err := p.Payments[i].Validate(); err != nil {
+			return fmt.Errorf("payments[%d]: %w", i, err)
+		}
+		paid += p.Payments[i].Amount
+	}
+	if math.Round(paid) != math.Round(total) {
+		return fmt.Errorf("payments add up to %.0f, items to %.0f", paid, total)
+	}
+
+	return nil
+}
+
+func (p *PaymentLinkItemInput) Validate() error {
+	if strings.TrimSpace(p.Description) == "" {
+		return errors.New("description can't be empty")
+	}
+	if p.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if p.Quantity < 1 {
+		return errors.New("quantity must be at least 1")
+	}
+	return nil
+}
+
+func (p *PaymentLinkCustomerInput) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("name can't be empty")
+	}
+
+	if p.Email != "" {
+		if addr, err := mail.ParseAddress(p.Email); err != nil || addr.Address != p.Email {
+			return fmt.Errorf("invalid email %q", p.Email)
+		}
+	}
+
+	if p.Document != "" {
+		document := validation.OnlyDigits(p.Document)
+		if _, err := validation.ValidateDocument(document, validation.DocumentTypeOf(document)); err != nil {
+			return fmt.Errorf("document: %w", err)
+		}
+		p.Document = document
+	}
+
+	if p.Phones != nil {
+		for _, phone := range []*PaymentLinkPhone{p.Phones.HomePhone, p.Phones.MobilePhone} {
+			if phone == nil {
+				continue
+			}
+			if err := phone.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *PaymentLinkPaymentInput) Validate() error {
+	if p.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+
+	if p.PaymentMethod != PaymentLinkMethodCheckout {
+		if !isPaymentLinkMethod(p.PaymentMethod) {
+			return fmt.Errorf("invalid payment_method %q", p.PaymentMethod)
+		}
+		return nil
+	}
+
+	return p.Checkout.Validate()
+}
+
+// Validate checks the accepted methods, success URL and installments
+func (p *PaymentLinkCheckoutInput) Validate() error {
+	if len(p.AcceptedPaymentMethods) == 0 {
+		return errors.New("accepted_payment_methods can't be empty")
+	}
+
+	seen := make(map[string]bool)
+	for _, method := range p.AcceptedPaymentMethods {
+		if !isPaymentLinkMethod(method) {
+			return fmt.Errorf("invalid accepted payment method %q", method)
+		}
+		if seen[method] {
+			return fmt.Errorf("duplicate accepted payment method %q", method)
+		}
+		seen[method] = true
+	}
+	for _, method := range p.AcceptedMultiPaymentMethods {
+		if !seen[method] {
+			return fmt.Errorf("multi payment method %q must also be accepted", method)
+		}
+	}
+
+	if p.SuccessURL != "" {
+		u, err := url.Parse(p.SuccessURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid success_url %q", p.SuccessURL)
+		}
+	}
+
+	numbers := make(map[int]bool)
+	for _, installment := range p.CreditCard.Installments {
+		if installment.Number < 1 || installment.Number > PaymentLinkMaxInstallments {
+			return fmt.Errorf("installments must be between 1 and %d", PaymentLinkMaxInstallments)
+		}
+		if numbers[installment.Number] {
+			return fmt.Errorf("duplicate installment %d", installment.Number)
+		}
+		if installment.Total <= 0 {
+			return errors.New("installment total must be greater than zero")
+		}
+		numbers[installment.Number] = true
+	}
+	if len(numbers) > 0 && !seen[PaymentLinkMethodCreditCard] {
+		return errors.New("installments require credit_card to be accepted")
+	}
+
+	return nil
+}
+
 type PaymentLinkCancelInput struct {
 	AccountID string `json:"account_id"`
 	Status    string `json:"status"`
@@ -158,3 +467,54 @@ func (p PaymentLinkCancelInput) Validate() error {
 
 	return nil
 }
+
+// PaymentLinkRefundStatus is the lifecycle status of a checkout refund
+type PaymentLinkRefundStatus string
+
+const (
+	PaymentLinkRefundStatusPending  PaymentLinkRefundStatus = "pending"
+	PaymentLinkRefundStatusRefunded PaymentLinkRefundStatus = "refunded"
+	PaymentLinkRefundStatusFailed   PaymentLinkRefundStatus = "failed"
+)
+
+type PaymentLinkRefund struct {
+	ID         string  `json:"id"`
+	OrderID    string  `json:"order_id"`
+	CheckoutID string  `json:"checkout_id"`
+	Currency   string  `json:"currency"`
+	Amount     float64 `json:"amount"`
+	Reason     string  `json:"reason,omitempty"`
+	Status     string  `json:"status"` // see PaymentLinkRefundStatus
+	CreatedAt  string  `json:"created_at"`
+}
+
+type PaymentLinkRefundInput struct {
+	AccountID string `json:"account_id"`
+	// Amount in cents; zero refunds whatever was not refunded yet
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+// Validate checks the refund against a checkout that was paid of which
+// refunded was already returned. A zero Amount is left for the API to
+// resolve to the remaining balance, so a retry sends the same body.
+func (p *PaymentLinkRefundInput) Validate(paid, refunded float64) error {
+	if strings.TrimSpace(p.AccountID) == "" {
+		return errors.New("account_id can't be empty")
+	}
+
+	if p.Amount < 0 {
+		return errors.New("amount can't be negative")
+	}
+
+	remaining := math.Round(paid - refunded)
+	if remaining <= 0 {
+		return fmt.Errorf("%w: checkout already refunded", ErrRefundExceedsAmount)
+	}
+
+	if math.Round(p.Amount) > remaining {
+		return fmt.Errorf("%w: %.0f requested, %.0f remaining", ErrRefundExceedsAmount, p.Amount, remaining)
+	}
+
+	return nil
+}
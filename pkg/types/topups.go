@@ -20,6 +20,14 @@ package types
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
 type Providers struct {
 	Providers []Provider `json:"providers"`
 }
@@ -37,3 +45,213 @@ type Product struct {
 type Products struct {
 	Products []Product `json:"product"`
 }
+
+type Carriers struct {
+	Carriers []Carrier `json:"carriers"`
+}
+
+// Carrier is a mobile network operator that accepts recharges
+type Carrier struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+}
+
+// Has reports whether value is in the catalogue
+func (p *Products) Has(value int) bool {
+	for _, product := range p.Products {
+		if product.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	TopupKindGame   = "game"
+	TopupKindMobile = "mobile"
+)
+
+type TopupStatus string
+
+const (
+	TopupStatusCreated    TopupStatus = "CREATED"
+	TopupStatusProcessing TopupStatus = "PROCESSING"
+	TopupStatusConfirmed  TopupStatus = "CONFIRMED"
+	TopupStatusFailed     TopupStatus = "FAILED"
+	TopupStatusRefunded   TopupStatus = "REFUNDED"
+)
+
+var topupTransitions = map[TopupStatus][]TopupStatus{
+	TopupStatusCreated:    {TopupStatusProcessing, TopupStatusConfirmed, TopupStatusFailed},
+	TopupStatusProcessing: {TopupStatusConfirmed, TopupStatusFailed},
+	TopupStatusConfirmed:  {TopupStatusRefunded},
+}
+
+// IsTerminal reports whether the top-up was delivered or will not be. A
+// confirmed top-up may still be refunded when the operator reverses it.
+func (s TopupStatus) IsTerminal() bool {
+	switch s {
+	case TopupStatusConfirmed, TopupStatusFailed, TopupStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// IsKnown reports whether s is one of the statuses declared in this package.
+func (s TopupStatus) IsKnown() bool {
+	switch s {
+	case TopupStatusCreated, TopupStatusProcessing, TopupStatusConfirmed,
+		TopupStatusFailed, TopupStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether next can be observed after s, directly or
+// through intermediate statuses. Unknown statuses are not constrained.
+func (s TopupStatus) CanTransitionTo(next TopupStatus) bool {
+	if !s.IsKnown() || !next.IsKnown() {
+		return true
+	}
+
+	return reachable(string(s), string(next), func(from string) []string {
+		var to []string
+		for _, n := range topupTransitions[TopupStatus(from)] {
+			to = append(to, string(n))
+		}
+		return to
+	})
+}
+
+// areaCodes are the Brazilian DDDs in use
+var areaCodes = map[string]bool{
+	"11": true, "12": true, "13": true, "14": true, "15": true, "16": true, "17": true, "18": true, "19": true,
+	"21": true, "22": true, "24": true, "27": true, "28": true,
+	"31": true, "32": true, "33": true, "34": true, "35": true, "37": true, "38": true,
+	"41": true, "42": true, "43": true, "44": true, "45": true, "46": true, "47": true, "48": true, "49": true,
+	"51": true, "53": true, "54": true, "55": true,
+	"61": true, "62": true, "63": true, "64": true, "65": true, "66": true, "67": true, "68": true, "69": true,
+	"71": true, "73": true, "74": true, "75": true, "77": true, "79": true,
+	"81": true, "82": true, "83": true, "84": true, "85": true, "86": true, "87": true, "88": true, "89": true,
+	"91": true, "92": true, "93": true, "94": true, "95": true, "96": true, "97": true, "98": true, "99": true,
+}
+
+// MobilePhone is a Brazilian mobile number
+type MobilePhone struct {
+	AreaCode string `json:"area_code"`
+	Number   string `json:"number"`
+}
+
+// ParseMobilePhone accepts a mobile number with area code in any usual
+// notation, such as "+55 (11) 98765-4321" or "11987654321".
+func ParseMobilePhone(s string) (MobilePhone, error) {
+	digits := validation.OnlyDigits(s)
+	if len(digits) == 13 && strings.HasPrefix(digits, "55") {
+		digits = digits[2:]
+	}
+	if len(digits) != 11 {
+		return MobilePhone{}, fmt.Errorf("invalid mobile phone %q", s)
+	}
+
+	phone := MobilePhone{AreaCode: digits[:2], Number: digits[2:]}
+	if err := phone.Validate(); err != nil {
+		return MobilePhone{}, err
+	}
+	return phone, nil
+}
+
+// Validate checks the area code and that the number is a 9 digit mobile
+func (p MobilePhone) Validate() error {
+	if !areaCodes[p.AreaCode] {
+		return fmt.Errorf("invalid area code %q", p.AreaCode)
+	}
+	if len(p.Number) != 9 || validation.OnlyDigits(p.Number) != p.Number || p.Number[0] != '9' {
+		return errors.New("mobile number must have 9 digits starting with 9")
+	}
+	return nil
+}
+
+// String formats the phone as "(11) 98765-4321". Numbers too short to split
+// are returned as they are.
+func (p MobilePhone) String() string {
+	if len(p.Number) <= 4 {
+		return p.AreaCode + p.Number
+	}
+	return fmt.Sprintf("(%s) %s-%s", p.AreaCode, p.Number[:len(p.Number)-4], p.Number[len(p.Number)-4:])
+}
+
+// GameTopupInput buys credits of a game provider for a player account
+type GameTopupInput struct {
+	AccountID  string `json:"account_id"`
+	ProviderID int    `json:"provider_id"`
+	Value      int    `json:"value"`
+	PlayerID   string `json:"player_id,omitempty"`
+}
+
+func (p *GameTopupInput) Validate() error {
+	if strings.TrimSpace(p.AccountID) == "" {
+		return errors.New("account_id can't be empty")
+	}
+	if p.ProviderID <= 0 {
+		return errors.New("provider_id can't be empty")
+	}
+	if p.Value <= 0 {
+		return errors.New("value must be greater than zero")
+	}
+	return nil
+}
+
+// MobileRechargeInput recharges a prepaid mobile phone
+type MobileRechargeInput struct {
+	AccountID string      `json:"account_id"`
+	CarrierID int         `json:"carrier_id"`
+	Phone     MobilePhone `json:"phone"`
+	Value     int         `json:"value"`
+}
+
+func (p *MobileRechargeInput) Validate() error {
+	if strings.TrimSpace(p.AccountID) == "" {
+		return errors.New("account_id can't be empty")
+	}
+	if p.CarrierID <= 0 {
+		return errors.New("carrier_id can't be empty")
+	}
+	if err := p.Phone.Validate(); err != nil {
+		return fmt.Errorf("phone: %w", err)
+	}
+	if p.Value <= 0 {
+		return errors.New("value must be greater than zero")
+	}
+	return nil
+}
+
+// Topup is a purchase of game credits or of a mobile recharge
+type Topup struct {
+	ID            string       `json:"id"`
+	AccountID     string       `json:"account_id"`
+	Kind          string       `json:"kind"` // game or mobile
+	ProviderID    int          `json:"provider_id,omitempty"`
+	CarrierID     int          `json:"carrier_id,omitempty"`
+	ProductName   string       `json:"product_name,omitempty"`
+	Value         int          `json:"value"`
+	PlayerID      string       `json:"player_id,omitempty"`
+	Phone         *MobilePhone `json:"phone,omitempty"`
+	Status        string       `json:"status"` // see TopupStatus
+	FailureReason string       `json:"failure_reason,omitempty"`
+	CreatedAt     string       `json:"created_at"`
+	UpdatedAt     string       `json:"updated_at"`
+}
+
+// TopupReceipt is the proof of a confirmed top-up. Voucher holds the PIN of
+// game credits, which the player redeems in the game.
+type TopupReceipt struct {
+	TopupID            string       `json:"topup_id"`
+	AuthenticationCode string       `json:"authentication_code"`
+	ProviderName       string       `json:"provider_name"`
+	ProductName        string       `json:"product_name,omitempty"`
+	Value              int          `json:"value"`
+	Phone              *MobilePhone `json:"phone,omitempty"`
+	Voucher            string       `json:"voucher,omitempty"`
+	Instructions       string       `json:"instructions,omitempty"`
+	ConfirmedAt        string       `json:"confirmed_at"`
+}
@@ -20,18 +20,95 @@ package types
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
+// TransferScheduleHorizonDays is how far ahead a transfer can be scheduled
+const TransferScheduleHorizonDays = 365
+
+// TransferStatus is the lifecycle status of an internal or external transfer.
+type TransferStatus string
+
+const (
+	TransferStatusCreated         TransferStatus = "CREATED"
+	TransferStatusScheduled       TransferStatus = "SCHEDULED"
+	TransferStatusApproved        TransferStatus = "APPROVED"
+	TransferStatusRejected        TransferStatus = "REJECTED"
+	TransferStatusApprovalExpired TransferStatus = "APPROVAL_EXPIRED"
+	TransferStatusCancelled       TransferStatus = "CANCELLED"
+	TransferStatusFinished        TransferStatus = "FINISHED"
+	TransferStatusFailed          TransferStatus = "FAILED"
+	TransferStatusRefunded        TransferStatus = "REFUNDED"
+)
+
+// transferTransitions lists the statuses directly reachable from each status.
+var transferTransitions = map[TransferStatus][]TransferStatus{
+	TransferStatusCreated: {
+		TransferStatusScheduled, TransferStatusApproved, TransferStatusRejected, TransferStatusApprovalExpired,
+		TransferStatusCancelled, TransferStatusFinished, TransferStatusFailed,
+	},
+	TransferStatusScheduled: {TransferStatusApproved, TransferStatusCancelled, TransferStatusFinished, TransferStatusFailed},
+	TransferStatusApproved:  {TransferStatusScheduled, TransferStatusCancelled, TransferStatusFinished, TransferStatusFailed},
+	TransferStatusFinished:  {TransferStatusRefunded},
+}
+
+// IsTerminal reports whether the transfer reached a status it will not leave
+// on its own. A finished external transfer may still be refunded by the
+// receiving institution later on.
+func (s TransferStatus) IsTerminal() bool {
+	switch s {
+	case TransferStatusRejected, TransferStatusApprovalExpired, TransferStatusCancelled,
+		TransferStatusFinished, TransferStatusFailed, TransferStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// IsKnown reports whether s is one of the statuses declared in this package.
+func (s TransferStatus) IsKnown() bool {
+	switch s {
+	case TransferStatusCreated, TransferStatusScheduled, TransferStatusApproved,
+		TransferStatusRejected, TransferStatusApprovalExpired, TransferStatusCancelled,
+		TransferStatusFinished, TransferStatusFailed, TransferStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether next can be observed after s, directly or
+// through intermediate statuses. Unknown statuses are not constrained.
+func (s TransferStatus) CanTransitionTo(next TransferStatus) bool {
+	if !s.IsKnown() || !next.IsKnown() {
+		return true
+	}
+
+	return reachable(string(s), string(next), func(from string) []string {
+		var to []string
+		for _, n := range transferTransitions[TransferStatus(from)] {
+			to = append(to, string(n))
+		}
+		return to
+	})
+}
+
 type TransferInput struct {
 	AccountID   string  `json:"account_id"`
 	Currency    string  `json:"currency"`
 	Amount      float64 `json:"amount,omitempty"`
 	Description string  `json:"description,omitempty"`
-	ScheduledTo string  `json:"scheduled_to,omitempty"`
+	ScheduledTo Date    `json:"scheduled_to,omitempty"`
 	Target      Target  `json:"target,omitempty"`
 	Type        string
 }
 
 type Transfer struct {
 	ID                       string  `json:"id,omitempty"`
+	AccountID                string  `json:"account_id,omitempty"`
 	Currency                 string  `json:"currency"`
 	Amount                   float64 `json:"amount,omitempty"`
 	Fee                      int     `json:"fee,omitempty"`
@@ -80,3 +157,72 @@ type Entity struct {
 	Document     string `json:"document,omitempty"`
 	DocumentType string `json:"document_type,omitempty"`
 }
+
+// IsExternal reports whether the transfer targets another institution.
+func (t *TransferInput) IsExternal() bool {
+	return strings.TrimSpace(t.Target.Account.InstitutionCode) != ""
+}
+
+// Validate checks the transfer before it is sent to the API. For external
+// transfers the target document and bank account are verified offline and
+// normalised in place.
+func (t *TransferInput) Validate() error {
+	if t.Amount == 0 {
+		return errors.New("amount can't be 0")
+	}
+	if t.AccountID == "" {
+		return errors.New("account_id can't be empty")
+	}
+	if t.Target.Account.AccountCode == "" {
+		return errors.New("account_code can't be empty")
+	}
+	if !t.ScheduledTo.IsZero() {
+		if err := t.ScheduledTo.ValidateWithin(BankNow(), TransferScheduleHorizonDays); err != nil {
+			return fmt.Errorf("invalid scheduled_to: %w", err)
+		}
+	}
+
+	if !t.IsExternal() {
+		return nil
+	}
+
+	if t.Target.Account.BranchCode == "" {
+		return errors.New("branch_code can't be empty")
+	}
+	if t.Target.Entity.Name == "" {
+		return errors.New("entity name can't be empty")
+	}
+	if err := t.Target.Entity.Validate(); err != nil {
+		return err
+	}
+
+	branch, account, err := validation.ValidateBankAccount(t.Target.Account.InstitutionCode,
+		t.Target.Account.BranchCode, t.Target.Account.AccountCode)
+	if err != nil {
+		return err
+	}
+	t.Target.Account.BranchCode = branch
+	t.Target.Account.AccountCode = account
+
+	return nil
+}
+
+// Validate checks the document against its type and normalises both.
+func (e *Entity) Validate() error {
+	if e.Document == "" {
+		return errors.New("entity document can't be empty")
+	}
+	if e.DocumentType == "" {
+		return errors.New("entity document type can't be empty")
+	}
+
+	documentType := validation.NormalizeDocumentType(e.DocumentType)
+	document, err := validation.ValidateDocument(e.Document, documentType)
+	if err != nil {
+		return fmt.Errorf("entity document: %w", err)
+	}
+	e.Document = document
+	e.DocumentType = documentType
+
+	return nil
+}
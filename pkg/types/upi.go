@@ -22,7 +22,10 @@ package types
 
 import (
 	"errors"
+	"fmt"
 	"time"
+
+	"github.com/bhojpur/bank/pkg/validation"
 )
 
 type TargetOrSourceAccount struct {
@@ -35,6 +38,65 @@ type TargetOrSourceAccount struct {
 	Institution Institution `json:"institution"`
 }
 
+// UpiPaymentStatus is the lifecycle status of a UPI payment, sent or received.
+type UpiPaymentStatus string
+
+const (
+	UpiPaymentStatusCreated       UpiPaymentStatus = "CREATED"
+	UpiPaymentStatusMoneyReserved UpiPaymentStatus = "MONEY_RESERVED"
+	UpiPaymentStatusSettled       UpiPaymentStatus = "SETTLED"
+	UpiPaymentStatusFailed        UpiPaymentStatus = "FAILED"
+	UpiPaymentStatusRefunded      UpiPaymentStatus = "REFUNDED"
+	// UpiPaymentStatusPartiallyRefunded is a settled payment with refunds
+	// below its amount
+	UpiPaymentStatusPartiallyRefunded UpiPaymentStatus = "PARTIALLY_REFUNDED"
+)
+
+// upiPaymentTransitions lists the statuses directly reachable from each status.
+var upiPaymentTransitions = map[UpiPaymentStatus][]UpiPaymentStatus{
+	UpiPaymentStatusCreated:           {UpiPaymentStatusMoneyReserved, UpiPaymentStatusSettled, UpiPaymentStatusFailed},
+	UpiPaymentStatusMoneyReserved:     {UpiPaymentStatusSettled, UpiPaymentStatusFailed},
+	UpiPaymentStatusSettled:           {UpiPaymentStatusPartiallyRefunded, UpiPaymentStatusRefunded},
+	UpiPaymentStatusPartiallyRefunded: {UpiPaymentStatusRefunded},
+}
+
+// IsTerminal reports whether the payment reached a status it will not leave
+// on its own. A settled payment may still be refunded by the receiver.
+func (s UpiPaymentStatus) IsTerminal() bool {
+	switch s {
+	case UpiPaymentStatusSettled, UpiPaymentStatusFailed, UpiPaymentStatusRefunded,
+		UpiPaymentStatusPartiallyRefunded:
+		return true
+	}
+	return false
+}
+
+// IsKnown reports whether s is one of the statuses declared in this package.
+func (s UpiPaymentStatus) IsKnown() bool {
+	switch s {
+	case UpiPaymentStatusCreated, UpiPaymentStatusMoneyReserved, UpiPaymentStatusSettled,
+		UpiPaymentStatusFailed, UpiPaymentStatusRefunded, UpiPaymentStatusPartiallyRefunded:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether next can be observed after s, directly or
+// through intermediate statuses. Unknown statuses are not constrained.
+func (s UpiPaymentStatus) CanTransitionTo(next UpiPaymentStatus) bool {
+	if !s.IsKnown() || !next.IsKnown() {
+		return true
+	}
+
+	return reachable(string(s), string(next), func(from string) []string {
+		var to []string
+		for _, n := range upiPaymentTransitions[UpiPaymentStatus(from)] {
+			to = append(to, string(n))
+		}
+		return to
+	})
+}
+
 type UPIOutBoundOutput struct {
 	ID                       string                `json:"id"`
 	AccountID                string                `json:"account_id"`
@@ -46,7 +108,7 @@ type UPIOutBoundOutput struct {
 	Fee                      float64               `json:"fee"`
 	RefundedAmount           float64               `json:"refunded_amount"`
 	TransactionID            string                `json:"transaction_id"`
-	Status                   string                `json:"status"` //currently returning: CREATED, FAILED, MONEY_RESERVED, SETTLED, REFUNDED
+	Status                   string                `json:"status"` // see UpiPaymentStatus
 	Source                   TargetOrSourceAccount `json:"source"`
 	Target                   TargetOrSourceAccount `json:"target"`
 	CreatedBy                string                `json:"created_by"`
@@ -67,6 +129,11 @@ type GetQRCodeInput struct {
 	Date         string `json:"payment_date,omitempty"`
 }
 
+const (
+	QRCodeTypeStatic  = "static"
+	QRCodeTypeDynamic = "dynamic"
+)
+
 type QRCode struct {
 	Type    string        `json:"type"`
 	Static  QRCodeStatic  `json:"static,omitempty"`
@@ -92,6 +159,21 @@ type QRCodeDynamic struct {
 	AdditionalData    []QRCodeAdditionalData `json:"additional_data,omitempty"`
 }
 
+// Expired reports whether the dynamic QR code expired at now. Codes without
+// expiration or with an unparseable creation time never expire.
+func (q *QRCodeDynamic) Expired(now time.Time) bool {
+	if q.Expiration <= 0 {
+		return false
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, q.CreatedAt)
+	if err != nil {
+		return false
+	}
+
+	return now.After(createdAt.Add(time.Duration(q.Expiration) * time.Second))
+}
+
 type UPIInvoiceOutput struct {
 	ID              string                 `json:"id"`
 	AccountID       string                 `json:"account_id"`
@@ -113,6 +195,7 @@ type UPIInvoiceOutput struct {
 	QrCodeContent   string                 `json:"qr_code_content"`
 	QrCodeImage     string                 `json:"qr_code_image"`
 	RequestForPayer string                 `json:"request_for_payer"`
+	Revision        int                    `json:"revision"`
 }
 
 type CreatePendingPaymentInput struct {
@@ -258,3 +341,29 @@ func (p CreateDynamicQRCodeInput) Validate() error {
 
 	return nil
 }
+
+// Validate checks the pending payment before it is created. When a source is
+// given its entity document is verified and normalised.
+func (p *CreatePendingPaymentInput) Validate() error {
+	if p.Amount < 0 {
+		return errors.New("amount can't be negative")
+	}
+
+	if p.Source == nil {
+		return nil
+	}
+
+	documentType := validation.NormalizeDocumentType(p.Source.Entity.DocumentType)
+	if documentType == "" {
+		documentType = validation.DocumentTypeOf(p.Source.Entity.Document)
+	}
+
+	document, err := validation.ValidateDocument(p.Source.Entity.Document, documentType)
+	if err != nil {
+		return fmt.Errorf("source entity document: %w", err)
+	}
+	p.Source.Entity.Document = document
+	p.Source.Entity.DocumentType = documentType
+
+	return nil
+}
@@ -0,0 +1,266 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
+// UpiKeyType is the kind of a UPI key (entry)
+type UpiKeyType string
+
+const (
+	UpiKeyTypeEmail UpiKeyType = "email"
+	UpiKeyTypePhone UpiKeyType = "phone"
+	UpiKeyTypeCPF   UpiKeyType = "cpf"
+	UpiKeyTypeCNPJ  UpiKeyType = "cnpj"
+	// UpiKeyTypeEVP is a random key generated by the server
+	UpiKeyTypeEVP UpiKeyType = "evp"
+
+	upiEmailKeyMaxSize = 77
+)
+
+var (
+	ErrInvalidUpiKey     = errors.New("invalid upi key")
+	ErrInvalidUpiKeyType = errors.New("invalid upi key type")
+
+	upiEmailPattern = regexp.MustCompile(`^[a-z0-9.!#$%&'*+/=?^_{|}~-]+@[a-z0-9-]+(\.[a-z0-9-]+)+$`)
+	upiPhonePattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	upiEVPPattern   = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// ParseUpiKeyType accepts a key type in any case
+func ParseUpiKeyType(s string) (UpiKeyType, error) {
+	t := UpiKeyType(strings.ToLower(strings.TrimSpace(s)))
+	switch t {
+	case UpiKeyTypeEmail, UpiKeyTypePhone, UpiKeyTypeCPF, UpiKeyTypeCNPJ, UpiKeyTypeEVP:
+		return t, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidUpiKeyType, s)
+}
+
+// DetectUpiKeyType guesses the type of key from its format. Eleven digits are
+// taken as a CPF; a phone key must carry its country code.
+func DetectUpiKeyType(key string) (UpiKeyType, error) {
+	key = strings.TrimSpace(key)
+	for _, t := range []UpiKeyType{UpiKeyTypePhone, UpiKeyTypeEVP, UpiKeyTypeEmail, UpiKeyTypeCPF, UpiKeyTypeCNPJ} {
+		if _, err := t.Normalize(key); err == nil {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidUpiKey, key)
+}
+
+// Normalize validates key against the type and returns it in the form
+// registered by the API: lowercase email and EVP, +<country><number> phone
+// and CPF/CNPJ as digits.
+func (t UpiKeyType) Normalize(key string) (string, error) {
+	key = strings.TrimSpace(key)
+
+	switch t {
+	case UpiKeyTypeEmail:
+		key = strings.ToLower(key)
+		if len(key) > upiEmailKeyMaxSize || !upiEmailPattern.MatchString(key) {
+			return "", fmt.Errorf("%w: %q is not an email", ErrInvalidUpiKey, key)
+		}
+		return key, nil
+	case UpiKeyTypePhone:
+		key = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(key)
+		if !upiPhonePattern.MatchString(key) {
+			return "", fmt.Errorf("%w: %q is not a phone number with country code", ErrInvalidUpiKey, key)
+		}
+		return key, nil
+	case UpiKeyTypeCPF, UpiKeyTypeCNPJ:
+		doc, err := validation.ValidateDocument(key, string(t))
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidUpiKey, err)
+		}
+		return doc, nil
+	case UpiKeyTypeEVP:
+		key = strings.ToLower(key)
+		if !upiEVPPattern.MatchString(key) {
+			return "", fmt.Errorf("%w: %q is not a random key", ErrInvalidUpiKey, key)
+		}
+		return key, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidUpiKeyType, string(t))
+}
+
+// Validate checks the entry before it is created, normalising the key and its
+// type. The key of an EVP entry is generated by the server and may be empty.
+func (p *CreateUpiEntryInput) Validate() error {
+	if p.AccountID == "" {
+		return errors.New("account_id can't be empty")
+	}
+
+	keyType, err := ParseUpiKeyType(p.KeyType)
+	if err != nil {
+		return err
+	}
+	p.KeyType = string(keyType)
+
+	if keyType == UpiKeyTypeEVP && strings.TrimSpace(p.Key) == "" {
+		p.Key = ""
+		return nil
+	}
+
+	key, err := keyType.Normalize(p.Key)
+	if err != nil {
+		return err
+	}
+	p.Key = key
+
+	return nil
+}
+
+// UpiClaimType is the kind of claim over a key registered elsewhere
+type UpiClaimType string
+
+const (
+	// UpiClaimTypeOwnership claims a key registered by another person
+	UpiClaimTypeOwnership UpiClaimType = "OWNERSHIP"
+	// UpiClaimTypePortability moves a key of the same owner from another
+	// institution
+	UpiClaimTypePortability UpiClaimType = "PORTABILITY"
+)
+
+// UpiClaimStatus is the lifecycle status of a claim
+type UpiClaimStatus string
+
+const (
+	UpiClaimStatusOpen              UpiClaimStatus = "OPEN"
+	UpiClaimStatusWaitingResolution UpiClaimStatus = "WAITING_RESOLUTION"
+	UpiClaimStatusConfirmed         UpiClaimStatus = "CONFIRMED"
+	UpiClaimStatusCancelled         UpiClaimStatus = "CANCELLED"
+	UpiClaimStatusCompleted         UpiClaimStatus = "COMPLETED"
+)
+
+// IsTerminal reports whether the claim can't change anymore
+func (s UpiClaimStatus) IsTerminal() bool {
+	return s == UpiClaimStatusCancelled || s == UpiClaimStatusCompleted
+}
+
+type UpiClaim struct {
+	ID                  string `json:"id"`
+	Type                string `json:"type"`   // see UpiClaimType
+	Status              string `json:"status"` // see UpiClaimStatus
+	Key                 string `json:"key"`
+	KeyType             string `json:"key_type"`
+	AccountID           string `json:"account_id"`
+	ClaimerISPB         string `json:"claimer_ispb"`
+	DonorISPB           string `json:"donor_ispb"`
+	ResolutionLimitDate string `json:"resolution_limit_date,omitempty"`
+	CompletionLimitDate string `json:"completion_limit_date,omitempty"`
+	CancelledBy         string `json:"cancelled_by,omitempty"`
+	CancelReason        string `json:"cancel_reason,omitempty"`
+	CreatedAt           string `json:"created_at"`
+	UpdatedAt           string `json:"updated_at"`
+}
+
+type CreateUpiClaimInput struct {
+	AccountID        string `json:"account_id"`
+	Key              string `json:"key"`
+	KeyType          string `json:"key_type"`
+	Type             string `json:"type"` // see UpiClaimType
+	ParticipantISPB  string `json:"participant_ispb"`
+	VerificationID   string `json:"verification_id,omitempty"`
+	VerificationCode string `json:"verification_code,omitempty"`
+}
+
+// Validate checks the claim before it is created, normalising the key. EVP
+// keys can't be claimed, and only email and phone keys can change owner.
+func (p *CreateUpiClaimInput) Validate() error {
+	if p.AccountID == "" {
+		return errors.New("account_id can't be empty")
+	}
+
+	switch UpiClaimType(strings.ToUpper(p.Type)) {
+	case UpiClaimTypeOwnership, UpiClaimTypePortability:
+		p.Type = strings.ToUpper(p.Type)
+	default:
+		return fmt.Errorf("invalid claim type %q", p.Type)
+	}
+
+	keyType, err := ParseUpiKeyType(p.KeyType)
+	if err != nil {
+		return err
+	}
+	if keyType == UpiKeyTypeEVP {
+		return errors.New("evp keys can't be claimed")
+	}
+	if UpiClaimType(p.Type) == UpiClaimTypeOwnership && keyType != UpiKeyTypeEmail && keyType != UpiKeyTypePhone {
+		return fmt.Errorf("ownership claims are not allowed for %s keys", keyType)
+	}
+	p.KeyType = string(keyType)
+
+	key, err := keyType.Normalize(p.Key)
+	if err != nil {
+		return err
+	}
+	p.Key = key
+
+	return nil
+}
+
+type CancelUpiClaimInput struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// UpiKeyLookup is the owner of a UPI key as resolved by the key directory
+type UpiKeyLookup struct {
+	Key                string             `json:"key"`
+	KeyType            string             `json:"key_type"`
+	EndToEndID         string             `json:"end_to_end_id"`
+	Institution        Institution        `json:"institution"`
+	BeneficiaryEntity  BeneficiaryEntity  `json:"beneficiary_entity"`
+	BeneficiaryAccount BeneficiaryAccount `json:"beneficiary_account"`
+}
+
+// MaskedDocument hides the first three and the last two digits of a CPF, as
+// shown to payers before they confirm; a CNPJ is public and only formatted.
+func (e BeneficiaryEntity) MaskedDocument() string {
+	doc := validation.OnlyDigits(e.Document)
+
+	switch validation.DocumentTypeOf(doc) {
+	case validation.DocumentTypeCPF:
+		return "***." + doc[3:6] + "." + doc[6:9] + "-**"
+	case validation.DocumentTypeCNPJ:
+		return validation.FormatDocument(doc)
+	}
+
+	return e.Document
+}
+
+// NameMatches compares the beneficiary name with expected ignoring case,
+// accents and repeated spaces.
+func (e BeneficiaryEntity) NameMatches(expected string) bool {
+	return foldName(e.Name) != "" && foldName(e.Name) == foldName(expected)
+}
+
+func foldName(name string) string {
+	return strings.Join(strings.Fields(validation.FoldAccents(name)), " ")
+}
@@ -0,0 +1,89 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"github.com/bhojpur/bank/pkg/validation"
+)
+
+type UPIInBoundOutput struct {
+	ID             string                `json:"id"`
+	AccountID      string                `json:"account_id"`
+	Currency       string                `json:"currency"`
+	Amount         float64               `json:"amount"`
+	RefundedAmount float64               `json:"refunded_amount"`
+	Description    string                `json:"description"`
+	EndToEndID     string                `json:"end_to_end_id"`
+	TransactionID  string                `json:"transaction_id"`
+	Key            string                `json:"key"`
+	Status         string                `json:"status"` // see UpiPaymentStatus
+	Source         TargetOrSourceAccount `json:"source"`
+	Target         TargetOrSourceAccount `json:"target"`
+	CreatedAt      string                `json:"created_at"`
+	SettledAt      string                `json:"settled_at"`
+}
+
+// UpiPayer identifies who sent a received UPI payment
+type UpiPayer struct {
+	Name         string
+	Document     string
+	DocumentType string // validation.DocumentTypeCPF or validation.DocumentTypeCNPJ
+	Institution  Institution
+	BranchCode   string
+	AccountCode  string
+	AccountType  string
+}
+
+// IsCompany reports whether the payer is identified by a CNPJ
+func (p UpiPayer) IsCompany() bool {
+	return p.DocumentType == validation.DocumentTypeCNPJ
+}
+
+// Payer returns the source of the payment. The document type is inferred
+// from the document when the API leaves it out.
+func (u *UPIInBoundOutput) Payer() UpiPayer {
+	documentType := validation.NormalizeDocumentType(u.Source.Entity.DocumentType)
+	if documentType == "" {
+		documentType = validation.DocumentTypeOf(u.Source.Entity.Document)
+	}
+
+	return UpiPayer{
+		Name:         u.Source.Entity.Name,
+		Document:     validation.OnlyDigits(u.Source.Entity.Document),
+		DocumentType: documentType,
+		Institution:  u.Source.Institution,
+		BranchCode:   u.Source.Account.BranchCode,
+		AccountCode:  u.Source.Account.AccountCode,
+		AccountType:  u.Source.Account.AccountType,
+	}
+}
+
+// Pays reports whether the payment settles the dynamic QR code invoice,
+// matching them by transaction id.
+func (u *UPIInBoundOutput) Pays(invoice *UPIInvoiceOutput) bool {
+	return u.TransactionID != "" && u.TransactionID == invoice.TransactionID &&
+		(invoice.AccountID == "" || u.AccountID == "" || u.AccountID == invoice.AccountID)
+}
+
+// PaysQRCode is like Pays for a decoded dynamic QR code
+func (u *UPIInBoundOutput) PaysQRCode(qrcode *QRCodeDynamic) bool {
+	return u.TransactionID != "" && u.TransactionID == qrcode.TxnID
+}
@@ -0,0 +1,108 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+)
+
+// UpiInvoiceStatus is the lifecycle status of a dynamic QR code invoice
+type UpiInvoiceStatus string
+
+const (
+	UpiInvoiceStatusCreated   UpiInvoiceStatus = "CREATED"
+	UpiInvoiceStatusPaid      UpiInvoiceStatus = "PAID"
+	UpiInvoiceStatusCancelled UpiInvoiceStatus = "CANCELLED"
+	UpiInvoiceStatusExpired   UpiInvoiceStatus = "EXPIRED"
+)
+
+// IsTerminal reports whether the invoice can no longer be paid or changed
+func (s UpiInvoiceStatus) IsTerminal() bool {
+	return s == UpiInvoiceStatusPaid || s == UpiInvoiceStatusCancelled || s == UpiInvoiceStatusExpired
+}
+
+// DynamicQRCodeFilter narrows the dynamic QR codes listed for an account.
+// Zero fields are ignored and dates are inclusive.
+type DynamicQRCodeFilter struct {
+	Status UpiInvoiceStatus
+	From   Date
+	To     Date
+}
+
+// Matches reports whether q passes the filter. Codes with an unparseable
+// creation date only pass filters without dates.
+func (f DynamicQRCodeFilter) Matches(q QRCodeDynamic) bool {
+	if f.Status != "" && UpiInvoiceStatus(q.Status) != f.Status {
+		return false
+	}
+
+	if f.From.IsZero() && f.To.IsZero() {
+		return true
+	}
+
+	date, err := BankDate(q.CreatedAt)
+	if err != nil {
+		return false
+	}
+
+	if !f.From.IsZero() && date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && f.To.Before(date) {
+		return false
+	}
+
+	return true
+}
+
+// UpdateDynamicQRCodeInput changes an unpaid dynamic QR code. Revision must
+// be the revision last read; the update is refused if the code changed since.
+type UpdateDynamicQRCodeInput struct {
+	Revision        int                    `json:"revision"`
+	Amount          *float64               `json:"amount,omitempty"`
+	Expiration      *int                   `json:"expiration,omitempty"`
+	AdditionalData  []QRCodeAdditionalData `json:"additional_data,omitempty"`
+	RequestForPayer *string                `json:"request_for_payer,omitempty"`
+}
+
+func (p UpdateDynamicQRCodeInput) Validate() error {
+	if p.Revision < 0 {
+		return errors.New("revision can't be negative")
+	}
+
+	if p.Amount == nil && p.Expiration == nil && p.AdditionalData == nil && p.RequestForPayer == nil {
+		return errors.New("nothing to update")
+	}
+
+	if p.Amount != nil && *p.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+
+	if p.Expiration != nil && *p.Expiration <= 0 {
+		return errors.New("expiration must be greater than zero")
+	}
+
+	return nil
+}
+
+type CancelDynamicQRCodeInput struct {
+	Revision int `json:"revision"`
+}
@@ -0,0 +1,308 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Frequencies of a RecurrenceRule. Longer periods are expressed with
+// Interval, a quarterly recurrence being MONTHLY with an interval of 3.
+const (
+	RecurrenceFrequencyWeekly  = "WEEKLY"
+	RecurrenceFrequencyMonthly = "MONTHLY"
+	RecurrenceFrequencyYearly  = "YEARLY"
+)
+
+// ErrCollectionPeriodTaken is returned when the period of a due date already
+// has a live collection
+var ErrCollectionPeriodTaken = errors.New("a collection is already scheduled for this period")
+
+// UpiRecurrenceHorizonDays is how far ahead a collection can be scheduled
+const UpiRecurrenceHorizonDays = 10
+
+// UpiRecurrenceStatus is the lifecycle status of a recurring payment
+// authorisation
+type UpiRecurrenceStatus string
+
+const (
+	UpiRecurrenceStatusPendingApproval UpiRecurrenceStatus = "PENDING_APPROVAL"
+	UpiRecurrenceStatusApproved        UpiRecurrenceStatus = "APPROVED"
+	UpiRecurrenceStatusRejected        UpiRecurrenceStatus = "REJECTED"
+	UpiRecurrenceStatusExpired         UpiRecurrenceStatus = "EXPIRED"
+	UpiRecurrenceStatusCancelled       UpiRecurrenceStatus = "CANCELLED"
+)
+
+// IsTerminal reports whether the authorisation will never be approved or
+// used again
+func (s UpiRecurrenceStatus) IsTerminal() bool {
+	switch s {
+	case UpiRecurrenceStatusRejected, UpiRecurrenceStatusExpired, UpiRecurrenceStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Validate checks the rule for a recurring UPI authorisation
+func (r RecurrenceRule) Validate() error {
+	if _, err := Date(r.StartDate).Time(); err != nil {
+		return fmt.Errorf("startDate: %w", err)
+	}
+
+	switch strings.ToUpper(r.Frequency) {
+	case RecurrenceFrequencyWeekly, RecurrenceFrequencyMonthly, RecurrenceFrequencyYearly:
+	default:
+		return fmt.Errorf("invalid frequency %q", r.Frequency)
+	}
+
+	if r.Interval < 0 || r.Count < 0 {
+		return errors.New("interval and count can't be negative")
+	}
+
+	if r.UntilDate != "" {
+		if _, err := Date(r.UntilDate).Time(); err != nil {
+			return fmt.Errorf("untilDate: %w", err)
+		}
+		if Date(r.UntilDate).Before(Date(r.StartDate)) {
+			return errors.New("untilDate can't be before startDate")
+		}
+	}
+
+	return nil
+}
+
+// Contains reports whether d is one of the occurrences of the rule: the
+// start date moved by a whole number of intervals, within Count and the
+// until date. Monthly and yearly occurrences past the end of a short month
+// fall on its last day.
+func (r RecurrenceRule) Contains(d Date) bool {
+	k, ok := r.Period(d)
+	if !ok {
+		return false
+	}
+	occurrence, err := r.Occurrence(k)
+	return err == nil && occurrence == d
+}
+
+// Period returns the index of the occurrence period d falls in, from the
+// start date up to the day before the next occurrence. ok is false when d is
+// before the start or past the last occurrence allowed by Count or the until
+// date.
+func (r RecurrenceRule) Period(d Date) (k int, ok bool) {
+	start := Date(r.StartDate)
+	if _, err := d.Time(); err != nil || d.Before(start) {
+		return 0, false
+	}
+	if r.UntilDate != "" && Date(r.UntilDate).Before(d) {
+		return 0, false
+	}
+
+	for k = 0; r.Count == 0 || k < int(r.Count); k++ {
+		next, err := r.Occurrence(k + 1)
+		if err != nil {
+			return 0, false
+		}
+		if d.Before(next) {
+			break
+		}
+	}
+	if r.Count > 0 && k >= int(r.Count) {
+		return 0, false
+	}
+
+	occurrence, _ := r.Occurrence(k)
+	if r.UntilDate != "" && Date(r.UntilDate).Before(occurrence) {
+		return 0, false
+	}
+	return k, true
+}
+
+// Occurrence returns the date of the k-th occurrence, the first being the
+// start date. Count and the until date are not checked.
+func (r RecurrenceRule) Occurrence(k int) (Date, error) {
+	start, err := Date(r.StartDate).Time()
+	if err != nil {
+		return "", err
+	}
+
+	n := k
+	if r.Interval > 1 {
+		n *= int(r.Interval)
+	}
+
+	months := 0
+	switch strings.ToUpper(r.Frequency) {
+	case RecurrenceFrequencyWeekly:
+		return NewDate(start.AddDate(0, 0, 7*n)), nil
+	case RecurrenceFrequencyMonthly:
+		months = n
+	case RecurrenceFrequencyYearly:
+		months = 12 * n
+	default:
+		return "", fmt.Errorf("invalid frequency %q", r.Frequency)
+	}
+
+	first := time.Date(start.Year(), start.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	day := start.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return NewDate(first.AddDate(0, 0, day-1)), nil
+}
+
+// UpiRecurrenceInput asks a payer to authorise recurring collections. Either
+// a fixed Amount or a MaxAmount for variable collections must be set.
+type UpiRecurrenceInput struct {
+	AccountID   string         `json:"account_id"`
+	ContractID  string         `json:"contract_id"`
+	Description string         `json:"description,omitempty"`
+	Payer       Entity         `json:"payer"`
+	Amount      float64        `json:"amount,omitempty"`
+	MaxAmount   float64        `json:"max_amount,omitempty"`
+	Recurrence  RecurrenceRule `json:"recurrence"`
+	// Expiration is how long the payer has to approve, in seconds
+	Expiration int `json:"expiration,omitempty"`
+}
+
+func (p *UpiRecurrenceInput) Validate() error {
+	if p.AccountID == "" {
+		return errors.New("account_id can't be empty")
+	}
+
+	if strings.TrimSpace(p.ContractID) == "" {
+		return errors.New("contract_id can't be empty")
+	}
+
+	if (p.Amount > 0) == (p.MaxAmount > 0) {
+		return errors.New("either amount or max_amount must be set")
+	}
+	if p.Amount < 0 || p.MaxAmount < 0 {
+		return errors.New("amount can't be negative")
+	}
+
+	if err := p.Payer.Validate(); err != nil {
+		return fmt.Errorf("payer: %w", err)
+	}
+
+	p.Recurrence.Frequency = strings.ToUpper(p.Recurrence.Frequency)
+	return p.Recurrence.Validate()
+}
+
+type UpiRecurrence struct {
+	ID               string         `json:"id"`
+	AccountID        string         `json:"account_id"`
+	ContractID       string         `json:"contract_id"`
+	Description      string         `json:"description"`
+	Status           string         `json:"status"` // see UpiRecurrenceStatus
+	Payer            Entity         `json:"payer"`
+	PayerInstitution Institution    `json:"payer_institution"`
+	Amount           float64        `json:"amount,omitempty"`
+	MaxAmount        float64        `json:"max_amount,omitempty"`
+	Recurrence       RecurrenceRule `json:"recurrence"`
+	CreatedAt        string         `json:"created_at"`
+	ApprovedAt       string         `json:"approved_at,omitempty"`
+	RejectedAt       string         `json:"rejected_at,omitempty"`
+	CancelledAt      string         `json:"cancelled_at,omitempty"`
+	CancelledBy      string         `json:"cancelled_by,omitempty"`
+	CancelReason     string         `json:"cancel_reason,omitempty"`
+}
+
+type CancelUpiRecurrenceInput struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// UpiCollectionInput schedules a collection against an approved recurrence
+type UpiCollectionInput struct {
+	Amount        float64 `json:"amount"`
+	DueDate       Date    `json:"due_date"`
+	Description   string  `json:"description,omitempty"`
+	TransactionID string  `json:"transaction_id,omitempty"`
+}
+
+// Validate checks the collection against the recurrence it is charged to and
+// the collections already scheduled against it, of which at most one per
+// period may be live. A zero Amount takes the fixed amount of the recurrence.
+func (p *UpiCollectionInput) Validate(recurrence *UpiRecurrence, existing []UpiCollection, today time.Time) error {
+	if UpiRecurrenceStatus(recurrence.Status) != UpiRecurrenceStatusApproved {
+		return fmt.Errorf("recurrence is %s, collections need it approved", recurrence.Status)
+	}
+
+	if p.Amount == 0 {
+		p.Amount = recurrence.Amount
+	}
+	switch {
+	case p.Amount <= 0:
+		return errors.New("amount must be greater than zero")
+	case recurrence.Amount > 0 && p.Amount != recurrence.Amount:
+		return fmt.Errorf("amount must be the fixed amount %.0f", recurrence.Amount)
+	case recurrence.MaxAmount > 0 && p.Amount > recurrence.MaxAmount:
+		return fmt.Errorf("amount can't exceed max_amount %.0f", recurrence.MaxAmount)
+	}
+
+	if err := p.DueDate.ValidateWithin(today, UpiRecurrenceHorizonDays); err != nil {
+		return fmt.Errorf("due_date: %w", err)
+	}
+	if !recurrence.Recurrence.Contains(p.DueDate) {
+		return errors.New("due_date is not an occurrence of the recurrence")
+	}
+
+	period, _ := recurrence.Recurrence.Period(p.DueDate)
+	for _, c := range existing {
+		if !UpiCollectionStatus(c.Status).IsLive() {
+			continue
+		}
+		if k, ok := recurrence.Recurrence.Period(c.DueDate); ok && k == period {
+			return fmt.Errorf("%w: %s due %s", ErrCollectionPeriodTaken, c.ID, c.DueDate)
+		}
+	}
+
+	return nil
+}
+
+// UpiCollectionStatus is the lifecycle status of a scheduled collection
+type UpiCollectionStatus string
+
+const (
+	UpiCollectionStatusScheduled UpiCollectionStatus = "SCHEDULED"
+	UpiCollectionStatusSettled   UpiCollectionStatus = "SETTLED"
+	UpiCollectionStatusFailed    UpiCollectionStatus = "FAILED"
+	UpiCollectionStatusCancelled UpiCollectionStatus = "CANCELLED"
+)
+
+// IsLive reports whether the collection still takes up its period
+func (s UpiCollectionStatus) IsLive() bool {
+	return s == UpiCollectionStatusScheduled || s == UpiCollectionStatusSettled
+}
+
+type UpiCollection struct {
+	ID            string  `json:"id"`
+	RecurrenceID  string  `json:"recurrence_id"`
+	Amount        float64 `json:"amount"`
+	DueDate       Date    `json:"due_date"`
+	Description   string  `json:"description"`
+	TransactionID string  `json:"transaction_id"`
+	Status        string  `json:"status"` // see UpiCollectionStatus
+	CreatedAt     string  `json:"created_at"`
+	CancelledAt   string  `json:"cancelled_at,omitempty"`
+}
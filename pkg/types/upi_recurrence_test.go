@@ -0,0 +1,88 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecurrenceRuleContains(t *testing.T) {
+	monthly := RecurrenceRule{StartDate: "2026-01-31", Frequency: RecurrenceFrequencyMonthly, Count: 4}
+	quarterly := RecurrenceRule{StartDate: "2026-01-15", Frequency: RecurrenceFrequencyMonthly, Interval: 3, UntilDate: "2026-10-14"}
+	weekly := RecurrenceRule{StartDate: "2026-03-02", Frequency: RecurrenceFrequencyWeekly, Interval: 2}
+	yearly := RecurrenceRule{StartDate: "2024-02-29", Frequency: RecurrenceFrequencyYearly}
+
+	tests := []struct {
+		name string
+		rule RecurrenceRule
+		date Date
+		want bool
+	}{
+		{"start", monthly, "2026-01-31", true},
+		{"short month", monthly, "2026-02-28", true},
+		{"thirty days", monthly, "2026-04-30", true},
+		{"past count", monthly, "2026-05-31", false},
+		{"before start", monthly, "2026-01-30", false},
+		{"between occurrences", monthly, "2026-02-15", false},
+		{"interval", quarterly, "2026-04-15", true},
+		{"skipped by interval", quarterly, "2026-02-15", false},
+		{"past until", quarterly, "2026-10-15", false},
+		{"two weeks", weekly, "2026-03-16", true},
+		{"one week", weekly, "2026-03-09", false},
+		{"leap day", yearly, "2025-02-28", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rule.Contains(tt.date); got != tt.want {
+			t.Errorf("%s: Contains(%s) returned %v, expected %v", tt.name, tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestUpiCollectionInputValidatePeriod(t *testing.T) {
+	recurrence := &UpiRecurrence{
+		Status:     string(UpiRecurrenceStatusApproved),
+		Amount:     1000,
+		Recurrence: RecurrenceRule{StartDate: "2026-03-02", Frequency: RecurrenceFrequencyWeekly},
+	}
+	today := time.Date(2026, 3, 5, 12, 0, 0, 0, BankLocation)
+
+	existing := []UpiCollection{
+		{ID: "c1", DueDate: "2026-03-02", Status: string(UpiCollectionStatusSettled)},
+		{ID: "c2", DueDate: "2026-03-09", Status: string(UpiCollectionStatusCancelled)},
+		{ID: "c3", DueDate: "2026-03-13", Status: string(UpiCollectionStatusScheduled)},
+	}
+
+	input := UpiCollectionInput{DueDate: "2026-03-09"}
+	if err := input.Validate(recurrence, existing, today); !errors.Is(err, ErrCollectionPeriodTaken) {
+		t.Errorf("Validate returned error %v, expected %v", err, ErrCollectionPeriodTaken)
+	}
+
+	input = UpiCollectionInput{DueDate: "2026-03-09"}
+	if err := input.Validate(recurrence, existing[:2], today); err != nil {
+		t.Errorf("Validate returned error: %v", err)
+	}
+	if input.Amount != 1000 {
+		t.Errorf("Validate set amount %v, expected the fixed 1000", input.Amount)
+	}
+}
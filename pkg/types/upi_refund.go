@@ -0,0 +1,116 @@
+package types
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrRefundExceedsAmount = errors.New("refunds can't exceed the payment amount")
+
+// UpiRefundReason is the reason code sent with a refund
+type UpiRefundReason string
+
+const (
+	// UpiRefundReasonBankError returns a payment made by mistake of an institution
+	UpiRefundReasonBankError UpiRefundReason = "BE08"
+	// UpiRefundReasonFraud returns a payment suspected of fraud
+	UpiRefundReasonFraud UpiRefundReason = "FR01"
+	// UpiRefundReasonCustomerRequest returns a payment at the request of the
+	// receiver, such as a cancelled purchase
+	UpiRefundReasonCustomerRequest UpiRefundReason = "MD06"
+	// UpiRefundReasonWithdrawal returns the change of a withdrawal payment
+	UpiRefundReasonWithdrawal UpiRefundReason = "SL02"
+)
+
+// IsKnown reports whether r is one of the reasons declared in this package
+func (r UpiRefundReason) IsKnown() bool {
+	switch r {
+	case UpiRefundReasonBankError, UpiRefundReasonFraud, UpiRefundReasonCustomerRequest, UpiRefundReasonWithdrawal:
+		return true
+	}
+	return false
+}
+
+// UpiRefundStatus is the lifecycle status of a refund
+type UpiRefundStatus string
+
+const (
+	UpiRefundStatusCreated UpiRefundStatus = "CREATED"
+	UpiRefundStatusSettled UpiRefundStatus = "SETTLED"
+	UpiRefundStatusFailed  UpiRefundStatus = "FAILED"
+)
+
+// IsTerminal reports whether the refund reached its final status
+func (s UpiRefundStatus) IsTerminal() bool {
+	return s == UpiRefundStatusSettled || s == UpiRefundStatusFailed
+}
+
+type UpiRefund struct {
+	ID                       string  `json:"id"`
+	PaymentID                string  `json:"payment_id"`
+	AccountID                string  `json:"account_id"`
+	Currency                 string  `json:"currency"`
+	Amount                   float64 `json:"amount"`
+	ReasonCode               string  `json:"reason_code"` // see UpiRefundReason
+	Description              string  `json:"description,omitempty"`
+	Status                   string  `json:"status"` // see UpiRefundStatus
+	EndToEndID               string  `json:"end_to_end_id"`
+	ReturnID                 string  `json:"return_id"`
+	CreatedAt                string  `json:"created_at"`
+	SettledAt                string  `json:"settled_at,omitempty"`
+	FailedAt                 string  `json:"failed_at,omitempty"`
+	FailureReasonCode        string  `json:"failure_reason_code,omitempty"`
+	FailureReasonDescription string  `json:"failure_reason_description,omitempty"`
+}
+
+type CreateUpiRefundInput struct {
+	// Amount in cents; zero refunds whatever was not refunded yet
+	Amount      float64 `json:"amount"`
+	ReasonCode  string  `json:"reason_code"`
+	Description string  `json:"description,omitempty"`
+}
+
+// Validate checks the refund against a payment of amount of which refunded
+// was already returned. A zero Amount is left for the API to resolve to the
+// remaining balance, so a retry sends the same body.
+func (p *CreateUpiRefundInput) Validate(amount, refunded float64) error {
+	if !UpiRefundReason(p.ReasonCode).IsKnown() {
+		return fmt.Errorf("invalid refund reason_code %q", p.ReasonCode)
+	}
+
+	if p.Amount < 0 {
+		return errors.New("amount can't be negative")
+	}
+
+	remaining := math.Round(amount - refunded)
+	if remaining <= 0 {
+		return fmt.Errorf("%w: payment already refunded", ErrRefundExceedsAmount)
+	}
+
+	if math.Round(p.Amount) > remaining {
+		return fmt.Errorf("%w: %.0f requested, %.0f remaining", ErrRefundExceedsAmount, p.Amount, remaining)
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package validation
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidBranch  = errors.New("invalid branch_code")
+	ErrInvalidAccount = errors.New("invalid account_code")
+)
+
+// AccountRule describes how an institution formats its branch and account
+// codes. Check digit functions are optional; when set they are only applied
+// if the caller supplied a check digit.
+type AccountRule struct {
+	BranchMaxDigits  int
+	AccountMaxDigits int
+
+	BranchCheckDigit  func(branch string) string
+	AccountCheckDigit func(branch, account string) string
+}
+
+// defaultAccountRule is used for institutions without a specific rule.
+var defaultAccountRule = AccountRule{
+	BranchMaxDigits:  4,
+	AccountMaxDigits: 20,
+}
+
+// accountRules is keyed by the institution number (compe) code.
+var accountRules = map[string]AccountRule{
+	// Banco do Brasil
+	"001": {
+		BranchMaxDigits:   4,
+		AccountMaxDigits:  8,
+		BranchCheckDigit:  bbBranchCheckDigit,
+		AccountCheckDigit: bbAccountCheckDigit,
+	},
+	// Santander
+	"033": {BranchMaxDigits: 4, AccountMaxDigits: 8},
+	// Caixa Econômica Federal, account codes carry the operation prefix
+	"104": {BranchMaxDigits: 4, AccountMaxDigits: 12},
+	// Bradesco
+	"237": {
+		BranchMaxDigits:   4,
+		AccountMaxDigits:  7,
+		BranchCheckDigit:  bradescoBranchCheckDigit,
+		AccountCheckDigit: bradescoAccountCheckDigit,
+	},
+	// Itaú
+	"341": {
+		BranchMaxDigits:   4,
+		AccountMaxDigits:  5,
+		AccountCheckDigit: itauAccountCheckDigit,
+	},
+}
+
+// RegisterAccountRule sets the rule used for institutionCode, replacing any
+// existing one. It is meant to be called during program initialisation.
+func RegisterAccountRule(institutionCode string, rule AccountRule) {
+	accountRules[institutionCode] = rule
+}
+
+// AccountRuleFor returns the rule for institutionCode, falling back to a
+// permissive default.
+func AccountRuleFor(institutionCode string) AccountRule {
+	if rule, ok := accountRules[strings.TrimSpace(institutionCode)]; ok {
+		return rule
+	}
+	return defaultAccountRule
+}
+
+// ValidateBankAccount checks the branch and account codes against the rule of
+// institutionCode and returns them normalised as digits, followed by "-" and
+// the check digit when one was given.
+func ValidateBankAccount(institutionCode, branch, account string) (string, string, error) {
+	rule := AccountRuleFor(institutionCode)
+
+	branchNumber, branchDigit, err := splitCheckDigit(branch)
+	if err != nil || branchNumber == "" || len(branchNumber) > rule.BranchMaxDigits {
+		return "", "", ErrInvalidBranch
+	}
+
+	accountNumber, accountDigit, err := splitCheckDigit(account)
+	if err != nil || accountNumber == "" || len(accountNumber) > rule.AccountMaxDigits {
+		return "", "", ErrInvalidAccount
+	}
+
+	if branchDigit != "" && rule.BranchCheckDigit != nil {
+		if expected := rule.BranchCheckDigit(branchNumber); expected != branchDigit {
+			return "", "", fmt.Errorf("%w: check digit should be %s", ErrInvalidBranch, expected)
+		}
+	}
+
+	if accountDigit != "" && rule.AccountCheckDigit != nil {
+		if expected := rule.AccountCheckDigit(branchNumber, accountNumber); expected != accountDigit {
+			return "", "", fmt.Errorf("%w: check digit should be %s", ErrInvalidAccount, expected)
+		}
+	}
+
+	return joinCheckDigit(branchNumber, branchDigit), joinCheckDigit(accountNumber, accountDigit), nil
+}
+
+// splitCheckDigit separates "1234-5" into "1234" and "5". Spaces and dots are
+// ignored, and a check digit may be a digit or a letter (X, P).
+func splitCheckDigit(code string) (string, string, error) {
+	code = strings.ToUpper(strings.NewReplacer(" ", "", ".", "").Replace(code))
+
+	number, digit := code, ""
+	if i := strings.LastIndex(code, "-"); i >= 0 {
+		number, digit = code[:i], code[i+1:]
+		if len(digit) != 1 {
+			return "", "", errors.New("invalid check digit")
+		}
+		if c := digit[0]; !(c >= '0' && c <= '9') && c != 'X' && c != 'P' {
+			return "", "", errors.New("invalid check digit")
+		}
+	}
+
+	if OnlyDigits(number) != number {
+		return "", "", errors.New("code must contain only digits")
+	}
+
+	return number, digit, nil
+}
+
+func joinCheckDigit(number, digit string) string {
+	if digit == "" {
+		return number
+	}
+	return number + "-" + digit
+}
+
+// weightedSum multiplies the digits of s, right-aligned, by weights.
+func weightedSum(s string, weights []int) int {
+	sum := 0
+	for i := 0; i < len(s) && i < len(weights); i++ {
+		sum += int(s[len(s)-1-i]-'0') * weights[len(weights)-1-i]
+	}
+	return sum
+}
+
+func bbBranchCheckDigit(branch string) string {
+	return bbModulo11(weightedSum(branch, []int{5, 4, 3, 2}))
+}
+
+func bbAccountCheckDigit(_, account string) string {
+	return bbModulo11(weightedSum(account, []int{9, 8, 7, 6, 5, 4, 3, 2}))
+}
+
+func bbModulo11(sum int) string {
+	switch d := 11 - sum%11; d {
+	case 10:
+		return "X"
+	case 11:
+		return "0"
+	default:
+		return fmt.Sprint(d)
+	}
+}
+
+func bradescoBranchCheckDigit(branch string) string {
+	return bradescoModulo11(weightedSum(branch, []int{5, 4, 3, 2}))
+}
+
+func bradescoAccountCheckDigit(_, account string) string {
+	return bradescoModulo11(weightedSum(account, []int{2, 7, 6, 5, 4, 3, 2}))
+}
+
+func bradescoModulo11(sum int) string {
+	switch r := sum % 11; r {
+	case 0:
+		return "0"
+	case 1:
+		return "P"
+	default:
+		return fmt.Sprint(11 - r)
+	}
+}
+
+// itauAccountCheckDigit is a modulo 10 over the branch followed by the account.
+func itauAccountCheckDigit(branch, account string) string {
+	s := fmt.Sprintf("%04s%05s", branch, account)
+
+	sum := 0
+	for i := range s {
+		p := int(s[i]-'0') * (2 - i%2)
+		sum += p/10 + p%10
+	}
+
+	return fmt.Sprint((10 - sum%10) % 10)
+}
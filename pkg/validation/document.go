@@ -0,0 +1,159 @@
+package validation
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	DocumentTypeCPF  = "cpf"
+	DocumentTypeCNPJ = "cnpj"
+
+	cpfLength  = 11
+	cnpjLength = 14
+)
+
+var (
+	ErrInvalidCPF          = errors.New("invalid cpf")
+	ErrInvalidCNPJ         = errors.New("invalid cnpj")
+	ErrInvalidDocumentType = errors.New("invalid document type")
+)
+
+// OnlyDigits strips everything but the ASCII digits from s
+func OnlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// NormalizeDocumentType lowercases and trims a document type, so "CPF " and
+// "cpf" are treated the same.
+func NormalizeDocumentType(documentType string) string {
+	return strings.ToLower(strings.TrimSpace(documentType))
+}
+
+// DocumentTypeOf infers the document type from the number of digits in doc.
+// It returns an empty string when the length matches neither CPF nor CNPJ.
+func DocumentTypeOf(doc string) string {
+	switch len(OnlyDigits(doc)) {
+	case cpfLength:
+		return DocumentTypeCPF
+	case cnpjLength:
+		return DocumentTypeCNPJ
+	}
+	return ""
+}
+
+// ValidCPF reports whether doc is a CPF with valid check digits. Punctuation
+// is ignored.
+func ValidCPF(doc string) bool {
+	d := OnlyDigits(doc)
+	if len(d) != cpfLength || repeated(d) {
+		return false
+	}
+
+	return checkDigit(d[:9], cpfWeights(10)) == d[9] &&
+		checkDigit(d[:10], cpfWeights(11)) == d[10]
+}
+
+// ValidCNPJ reports whether doc is a CNPJ with valid check digits. Punctuation
+// is ignored.
+func ValidCNPJ(doc string) bool {
+	d := OnlyDigits(doc)
+	if len(d) != cnpjLength || repeated(d) {
+		return false
+	}
+
+	first := []int{5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}
+	second := append([]int{6}, first...)
+
+	return checkDigit(d[:12], first) == d[12] &&
+		checkDigit(d[:13], second) == d[13]
+}
+
+// ValidateDocument checks doc against documentType and returns the document
+// reduced to its digits, which is the form expected by the API.
+func ValidateDocument(doc, documentType string) (string, error) {
+	d := OnlyDigits(doc)
+
+	switch NormalizeDocumentType(documentType) {
+	case DocumentTypeCPF:
+		if !ValidCPF(d) {
+			return "", ErrInvalidCPF
+		}
+	case DocumentTypeCNPJ:
+		if !ValidCNPJ(d) {
+			return "", ErrInvalidCNPJ
+		}
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidDocumentType, documentType)
+	}
+
+	return d, nil
+}
+
+// FormatDocument renders a CPF as 000.000.000-00 and a CNPJ as
+// 00.000.000/0000-00. Anything else is returned unchanged.
+func FormatDocument(doc string) string {
+	d := OnlyDigits(doc)
+	switch len(d) {
+	case cpfLength:
+		return fmt.Sprintf("%s.%s.%s-%s", d[0:3], d[3:6], d[6:9], d[9:11])
+	case cnpjLength:
+		return fmt.Sprintf("%s.%s.%s/%s-%s", d[0:2], d[2:5], d[5:8], d[8:12], d[12:14])
+	}
+	return doc
+}
+
+func cpfWeights(start int) []int {
+	w := make([]int, start-1)
+	for i := range w {
+		w[i] = start - i
+	}
+	return w
+}
+
+// checkDigit computes the modulo 11 check digit used by both CPF and CNPJ.
+func checkDigit(digits string, weights []int) byte {
+	sum := 0
+	for i := range digits {
+		sum += int(digits[i]-'0') * weights[i]
+	}
+
+	r := sum % 11
+	if r < 2 {
+		return '0'
+	}
+	return byte('0' + 11 - r)
+}
+
+// repeated reports whether every digit in d is the same. Such sequences pass
+// the check digit algorithm but are never issued.
+func repeated(d string) bool {
+	return strings.Count(d, d[:1]) == len(d)
+}
@@ -0,0 +1,105 @@
+package validation
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateDocument(t *testing.T) {
+	tests := []struct {
+		doc          string
+		documentType string
+		expected     string
+		err          error
+	}{
+		{"529.982.247-25", "cpf", "52998224725", nil},
+		{"52998224725", "CPF", "52998224725", nil},
+		{"52998224726", "cpf", "", ErrInvalidCPF},
+		{"111.111.111-11", "cpf", "", ErrInvalidCPF},
+		{"11.222.333/0001-81", "cnpj", "11222333000181", nil},
+		{"11222333000180", "cnpj", "", ErrInvalidCNPJ},
+		{"52998224725", "cnpj", "", ErrInvalidCNPJ},
+		{"52998224725", "rg", "", ErrInvalidDocumentType},
+	}
+
+	for _, tt := range tests {
+		doc, err := ValidateDocument(tt.doc, tt.documentType)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ValidateDocument(%q, %q) returned error %v, expected %v", tt.doc, tt.documentType, err, tt.err)
+		}
+		if doc != tt.expected {
+			t.Errorf("ValidateDocument(%q, %q) returned %q, expected %q", tt.doc, tt.documentType, doc, tt.expected)
+		}
+	}
+}
+
+func TestFormatDocument(t *testing.T) {
+	if f := FormatDocument("52998224725"); f != "529.982.247-25" {
+		t.Errorf("FormatDocument returned %q", f)
+	}
+	if f := FormatDocument("11222333000181"); f != "11.222.333/0001-81" {
+		t.Errorf("FormatDocument returned %q", f)
+	}
+}
+
+func TestValidateBankAccount(t *testing.T) {
+	tests := []struct {
+		institution     string
+		branch, account string
+		expectedBranch  string
+		expectedAccount string
+		err             error
+	}{
+		{"001", "7032", "1234", "7032", "1234", nil},
+		{"001", "1234-3", "00210169-6", "1234-3", "00210169-6", nil},
+		{"001", "1234-4", "1234", "", "", ErrInvalidBranch},
+		{"001", "1234", "00210169-7", "", "", ErrInvalidAccount},
+		{"341", "2545", "02366-1", "2545", "02366-1", nil},
+		{"341", "2545", "02366-2", "", "", ErrInvalidAccount},
+		{"341", "2545", "123456", "", "", ErrInvalidAccount},
+		{"999", "12a4", "1234", "", "", ErrInvalidBranch},
+		{"999", " 0001 ", "123.456-7", "0001", "123456-7", nil},
+	}
+
+	for _, tt := range tests {
+		branch, account, err := ValidateBankAccount(tt.institution, tt.branch, tt.account)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ValidateBankAccount(%q, %q, %q) returned error %v, expected %v", tt.institution, tt.branch, tt.account, err, tt.err)
+		}
+		if branch != tt.expectedBranch || account != tt.expectedAccount {
+			t.Errorf("ValidateBankAccount(%q, %q, %q) returned %q %q, expected %q %q", tt.institution, tt.branch, tt.account,
+				branch, account, tt.expectedBranch, tt.expectedAccount)
+		}
+	}
+}
+
+func TestFoldAccents(t *testing.T) {
+	if f := FoldAccents("São João DA Conceição"); f != "sao joao da conceicao" {
+		t.Errorf("FoldAccents returned %q", f)
+	}
+	for s, want := range map[string]bool{"0123": true, "": false, "12a": false, " 1": false} {
+		if got := IsDigits(s); got != want {
+			t.Errorf("IsDigits(%q) returned %v, expected %v", s, got, want)
+		}
+	}
+}